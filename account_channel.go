@@ -2,6 +2,7 @@ package dydx
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -35,6 +36,18 @@ func newAccountChannelRequest(apiKey *ApiKey, accountNumber int) *accountChannel
 	return r
 }
 
+// matchAccountSubscribed matches the subscribed message of the account channel by the account number,
+// since the message has the account id instead of the account number of the request.
+func matchAccountSubscribed(accountNumber int) func([]byte) bool {
+	return func(msg []byte) bool {
+		var resp AccountChannelResponse
+		if err := json.Unmarshal(msg, &resp); err != nil || resp.Contents == nil || resp.Contents.Account == nil {
+			return false
+		}
+		return int(resp.Contents.Account.AccountNumber) == accountNumber
+	}
+}
+
 type AccountChannelResponseContents struct {
 	Account   *Account    `json:"account,omitempty"`
 	Orders    []*Order    `json:"orders,omitempty"`
@@ -48,10 +61,19 @@ type AccountChannelResponse = ChannelResponse[AccountChannelResponseContents]
 
 // SubscribeAccount gets the accounts update
 // It will feed the account update in sequence into the channel provided. It returns after the subscription is done and closed.
-func (c *Client) SubscribeAccount(ctx context.Context, accountNumber int, outputChan chan<- *AccountChannelResponse) error {
+// The subscribe request is signed again with a fresh timestamp each time the subscription reconnects.
+func (c *Client) SubscribeAccount(ctx context.Context, accountNumber int, outputChan chan<- *AccountChannelResponse, options ...SubscriptionOption) error {
 	if c.apiKey == nil {
 		return fmt.Errorf("client doesn't have api key")
 	}
 
-	return subscribeForType(ctx, c.wsUrl, newAccountChannelRequest(c.apiKey, accountNumber), newUnsubscribeRequest(AccountChannel, ""), outputChan)
+	return c.getWsConnection().SubscribeAccount(ctx, c.apiKey, accountNumber, outputChan, options...)
+}
+
+// SubscribeAccountWithHandler starts the account subscription in the background and sends the updates to the handler.
+// It returns after the subscription is acknowledged. See StartSubscription.
+func (c *Client) SubscribeAccountWithHandler(ctx context.Context, accountNumber int, handler SubscriptionHandler[AccountChannelResponseContents], options ...SubscriptionOption) (*Subscription, error) {
+	return StartSubscription(ctx, func(ctx context.Context, outputChan chan<- *AccountChannelResponse) error {
+		return c.SubscribeAccount(ctx, accountNumber, outputChan, options...)
+	}, handler)
 }
@@ -80,6 +80,7 @@ func (ap *AccountProcessor) getAccountInfoByMarket(market string) *AccountInfoBy
 	r, ok := ap.Info[market]
 	if !ok {
 		r = NewAccountInfoByMarket(market)
+		ap.Info[market] = r
 	}
 
 	return r
@@ -89,6 +90,11 @@ func (ap *AccountProcessor) getAccountInfoByMarket(market string) *AccountInfoBy
 func (ap *AccountProcessor) ProcessChannelResponse(resp *AccountChannelResponse) {
 	// store the update
 	ap.data = append(ap.data, resp)
+	// the subscribed message after reconnect contains the latest account, open positions and active orders.
+	if resp.Type == ChannelResponseTypeReconnected {
+		ap.resetForReconnect()
+		return
+	}
 	// contents
 	contents := resp.Contents
 	if contents == nil {
@@ -114,3 +120,13 @@ func (ap *AccountProcessor) ProcessChannelResponse(resp *AccountChannelResponse)
 		ap.getAccountInfoByMarket(fill.Market).AddFill(fill)
 	}
 }
+
+// resetForReconnect clears the states that will be sent again in the subscribed message.
+// Closed orders, fills and closed positions are kept.
+func (ap *AccountProcessor) resetForReconnect() {
+	ap.Account = nil
+	for _, info := range ap.Info {
+		info.OpenPosition = nil
+		info.ActiveOrders = make(map[string]*Order)
+	}
+}
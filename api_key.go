@@ -55,11 +55,23 @@ func (c *ApiKey) String() string {
 }
 
 // Set reads the file containing the ApiKey, for cobra cli.
+// The file can be the json from the browser or an encrypted keystore (see EncryptKeyStore).
 func (c *ApiKey) Set(filename string) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
+	if IsEncryptedKeyStore(data) {
+		ks, err := DecryptKeyStoreWithPrompt(filename, data)
+		if err != nil {
+			return err
+		}
+		if ks.ApiKey == nil {
+			return fmt.Errorf("keystore %s doesn't contain api key", filename)
+		}
+		*c = *ks.ApiKey
+		return nil
+	}
 	m, err := ParseApiKeyMap(data)
 	if err != nil {
 		return err
@@ -0,0 +1,75 @@
+package dydx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fardream/go-dydx/starkex"
+)
+
+// SetClientAssetRegistry sets the asset registry used to sign orders, for example to share one registry between the clients of the same network.
+// By default each client has its own registry, which falls back to the hard-coded tables until it is loaded or synced,
+// so syncing the registry of a testnet client doesn't change the assets used by the mainnet clients.
+func SetClientAssetRegistry(registry *starkex.AssetRegistry) clientOption {
+	return func(c *Client) {
+		c.assetRegistry = registry
+	}
+}
+
+// UpdateAssetRegistry adds the synthetic assets of the markets into the registry.
+// Markets without synthetic asset id or asset resolution are skipped, which is the case for most of the
+// updates from the markets channel.
+func UpdateAssetRegistry(registry *starkex.AssetRegistry, markets map[string]Market) error {
+	for name, market := range markets {
+		if market.SyntheticAssetID == "" || market.AssetResolution == "" {
+			continue
+		}
+		if market.Market != "" {
+			name = market.Market
+		}
+		if err := registry.SetAsset(name, market.SyntheticAssetID, market.AssetResolution); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadAssetRegistry populates the asset registry of the client with the markets from GetMarkets.
+func (c *Client) LoadAssetRegistry(ctx context.Context) error {
+	markets, err := c.GetMarkets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get markets: %w", err)
+	}
+
+	return UpdateAssetRegistry(c.assetRegistry, markets.Markets)
+}
+
+// SyncAssetRegistry populates the asset registry of the client with GetMarkets, and keeps it fresh by subscribing to the markets channel.
+// It blocks until the context is cancelled or the subscription fails.
+func (c *Client) SyncAssetRegistry(ctx context.Context) error {
+	if err := c.LoadAssetRegistry(ctx); err != nil {
+		return err
+	}
+
+	inner_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	updates := make(chan *MarketsChannelResponse)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(updates)
+		errs <- c.SubscribeMarkets(inner_ctx, updates)
+	}()
+
+	for update := range updates {
+		if update.Contents == nil {
+			continue
+		}
+		if err := UpdateAssetRegistry(c.assetRegistry, *update.Contents); err != nil {
+			log.Warnf("failed to update asset registry: %v", err)
+		}
+	}
+
+	return <-errs
+}
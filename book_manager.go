@@ -0,0 +1,218 @@
+package dydx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BookSnapshot is an immutable copy of the top levels of an order book.
+type BookSnapshot struct {
+	Market string
+	// Bids and Asks are sorted from the best price to the worst price.
+	Bids []*OrderbookOrder
+	Asks []*OrderbookOrder
+	// Offset is the offset of the last applied update, nil if none of the updates has an offset.
+	Offset *int64
+	// UpdatedAt is the time the last update is applied.
+	UpdatedAt time.Time
+}
+
+var _ OrderbookLevels = (*BookSnapshot)(nil)
+
+// IterateBids calls f on the bids from the highest price to the lowest price until f returns false.
+func (s *BookSnapshot) IterateBids(f func(*OrderbookOrder) bool) {
+	for _, v := range s.Bids {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+// IterateAsks calls f on the asks from the lowest price to the highest price until f returns false.
+func (s *BookSnapshot) IterateAsks(f func(*OrderbookOrder) bool) {
+	for _, v := range s.Asks {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+// newBookSnapshot copies the top depth levels of the book.
+func newBookSnapshot(ob *OrderbookProcessor, depth int, updatedAt time.Time) *BookSnapshot {
+	copyLevels := func(levels []*OrderbookOrder) []*OrderbookOrder {
+		result := make([]*OrderbookOrder, 0, len(levels))
+		for _, v := range levels {
+			level := &OrderbookOrder{Price: v.Price, Size: v.Size, PriceString: v.PriceString}
+			if v.Offset != nil {
+				offset := *v.Offset
+				level.Offset = &offset
+			}
+			result = append(result, level)
+		}
+		return result
+	}
+
+	snapshot := &BookSnapshot{
+		Market:    ob.Market,
+		Bids:      copyLevels(ob.Bids.Levels(depth)),
+		Asks:      copyLevels(ob.Asks.Levels(depth)),
+		UpdatedAt: updatedAt,
+	}
+	if offset := ob.Offset(); offset != nil {
+		v := *offset
+		snapshot.Offset = &v
+	}
+	return snapshot
+}
+
+// managedBook is a book maintained by BookManager.
+type managedBook struct {
+	snapshot atomic.Pointer[BookSnapshot]
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// BookManager maintains the order books of many markets, each with a ManagedOrderbook running in its own goroutine.
+//
+// After each update, the top levels of the book are copied into a BookSnapshot, which replaces the previous one atomically.
+// The readers get the latest snapshot without locking the book, and the snapshot is never modified afterwards.
+// The snapshot is cleared when the book is reset after a reconnect, until the book is rebuilt.
+type BookManager struct {
+	api              MarketDataApi
+	depth            int
+	orderbookOptions []managedOrderbookOption
+
+	mutex sync.Mutex
+	books map[string]*managedBook
+}
+
+type bookManagerOption func(b *BookManager)
+
+// SetBookManagerDepth sets the number of levels on each side in the snapshots. Default is 20, and all the levels are copied if depth is negative.
+func SetBookManagerDepth(depth int) bookManagerOption {
+	return func(b *BookManager) {
+		b.depth = depth
+	}
+}
+
+// SetBookManagerOrderbookOptions sets the options of the ManagedOrderbook of each market.
+// The update handler and the reset handler are replaced by the ones of the manager.
+func SetBookManagerOrderbookOptions(options ...managedOrderbookOption) bookManagerOption {
+	return func(b *BookManager) {
+		b.orderbookOptions = options
+	}
+}
+
+// NewBookManager creates a book manager without any market. Use Add to start maintaining the book of a market.
+func NewBookManager(api MarketDataApi, options ...bookManagerOption) *BookManager {
+	b := &BookManager{
+		api:   api,
+		depth: 20,
+		books: make(map[string]*managedBook),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// Add starts maintaining the book of the market until the context is cancelled or the market is removed.
+func (b *BookManager) Add(ctx context.Context, market string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.books[market]; ok {
+		return fmt.Errorf("book of %s is already added", market)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	book := &managedBook{cancel: cancel, done: make(chan struct{})}
+	b.books[market] = book
+
+	options := append(append([]managedOrderbookOption(nil), b.orderbookOptions...),
+		SetManagedOrderbookUpdateHandler(func(ob *OrderbookProcessor) {
+			book.snapshot.Store(newBookSnapshot(ob, b.depth, time.Now()))
+		}),
+		SetManagedOrderbookResetHandler(func() {
+			book.snapshot.Store(nil)
+		}))
+	orderbook := NewManagedOrderbook(b.api, market, options...)
+
+	go func() {
+		defer close(book.done)
+		book.err = orderbook.Run(ctx)
+		if book.err != nil {
+			log.Warnf("book of %s stopped: %v", market, book.err)
+		}
+	}()
+
+	return nil
+}
+
+// Remove stops maintaining the book of the market, and waits for its goroutine to finish.
+func (b *BookManager) Remove(market string) error {
+	b.mutex.Lock()
+	book, ok := b.books[market]
+	delete(b.books, market)
+	b.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("book of %s is not added", market)
+	}
+
+	book.cancel()
+	<-book.done
+	return nil
+}
+
+// Close removes all the markets.
+func (b *BookManager) Close() {
+	for _, market := range b.Markets() {
+		b.Remove(market)
+	}
+}
+
+// Markets returns the sorted markets of the books.
+func (b *BookManager) Markets() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	markets := make([]string, 0, len(b.books))
+	for market := range b.books {
+		markets = append(markets, market)
+	}
+	sort.Strings(markets)
+	return markets
+}
+
+func (b *BookManager) getBook(market string) *managedBook {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.books[market]
+}
+
+// Snapshot returns the latest snapshot of the book of the market.
+// nil if the market is not added, or the book is not initialized yet or being rebuilt after a reconnect.
+func (b *BookManager) Snapshot(market string) *BookSnapshot {
+	book := b.getBook(market)
+	if book == nil {
+		return nil
+	}
+	return book.snapshot.Load()
+}
+
+// Err returns the error that stopped the book of the market, nil if the book is still running.
+func (b *BookManager) Err(market string) error {
+	book := b.getBook(market)
+	if book == nil {
+		return fmt.Errorf("book of %s is not added", market)
+	}
+	select {
+	case <-book.done:
+		return book.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package dydx_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/dydxtest"
+)
+
+func TestBookManager(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const updates = 200
+	fake := &dydxtest.FakeExchange{}
+	fake.SubscribeOrderbookCalls.Stub(func(args dydxtest.SubscribeOrderbookArgs) (struct{}, error) {
+		send := func(resp *dydx.OrderbookChannelResponse) bool {
+			select {
+			case <-args.Ctx.Done():
+				return false
+			case args.OutputChan <- resp:
+				return true
+			}
+		}
+		if !send(&dydx.OrderbookChannelResponse{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe}}) {
+			return struct{}{}, nil
+		}
+		// the bid at 100 is updated to the size of the offset.
+		for offset := int64(2); offset <= updates; offset++ {
+			level := newTestLevel(t, "100", "1", offset)
+			level.Size.SetInt64(offset)
+			if !send(newTestOrderbookUpdate(offset, []*dydx.OrderbookOrder{level}, nil)) {
+				return struct{}{}, nil
+			}
+		}
+		<-args.Ctx.Done()
+		return struct{}{}, nil
+	})
+	fake.GetOrderbookCalls.Stub(func(args dydxtest.GetOrderbookArgs) (*dydx.OrderbookResponse, error) {
+		offset := int64(1)
+		return &dydx.OrderbookResponse{
+			Offset: &offset,
+			Bids:   []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 1), newTestLevel(t, "99", "1", 1), newTestLevel(t, "98", "1", 1)},
+			Asks:   []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 1)},
+		}, nil
+	})
+
+	manager := dydx.NewBookManager(fake, dydx.SetBookManagerDepth(2))
+	defer manager.Close()
+	markets := []string{"BTC-USD", "ETH-USD"}
+	for _, market := range markets {
+		if err := manager.Add(ctx, market); err != nil {
+			t.Fatalf("failed to add %s: %v", market, err)
+		}
+	}
+	if err := manager.Add(ctx, "BTC-USD"); err == nil {
+		t.Fatalf("adding the market twice should fail")
+	}
+
+	// readers check the snapshots are consistent while the books are updated.
+	var wg sync.WaitGroup
+	for _, market := range markets {
+		wg.Add(1)
+		go func(market string) {
+			defer wg.Done()
+			for {
+				snapshot := manager.Snapshot(market)
+				if snapshot == nil {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				if len(snapshot.Bids) != 2 || snapshot.Market != market {
+					t.Errorf("unexpected snapshot: %#v", snapshot)
+					return
+				}
+				if size, _ := snapshot.Bids[0].Size.Int64(); size != *snapshot.Offset {
+					t.Errorf("size %d is not consistent with offset %d", size, *snapshot.Offset)
+					return
+				}
+				if *snapshot.Offset == updates {
+					return
+				}
+				if ctx.Err() != nil {
+					t.Errorf("timed out waiting for %s", market)
+					return
+				}
+			}
+		}(market)
+	}
+	wg.Wait()
+
+	if err := manager.Remove("BTC-USD"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if manager.Snapshot("BTC-USD") != nil || len(manager.Markets()) != 1 {
+		t.Fatalf("market is not removed: %v", manager.Markets())
+	}
+}
+
+func TestBookManagerReconnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reconnect := make(chan struct{})
+	fake := &dydxtest.FakeExchange{}
+	fake.SubscribeOrderbookCalls.Stub(func(args dydxtest.SubscribeOrderbookArgs) (struct{}, error) {
+		for _, resp := range []*dydx.OrderbookChannelResponse{
+			{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe}},
+			nil,
+			{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeReconnected}},
+		} {
+			if resp == nil {
+				select {
+				case <-args.Ctx.Done():
+					return struct{}{}, nil
+				case <-reconnect:
+				}
+				continue
+			}
+			select {
+			case <-args.Ctx.Done():
+				return struct{}{}, nil
+			case args.OutputChan <- resp:
+			}
+		}
+		<-args.Ctx.Done()
+		return struct{}{}, nil
+	})
+	// the snapshot after the reconnect keeps failing.
+	fake.GetOrderbookCalls.ReturnsOnCall(0, &dydx.OrderbookResponse{Bids: []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 1)}}, nil)
+	fake.GetOrderbookCalls.Returns(nil, errors.New("unavailable"))
+
+	manager := dydx.NewBookManager(fake, dydx.SetBookManagerOrderbookOptions(dydx.SetManagedOrderbookRetryInterval(time.Millisecond)))
+	defer manager.Close()
+	if err := manager.Add(ctx, "BTC-USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	for manager.Snapshot("BTC-USD") == nil {
+		if ctx.Err() != nil {
+			t.Fatalf("timed out waiting for the snapshot")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(reconnect)
+	for manager.Snapshot("BTC-USD") != nil {
+		if ctx.Err() != nil {
+			t.Fatalf("snapshot before the reconnect is not cleared")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for fake.GetOrderbookCalls.CallCount() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if manager.Snapshot("BTC-USD") != nil {
+		t.Fatalf("snapshot should stay cleared while the book is rebuilt")
+	}
+}
@@ -0,0 +1,244 @@
+package dydx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrSlowConsumer is the error of a consumer disconnected by SlowConsumerDisconnect.
+var ErrSlowConsumer = errors.New("consumer is too slow")
+
+// SlowConsumerPolicy decides what the Broadcaster does when the buffer of a consumer is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerBlock waits for the consumer, which also holds back all the other consumers.
+	SlowConsumerBlock SlowConsumerPolicy = iota
+	// SlowConsumerDropOldest drops the oldest message in the buffer of the consumer.
+	SlowConsumerDropOldest
+	// SlowConsumerDisconnect closes the consumer with ErrSlowConsumer.
+	SlowConsumerDisconnect
+)
+
+func (p SlowConsumerPolicy) String() string {
+	switch p {
+	case SlowConsumerBlock:
+		return "block"
+	case SlowConsumerDropOldest:
+		return "drop-oldest"
+	case SlowConsumerDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("SlowConsumerPolicy(%d)", int(p))
+	}
+}
+
+// Broadcaster sends the messages of one subscription to many consumers, each with its own buffer and slow consumer policy.
+//
+// Consumers added after the subscription starts only receive the messages from then on. For the orderbook and the account,
+// whose initial states are in the subscribed message, add the consumers before calling Run.
+type Broadcaster[TContents any] struct {
+	mutex     sync.Mutex
+	consumers map[*BroadcastConsumer[TContents]]struct{}
+	finished  bool
+	err       error
+}
+
+// NewBroadcaster creates a broadcaster without consumers.
+func NewBroadcaster[TContents any]() *Broadcaster[TContents] {
+	return &Broadcaster[TContents]{consumers: make(map[*BroadcastConsumer[TContents]]struct{})}
+}
+
+// AddConsumer adds a consumer with a buffer of the size. The consumer is closed right away if the broadcaster has finished.
+// SlowConsumerDropOldest needs a buffer to drop from, its buffer size is at least 1.
+func (b *Broadcaster[TContents]) AddConsumer(bufferSize int, policy SlowConsumerPolicy) *BroadcastConsumer[TContents] {
+	if bufferSize < 0 {
+		bufferSize = 0
+	}
+	if policy == SlowConsumerDropOldest && bufferSize == 0 {
+		bufferSize = 1
+	}
+	c := &BroadcastConsumer[TContents]{
+		broadcaster: b,
+		policy:      policy,
+		ch:          make(chan *ChannelResponse[TContents], bufferSize),
+		done:        make(chan struct{}),
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.finished {
+		c.finish(b.err)
+		return c
+	}
+	b.consumers[c] = struct{}{}
+	return c
+}
+
+func (b *Broadcaster[TContents]) removeConsumer(c *BroadcastConsumer[TContents]) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.consumers, c)
+}
+
+func (b *Broadcaster[TContents]) getConsumers() []*BroadcastConsumer[TContents] {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	consumers := make([]*BroadcastConsumer[TContents], 0, len(b.consumers))
+	for c := range b.consumers {
+		consumers = append(consumers, c)
+	}
+	return consumers
+}
+
+// Run starts the subscription and sends the messages to the consumers until the subscription returns.
+// All the consumers are closed with the error of the subscription afterwards. Run can only be called once.
+//
+// subscribe is usually one of the SubscribeXXX methods of Client or WsConnection, for example
+//
+//	b.Run(ctx, func(ctx context.Context, output chan<- *dydx.TradesChannelResponse) error {
+//		return client.SubscribeTrades(ctx, "BTC-USD", output)
+//	})
+func (b *Broadcaster[TContents]) Run(ctx context.Context, subscribe func(context.Context, chan<- *ChannelResponse[TContents]) error) error {
+	inner_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	outputs := make(chan *ChannelResponse[TContents])
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(outputs)
+		errChan <- subscribe(inner_ctx, outputs)
+	}()
+
+	for resp := range outputs {
+		for _, c := range b.getConsumers() {
+			if !c.send(inner_ctx, resp) {
+				b.removeConsumer(c)
+			}
+		}
+	}
+	err := <-errChan
+
+	b.mutex.Lock()
+	b.finished = true
+	b.err = err
+	consumers := b.consumers
+	b.consumers = nil
+	b.mutex.Unlock()
+
+	for c := range consumers {
+		c.finish(err)
+	}
+
+	return err
+}
+
+// BroadcastConsumer receives the messages from a Broadcaster.
+type BroadcastConsumer[TContents any] struct {
+	broadcaster *Broadcaster[TContents]
+	policy      SlowConsumerPolicy
+	ch          chan *ChannelResponse[TContents]
+	dropped     int64
+
+	// done is closed when the consumer is closed, to stop a blocked send.
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// mutex protects closing ch and err.
+	mutex  sync.Mutex
+	closed bool
+	err    error
+}
+
+// Messages returns the channel of the messages. It is closed after the consumer is closed or disconnected,
+// or the subscription of the broadcaster finishes.
+func (c *BroadcastConsumer[TContents]) Messages() <-chan *ChannelResponse[TContents] {
+	return c.ch
+}
+
+// Dropped returns the number of messages dropped by SlowConsumerDropOldest.
+func (c *BroadcastConsumer[TContents]) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+// Err returns ErrSlowConsumer if the consumer is disconnected for being slow, or the error of the subscription of the broadcaster.
+func (c *BroadcastConsumer[TContents]) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Close removes the consumer from the broadcaster and closes the channel of the messages.
+func (c *BroadcastConsumer[TContents]) Close() {
+	c.finish(nil)
+	c.broadcaster.removeConsumer(c)
+}
+
+// finish closes the consumer with the error, if it is not closed yet.
+func (c *BroadcastConsumer[TContents]) finish(err error) {
+	c.doneOnce.Do(func() { close(c.done) })
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.finishLocked(err)
+}
+
+// finishLocked closes the channel. mutex must be held.
+func (c *BroadcastConsumer[TContents]) finishLocked(err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.err = err
+	close(c.ch)
+}
+
+// send sends the message according to the policy. Returns false if the consumer is closed.
+func (c *BroadcastConsumer[TContents]) send(ctx context.Context, resp *ChannelResponse[TContents]) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	switch c.policy {
+	case SlowConsumerDropOldest:
+		for {
+			select {
+			case c.ch <- resp:
+				return true
+			default:
+			}
+			// the consumer may have taken the message in the mean time, in which case nothing is dropped.
+			select {
+			case <-c.ch:
+				atomic.AddInt64(&c.dropped, 1)
+			default:
+			}
+		}
+
+	case SlowConsumerDisconnect:
+		select {
+		case c.ch <- resp:
+			return true
+		default:
+			c.doneOnce.Do(func() { close(c.done) })
+			c.finishLocked(ErrSlowConsumer)
+			return false
+		}
+
+	default:
+		select {
+		case c.ch <- resp:
+			return true
+		case <-c.done:
+			return false
+		case <-ctx.Done():
+			return true
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package dydx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fardream/go-dydx"
+)
+
+func TestBroadcaster(t *testing.T) {
+	const count = 10
+	subscriptionErr := errors.New("subscription done")
+
+	b := dydx.NewBroadcaster[dydx.TradesChannelResponseContents]()
+	blocking := b.AddConsumer(0, dydx.SlowConsumerBlock)
+	dropping := b.AddConsumer(2, dydx.SlowConsumerDropOldest)
+	// drop oldest without a buffer keeps the latest message.
+	droppingUnbuffered := b.AddConsumer(0, dydx.SlowConsumerDropOldest)
+	disconnecting := b.AddConsumer(2, dydx.SlowConsumerDisconnect)
+	closed := b.AddConsumer(0, dydx.SlowConsumerBlock)
+	closed.Close()
+
+	received := make(chan []int)
+	go func() {
+		var ids []int
+		for v := range blocking.Messages() {
+			ids = append(ids, v.MessageID)
+		}
+		received <- ids
+	}()
+
+	err := b.Run(context.Background(), func(ctx context.Context, output chan<- *dydx.TradesChannelResponse) error {
+		for i := 1; i <= count; i++ {
+			resp := &dydx.TradesChannelResponse{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelData, MessageID: i}}
+			select {
+			case <-ctx.Done():
+				return nil
+			case output <- resp:
+			}
+		}
+		return subscriptionErr
+	})
+	if !errors.Is(err, subscriptionErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := <-received
+	if len(ids) != count || ids[0] != 1 || ids[count-1] != count {
+		t.Fatalf("blocking consumer should receive all messages: %v", ids)
+	}
+	if !errors.Is(blocking.Err(), subscriptionErr) {
+		t.Fatalf("unexpected error of blocking consumer: %v", blocking.Err())
+	}
+
+	var dropped []int
+	for v := range dropping.Messages() {
+		dropped = append(dropped, v.MessageID)
+	}
+	if len(dropped) != 2 || dropped[0] != count-1 || dropped[1] != count || dropping.Dropped() != count-2 {
+		t.Fatalf("dropping consumer should keep the latest messages: %v, dropped %d", dropped, dropping.Dropped())
+	}
+
+	var latest []int
+	for v := range droppingUnbuffered.Messages() {
+		latest = append(latest, v.MessageID)
+	}
+	if len(latest) != 1 || latest[0] != count || droppingUnbuffered.Dropped() != count-1 {
+		t.Fatalf("unbuffered dropping consumer should keep the latest message: %v, dropped %d", latest, droppingUnbuffered.Dropped())
+	}
+
+	var disconnected []int
+	for v := range disconnecting.Messages() {
+		disconnected = append(disconnected, v.MessageID)
+	}
+	if len(disconnected) != 2 || !errors.Is(disconnecting.Err(), dydx.ErrSlowConsumer) {
+		t.Fatalf("slow consumer should be disconnected: %v, %v", disconnected, disconnecting.Err())
+	}
+
+	if _, ok := <-closed.Messages(); ok || closed.Err() != nil {
+		t.Fatalf("closed consumer should not receive messages: %v", closed.Err())
+	}
+
+	late := b.AddConsumer(1, dydx.SlowConsumerBlock)
+	if _, ok := <-late.Messages(); ok || !errors.Is(late.Err(), subscriptionErr) {
+		t.Fatalf("consumer added after the broadcaster finishes should be closed: %v", late.Err())
+	}
+}
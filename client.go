@@ -1,6 +1,11 @@
 package dydx
 
-import "time"
+import (
+	"sync"
+	"time"
+
+	"github.com/fardream/go-dydx/starkex"
+)
 
 type clientOption func(c *Client)
 
@@ -27,23 +32,57 @@ func SetClientTimeout(timeout time.Duration) clientOption {
 	}
 }
 
+// SetClientWsUrl overrides the websocket endpoint.
+func SetClientWsUrl(wsUrl string) clientOption {
+	return func(c *Client) {
+		c.wsUrl = wsUrl
+	}
+}
+
+// SetClientRpcUrl overrides the rest api endpoint.
+func SetClientRpcUrl(rpcUrl string) clientOption {
+	return func(c *Client) {
+		c.rpcUrl = rpcUrl
+	}
+}
+
+// SetClientStarkSigner sets the signer for orders, withdrawals and transfers, replacing the stark key passed to NewClient.
+func SetClientStarkSigner(signer StarkSigner) clientOption {
+	return func(c *Client) {
+		c.starkSigner = signer
+	}
+}
+
 // Client is a struct holding the information necessary to connect to dydx.
 type Client struct {
-	starkKey   *StarkKey
-	apiKey     *ApiKey
-	ethAddress string
+	starkSigner StarkSigner
+	apiKey      *ApiKey
+	ethAddress  string
 
 	wsUrl     string
 	rpcUrl    string
 	networkId int
 
 	timeOut time.Duration
+
+	reconnectPolicy *ReconnectPolicy
+
+	// wsConnection is shared by all the subscriptions of the client.
+	wsConnectionMutex sync.Mutex
+	wsConnection      *WsConnection
+
+	wsConnectionOptions []wsConnectionOption
+
+	assetRegistry *starkex.AssetRegistry
 }
 
 // NewClient creates a new Client, but doesn't connect to the dydx.exchange yet.
 // If only public method is needed, keys and eth addersse can be empty/nil.
 func NewClient(starkKey *StarkKey, apiKey *ApiKey, ethAddress string, isMainnet bool, clientOptions ...clientOption) (*Client, error) {
-	c := &Client{starkKey: starkKey, apiKey: apiKey, ethAddress: ethAddress, timeOut: time.Second * 15}
+	c := &Client{apiKey: apiKey, ethAddress: ethAddress, timeOut: time.Second * 15, assetRegistry: starkex.NewAssetRegistry()}
+	if starkKey != nil {
+		c.starkSigner = starkKey
+	}
 
 	SetClientEndpoint(isMainnet)(c)
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"time"
 
@@ -49,34 +50,54 @@ func NewCreateOrderRequest(market string, side OrderSide, order_type OrderType,
 	}
 }
 
+// NewOrderSignParam returns the parameters used to generate the stark signature for the order.
+func (c *Client) NewOrderSignParam(order *CreateOrderRequest, positionId int64) starkex.OrderSignParam {
+	return starkex.OrderSignParam{
+		NetworkId:  c.networkId,
+		Market:     order.Market,
+		Side:       string(order.Side),
+		PositionId: positionId,
+		HumanSize:  order.Size.String(),
+		HumanPrice: order.Price.String(),
+		LimitFee:   order.LimitFee.String(),
+		ClientId:   order.ClientId,
+		Expiration: GetIsoDateStr(order.Expiration),
+	}
+}
+
+// GetOrderHash returns the message hash of the order that needs to be signed by the stark private key.
+// This can be used to sign the order offline or with an external signer, and the signature can be attached with
+// CreateOrderRequest.SetSignature.
+func (c *Client) GetOrderHash(order *CreateOrderRequest, positionId int64) (*big.Int, error) {
+	if order == nil {
+		return nil, fmt.Errorf("order is null")
+	}
+
+	return c.assetRegistry.GetOrderHash(c.NewOrderSignParam(order, positionId))
+}
+
+// SetSignature sets the signature of the order from an externally produced (r, s) pair.
+// NewOrder will not sign the order again if the signature is already set.
+func (o *CreateOrderRequest) SetSignature(r, s *big.Int) {
+	o.Signature = starkex.SerializeSignature(r, s)
+}
+
 func (c *Client) NewOrder(ctx context.Context, order *CreateOrderRequest, positionId int64) (*CreateOrderResponse, error) {
 	if order == nil {
 		return nil, fmt.Errorf("order is null")
 	}
 
 	if len(order.Signature) == 0 {
-		if c.starkKey == nil {
-			return nil, fmt.Errorf("stark key is nil")
-		}
-		if len(c.starkKey.PrivateKey) == 0 {
-			return nil, fmt.Errorf("start key is empty")
-		}
-
-		order_sign_params := starkex.OrderSignParam{
-			NetworkId:  c.networkId,
-			Market:     order.Market,
-			Side:       string(order.Side),
-			PositionId: positionId,
-			HumanSize:  order.Size.String(),
-			HumanPrice: order.Price.String(),
-			LimitFee:   order.LimitFee.String(),
-			ClientId:   order.ClientId,
-			Expiration: GetIsoDateStr(order.Expiration),
-		}
+		order_sign_params := c.NewOrderSignParam(order, positionId)
 
 		log.Debugf("sign order: %#v", order_sign_params)
 
-		sign, err := starkex.OrderSign(c.starkKey.PrivateKey, order_sign_params)
+		msgHash, err := c.assetRegistry.GetOrderHash(order_sign_params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order hash: %w", err)
+		}
+
+		sign, err := c.signStarkHash(ctx, msgHash)
 		if err != nil {
 			return nil, fmt.Errorf("failed to sign order: %w", err)
 		}
@@ -1,9 +1,37 @@
 package dydx
 
-import "github.com/fardream/decimal"
+import (
+	"github.com/cockroachdb/apd/v3"
+	"github.com/fardream/decimal"
+)
 
 type Decimal = decimal.Decimal
 
 func NewDecimalFromString(s string) (*Decimal, error) {
 	return decimal.NewFromString(s)
 }
+
+// divContext rounds the quotient to 34 digits like decimal128.
+var divContext = apd.BaseContext.WithPrecision(34)
+
+// divDecimal divides a by b. Unlike Decimal.Div, an inexact quotient is rounded instead of panicking.
+// b must not be zero.
+func divDecimal(a, b *Decimal) *Decimal {
+	var r Decimal
+	if _, err := divContext.Quo(&r.Decimal, &a.Decimal, &b.Decimal); err != nil {
+		panic(err)
+	}
+	r.Reduce(&r.Decimal)
+	return &r
+}
+
+// decimalLess returns a < b.
+// Decimal.LessThan is not used because it is the same as Decimal.GreaterThan in github.com/fardream/decimal v1.0.5.
+func decimalLess(a, b *Decimal) bool {
+	return a.Cmp(&b.Decimal) < 0
+}
+
+// decimalGreater returns a > b.
+func decimalGreater(a, b *Decimal) bool {
+	return a.Cmp(&b.Decimal) > 0
+}
@@ -67,7 +67,7 @@ func getOnboardingTypedData(isMainnet bool, action string) apitypes.TypedData {
 //
 // - sign the typed data for key derivation.
 //
-// - append 0 to the signature.
+// - append the signature type to the signature (0 for SignatureTypeNoPrepend).
 //
 // - crypto.keccak hash the signature bytes.
 // in python implementation, it convert the siganture to a big int.
@@ -83,16 +83,16 @@ func getOnboardingTypedData(isMainnet bool, action string) apitypes.TypedData {
 //
 // - convert private key, x, y into hex encoded strings (without the 0x).
 //
-// Function requires a signer to sign typed data
-func DeriveStarkKey(signer SignTypedData, isMainnet bool) (*StarkKey, error) {
+// Function requires a signer to sign typed data. The signature type must be the same one used when the account is onboarded,
+// wallets that only support personal_sign are usually onboarded with SignatureTypePersonal.
+func DeriveStarkKey(signer SignTypedData, isMainnet bool, signatureType SignatureType) (*StarkKey, error) {
 	msg := getOnboardingTypedData(isMainnet, keyDerivationAction)
 
-	signature, err := signer.EthSignTypedData(msg)
+	// signature type is appended to the signature.
+	signature, err := SignTypedDataWithType(signer, msg, signatureType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign typed data %#v: %w", msg, err)
+		return nil, err
 	}
-	// here must append an extra byte of 0 (SIGNATURE_TYPE_NO_PREPEND)
-	signature = append(signature, byte(0))
 
 	// hash with all the bytes
 	hashedSignature := hexutil.Encode(crypto.Keccak256(signature))
@@ -117,14 +117,14 @@ func DeriveStarkKey(signer SignTypedData, isMainnet bool) (*StarkKey, error) {
 //
 // Implementation is a carbon-copy of the code in python version of official dydx client:
 // https://github.com/dydxprotocol/dydx-v3-python/blob/914fc66e542d82080702e03f6ad078ca2901bb46/dydx3/modules/onboarding.py#L147-L184
-func RecoverDefaultApiKeyCredentials(signer SignTypedData, isMainnet bool) (*ApiKey, error) {
+//
+// The signature type must be the same one used when the account is onboarded.
+func RecoverDefaultApiKeyCredentials(signer SignTypedData, isMainnet bool, signatureType SignatureType) (*ApiKey, error) {
 	msg := getOnboardingTypedData(isMainnet, onboardingAction)
-	signature_raw, err := signer.EthSignTypedData(msg)
+	signature_raw, err := SignTypedDataWithType(signer, msg, signatureType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign typed data %#v: %w", msg, err)
+		return nil, err
 	}
-	// here must append an extra byte of 0 (SIGNATURE_TYPE_NO_PREPEND)
-	signature_raw = append(signature_raw, 0)
 
 	// Python will convert signature into hex, the convert the values into big int, and then hash that bytes of the big int.
 	// we simply use the raw bytes in signature_raw.
@@ -33,7 +33,7 @@ func TestDeriveStarkKey(t *testing.T) {
 		"3c6ce687a484ac1c50a48498092832957a3154c7c13237bc10df6965472e009",
 	)
 
-	stark_key_testnet, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(privateKey), false)
+	stark_key_testnet, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(privateKey), false, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		t.Fatalf("failed to derive stark key: %v", err)
 	}
@@ -49,7 +49,7 @@ func TestDeriveStarkKey(t *testing.T) {
 		"1b480e13db79d66cc62dba6dc64536fa3242531a0c840add19cf1a04dd77866",
 	)
 
-	stark_key_mainnet, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(privateKey), true)
+	stark_key_mainnet, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(privateKey), true, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		t.Fatalf("failed to derive stark key: %v", err)
 	}
@@ -61,7 +61,7 @@ func TestDeriveStarkKey(t *testing.T) {
 }
 
 func TestRecoverDefaultApiCredentials(t *testing.T) {
-	api_key_mainnet, err := dydx.RecoverDefaultApiKeyCredentials(dydx.NewEcdsaPrivateKeySigner(privateKey), true)
+	api_key_mainnet, err := dydx.RecoverDefaultApiKeyCredentials(dydx.NewEcdsaPrivateKeySigner(privateKey), true, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		t.Fatalf("failed to recover api keys: %#v", err)
 	}
@@ -71,7 +71,7 @@ func TestRecoverDefaultApiCredentials(t *testing.T) {
 		t.Fatalf("default implementation: %s is different from golang implementation: %s", spewConfig.Sdump(api_key_mainnet_python), spewConfig.Sdump(api_key_mainnet))
 	}
 
-	api_key_testnet, err := dydx.RecoverDefaultApiKeyCredentials(dydx.NewEcdsaPrivateKeySigner(privateKey), false)
+	api_key_testnet, err := dydx.RecoverDefaultApiKeyCredentials(dydx.NewEcdsaPrivateKeySigner(privateKey), false, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		t.Fatalf("failed to recover api keys: %#v", err)
 	}
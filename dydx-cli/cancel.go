@@ -36,7 +36,7 @@ func newCancelCmd() *cancelCmd {
 }
 
 func (c *cancelCmd) do(*cobra.Command, []string) {
-	client := getOrPanic(dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), c.ethAddress, c.isMainnet))
+	client := getOrPanic(dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), getOrPanic(c.getEthAddress()), c.isMainnet))
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 	defer cancel()
 	switch {
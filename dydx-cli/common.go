@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
@@ -16,32 +16,181 @@ import (
 )
 
 type commonFields struct {
-	isMainnet  bool
-	starkKey   dydx.StarkKey
-	apiKey     dydx.ApiKey
-	ethAddress string
-	timeout    duration
+	isMainnet    bool
+	starkKey     dydx.StarkKey
+	apiKey       dydx.ApiKey
+	starkKeyFile keyFileFlag
+	apiKeyFile   keyFileFlag
+	ethAddress   string
+	timeout      duration
+
+	// keyStorePassphrase is the passphrase that decrypted a keystore of --stark or --api,
+	// so a keystore containing both keys is only prompted once.
+	keyStorePassphrase *string
+}
+
+// decryptKeyStore decrypts the keystore with the cached passphrase, or prompts for it.
+func (c *commonFields) decryptKeyStore(filename string, data []byte) (*dydx.KeyStore, error) {
+	if c.keyStorePassphrase != nil {
+		if ks, err := dydx.DecryptKeyStore(data, *c.keyStorePassphrase); err == nil {
+			return ks, nil
+		}
+	}
+
+	passphrase, err := dydx.GetKeyStorePassphrase(fmt.Sprintf("passphrase for %s: ", filename))
+	if err != nil {
+		return nil, err
+	}
+	ks, err := dydx.DecryptKeyStore(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	c.keyStorePassphrase = &passphrase
+
+	return ks, nil
+}
+
+// keyFileFlag sets the key from the file, and keeps the file name.
+// Encrypted keystores are decrypted by decryptKeyStore and the key is taken by fromKeyStore.
+type keyFileFlag struct {
+	key interface {
+		Set(string) error
+		String() string
+		Type() string
+	}
+	decryptKeyStore func(filename string, data []byte) (*dydx.KeyStore, error)
+	fromKeyStore    func(filename string, ks *dydx.KeyStore) error
+	filename        string
+}
+
+func (f *keyFileFlag) Set(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if !dydx.IsEncryptedKeyStore(data) {
+		if err := f.key.Set(filename); err != nil {
+			return err
+		}
+		f.filename = filename
+		return nil
+	}
+
+	ks, err := f.decryptKeyStore(filename, data)
+	if err != nil {
+		return err
+	}
+	if err := f.fromKeyStore(filename, ks); err != nil {
+		return err
+	}
+	f.filename = filename
+	return nil
+}
+
+func (f *keyFileFlag) String() string {
+	return f.key.String()
+}
+
+func (f *keyFileFlag) Type() string {
+	return f.key.Type()
+}
+
+// setupKeyFlags adds --stark, --api and --eth-address.
+func (cmn *commonFields) setupKeyFlags(c *cobra.Command) {
+	cmn.starkKeyFile.key = &cmn.starkKey
+	cmn.starkKeyFile.decryptKeyStore = cmn.decryptKeyStore
+	cmn.starkKeyFile.fromKeyStore = func(filename string, ks *dydx.KeyStore) error {
+		if ks.StarkKey == nil {
+			return fmt.Errorf("keystore %s doesn't contain stark key", filename)
+		}
+		cmn.starkKey = *ks.StarkKey
+		return nil
+	}
+	cmn.apiKeyFile.key = &cmn.apiKey
+	cmn.apiKeyFile.decryptKeyStore = cmn.decryptKeyStore
+	cmn.apiKeyFile.fromKeyStore = func(filename string, ks *dydx.KeyStore) error {
+		if ks.ApiKey == nil {
+			return fmt.Errorf("keystore %s doesn't contain api key", filename)
+		}
+		cmn.apiKey = *ks.ApiKey
+		return nil
+	}
+	c.PersistentFlags().Var(&cmn.starkKeyFile, "stark", "path to stark key (json from browser or encrypted keystore)")
+	c.PersistentFlags().Var(&cmn.apiKeyFile, "api", "path to api key (json from browser or encrypted keystore)")
+	c.PersistentFlags().StringVar(&cmn.ethAddress, "eth-address", "", "eth address, can be omitted if the keystore of --stark or --api contains it")
+
+	c.MarkPersistentFlagFilename("stark")
+	c.MarkPersistentFlagFilename("api")
 }
 
 func (cmn *commonFields) setupCommonFields(c *cobra.Command) {
 	c.PersistentFlags().BoolVar(&cmn.isMainnet, "mainnet", false, "turn on mainnet endpoint")
-	c.PersistentFlags().Var(&cmn.starkKey, "stark", "path to stark key")
-	c.PersistentFlags().Var(&cmn.apiKey, "api", "path to api key")
-	c.PersistentFlags().StringVar(&cmn.ethAddress, "eth-address", "", "eth address")
+	cmn.setupKeyFlags(c)
 
 	cmn.timeout = duration(time.Second * 15)
 	c.PersistentFlags().Var(&cmn.timeout, "time-out", "time out for all requests")
 
-	c.MarkPersistentFlagRequired("eth-address")
 	c.MarkPersistentFlagRequired("stark")
 	c.MarkPersistentFlagRequired("api")
+}
 
-	c.MarkPersistentFlagFilename("stark")
-	c.MarkPersistentFlagFilename("api")
+// getEthAddress returns --eth-address, or the eth address in the keystore of --stark or --api.
+func (c *commonFields) getEthAddress() (string, error) {
+	if c.ethAddress != "" {
+		return c.ethAddress, nil
+	}
+	for _, filename := range []string{c.starkKeyFile.filename, c.apiKeyFile.filename} {
+		if filename == "" {
+			continue
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		if !dydx.IsEncryptedKeyStore(data) {
+			continue
+		}
+		// the eth address is saved in plain text next to the encrypted keys.
+		var ks struct {
+			EthAddress string `json:"ethAddress"`
+		}
+		if err := json.Unmarshal(data, &ks); err != nil {
+			return "", err
+		}
+		if ks.EthAddress != "" {
+			return ks.EthAddress, nil
+		}
+	}
+	return "", fmt.Errorf("--eth-address is required unless the keystore of --stark or --api contains the eth address")
 }
 
 func (c *commonFields) getDydxClient() (*dydx.Client, error) {
-	return dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), c.ethAddress, c.isMainnet)
+	ethAddress, err := c.getEthAddress()
+	if err != nil {
+		return nil, err
+	}
+	return dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), ethAddress, c.isMainnet)
+}
+
+type reconnectFields struct {
+	noReconnect          bool
+	maxReconnectAttempts int
+	staleTimeout         duration
+}
+
+func (r *reconnectFields) setupReconnectFields(c *cobra.Command) {
+	c.PersistentFlags().BoolVar(&r.noReconnect, "no-reconnect", false, "don't reconnect the subscription after the connection is lost")
+	c.PersistentFlags().IntVar(&r.maxReconnectAttempts, "max-reconnect-attempts", 0, "consecutive reconnect attempts before giving up, 0 to retry forever")
+	c.PersistentFlags().Var(&r.staleTimeout, "stale-timeout", "resubscribe if nothing is received for the subscription in this period, and quit if it is still quiet after that, 0 to disable")
+}
+
+func (r *reconnectFields) getReconnectPolicy() *dydx.ReconnectPolicy {
+	if r.noReconnect {
+		return nil
+	}
+	policy := dydx.NewDefaultReconnectPolicy()
+	policy.MaxAttempts = r.maxReconnectAttempts
+	return policy
 }
 
 type orderIds struct {
@@ -73,6 +222,12 @@ func printOrPanic(input any) {
 }
 
 func defaultLoopPrinter[T any](v *dydx.ChannelResponse[T]) {
+	for _, contents := range v.BatchContents {
+		printOrPanic(contents)
+	}
+	if v.Contents == nil {
+		return
+	}
 	printOrPanic(v.Contents)
 }
 
@@ -80,25 +235,37 @@ func runLoop[T any](sub func(context.Context, chan<- *dydx.ChannelResponse[T]) e
 	timeout_ctx, timeout_cancel := context.WithTimeout(context.Background(), length)
 	defer timeout_cancel()
 
-	var wg sync.WaitGroup
-	defer wg.Wait()
-
 	ctx, cancel := signal.NotifyContext(timeout_ctx, syscall.SIGINT)
 	defer cancel()
 
-	wg.Add(1)
-	outputs := make(chan *dydx.ChannelResponse[T])
-	go func() {
-		defer wg.Done()
-		defer close(outputs)
-		orPanic(sub(ctx, outputs))
-	}()
-
-sigloop:
-	for v := range outputs {
-		if v.Contents == nil {
-			continue sigloop
-		}
-		printer(v)
+	handler := &dydx.SubscriptionHandlerFuncs[T]{
+		Subscribed: printer,
+		Data: func(v *dydx.ChannelResponse[T]) {
+			switch v.Type {
+			case dydx.ChannelResponseTypeStale:
+				log.Printf("%s %s is stale: %s", v.Channel, v.Id, v.Message)
+				return
+			case dydx.ChannelResponseTypeGap:
+				log.Printf("%s %s may have missed messages: %s", v.Channel, v.Id, v.Message)
+				return
+			}
+			if !v.HasContents() {
+				return
+			}
+			printer(v)
+		},
+		Reconnect: func(v *dydx.ChannelResponse[T]) {
+			log.Printf("reconnected to %s %s", v.Channel, v.Id)
+			printer(v)
+		},
+	}
+
+	s, err := dydx.StartSubscription[T](ctx, sub, handler)
+	if err != nil && ctx.Err() != nil {
+		return
 	}
+	orPanic(err)
+
+	<-s.Done()
+	orPanic(s.Err())
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/feedcodec"
+	"github.com/spf13/cobra"
+)
+
+type convertFeedCmd struct {
+	*cobra.Command
+
+	isMainnet bool
+	timeout   duration
+	market    string
+	channel   string
+	tickSize  *dydx.Decimal
+	stepSize  *dydx.Decimal
+}
+
+func newConvertFeedCmd() *convertFeedCmd {
+	c := &convertFeedCmd{
+		Command: &cobra.Command{
+			Use:   "convert-feed input output",
+			Short: "convert orderbook/trades updates between json and the compact binary format",
+			Long: `convert orderbook/trades updates between json and the compact binary format.
+
+- a binary input is converted to json lines in the format of the recording of --record-dir.
+- a json input (json array, json lines, or the recording of --record-dir) is converted to binary.
+  the tick size and step size of the market are fetched from the rest api unless both --tick-size and --step-size are set.
+`,
+			Args: cobra.ExactArgs(2),
+		},
+		timeout:  duration(time.Second * 15),
+		tickSize: &dydx.Decimal{},
+		stepSize: &dydx.Decimal{},
+	}
+
+	c.Flags().BoolVar(&c.isMainnet, "mainnet", false, "set to use the mainnet to fetch the market")
+	c.Flags().Var(&c.timeout, "time-out", "time out for all requests.")
+	c.Flags().StringVarP(&c.market, "market", "m", "", "market of the updates, required for json input")
+	c.Flags().StringVar(&c.channel, "channel", "orderbook", "channel of the updates for json input: orderbook or trades")
+	c.Flags().Var(c.tickSize, "tick-size", "tick size of the market")
+	c.Flags().Var(c.stepSize, "step-size", "step size of the market")
+
+	c.Run = c.do
+
+	return c
+}
+
+// getHeader returns the header of the binary output.
+func (c *convertFeedCmd) getHeader() (*feedcodec.Header, error) {
+	if c.market == "" {
+		return nil, fmt.Errorf("market is required for json input")
+	}
+	header := &feedcodec.Header{Market: c.market, TickSize: c.tickSize, StepSize: c.stepSize}
+	switch c.channel {
+	case "orderbook":
+		header.Channel = dydx.OrderbookChannel
+	case "trades":
+		header.Channel = dydx.TradesChannel
+	default:
+		return nil, fmt.Errorf("unknown channel: %s", c.channel)
+	}
+
+	if c.Flags().Changed("tick-size") && c.Flags().Changed("step-size") {
+		return header, nil
+	}
+
+	client, err := dydx.NewClient(nil, nil, "", c.isMainnet)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
+	defer cancel()
+	markets, err := client.GetMarkets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	market, ok := markets.Markets[c.market]
+	if !ok {
+		return nil, fmt.Errorf("market %s is not found", c.market)
+	}
+	if !c.Flags().Changed("tick-size") {
+		header.TickSize = market.TickSize
+	}
+	if !c.Flags().Changed("step-size") {
+		header.StepSize = market.StepSize
+	}
+	return header, nil
+}
+
+func (c *convertFeedCmd) do(_ *cobra.Command, args []string) {
+	input := getOrPanic(os.Open(args[0]))
+	defer input.Close()
+	reader := bufio.NewReader(input)
+	isBinary := feedcodec.IsBinaryFeed(reader)
+
+	var header *feedcodec.Header
+	if !isBinary {
+		header = getOrPanic(c.getHeader())
+	}
+
+	output := getOrPanic(os.Create(args[1]))
+	defer func() { orPanic(output.Close()) }()
+
+	if isBinary {
+		n := getOrPanic(feedcodec.ToJson(output, reader))
+		log.Printf("converted %d updates to json", n)
+	} else {
+		n := getOrPanic(feedcodec.FromJson(output, reader, header))
+		log.Printf("converted %d updates of %s to binary with tick size %s and step size %s", n, header.Market, header.TickSize, header.StepSize)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fardream/go-dydx"
+	"github.com/spf13/cobra"
+)
+
+type keystoreCmd struct {
+	*cobra.Command
+	*commonFields
+
+	outputFile string
+	light      bool
+}
+
+func newKeystoreCmd() *keystoreCmd {
+	c := &keystoreCmd{
+		Command: &cobra.Command{
+			Use:   "keystore",
+			Short: "encrypt stark key, api key and eth address into a keystore",
+			Long: fmt.Sprintf(`encrypt stark key, api key and eth address into a keystore.
+
+The keystore can be used for --stark and --api flags, and its eth address is used when --eth-address is not set.
+Only the keys passed are stored.
+The passphrase is read from environment variable %s, or prompted if the variable is not set.
+`, dydx.KeyStorePassphraseEnv),
+		},
+		commonFields: &commonFields{},
+	}
+
+	c.setupKeyFlags(c.Command)
+	c.Flags().StringVarP(&c.outputFile, "out", "o", "", "output keystore file")
+	c.MarkFlagRequired("out")
+	c.MarkFlagFilename("out", "json")
+	c.Flags().BoolVar(&c.light, "light", false, "use light scrypt parameters (less secure, but faster)")
+
+	c.Run = c.do
+
+	return c
+}
+
+func (c *keystoreCmd) do(*cobra.Command, []string) {
+	ks := &dydx.KeyStore{EthAddress: c.ethAddress}
+	if c.starkKeyFile.filename != "" {
+		ks.StarkKey = &c.starkKey
+	}
+	if c.apiKeyFile.filename != "" {
+		ks.ApiKey = &c.apiKey
+	}
+	if ks.StarkKey == nil && ks.ApiKey == nil && ks.EthAddress == "" {
+		orPanic(fmt.Errorf("at least one of --stark, --api and --eth-address is required"))
+	}
+
+	passphrase := getOrPanic(dydx.GetKeyStorePassphrase("new passphrase: "))
+	if _, ok := os.LookupEnv(dydx.KeyStorePassphraseEnv); !ok {
+		if getOrPanic(dydx.GetKeyStorePassphrase("repeat passphrase: ")) != passphrase {
+			orPanic(fmt.Errorf("passphrases don't match"))
+		}
+	}
+
+	scryptN, scryptP := dydx.StandardScryptN, dydx.StandardScryptP
+	if c.light {
+		scryptN, scryptP = dydx.LightScryptN, dydx.LightScryptP
+	}
+
+	data := getOrPanic(dydx.EncryptKeyStore(ks, passphrase, scryptN, scryptP))
+	orPanic(os.WriteFile(c.outputFile, data, 0o600))
+}
@@ -18,6 +18,7 @@ type lsPrivateCmd struct {
 
 	subaccount bool // for account
 	sublength  duration
+	reconnectFields
 
 	orders       *cobra.Command
 	activeOrders *cobra.Command
@@ -62,6 +63,7 @@ func newLsPrivateCmd() *lsPrivateCmd {
 	c.accounts.Flags().BoolVarP(&c.subaccount, "sub", "s", false, "subscribe to the account feed")
 	c.sublength = duration(time.Hour * 24)
 	c.accounts.Flags().Var(&c.sublength, "sub-length", "subscribe length")
+	c.setupReconnectFields(c.accounts)
 	c.accounts.Run = c.doAccounts
 
 	c.setupOrderIds(c.orders)
@@ -103,14 +105,14 @@ func (c *lsPrivateCmd) doActiveOrders(*cobra.Command, []string) {
 }
 
 func (c *lsPrivateCmd) doAccounts(*cobra.Command, []string) {
-	client := getOrPanic(c.getDydxClient())
+	client := getOrPanic(dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), getOrPanic(c.getEthAddress()), c.isMainnet, dydx.SetClientReconnectPolicy(c.getReconnectPolicy())))
 	if !c.subaccount {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 		defer cancel()
 		printOrPanic(getOrPanic(client.GetAccounts(ctx)).Accounts)
 	} else {
 		runLoop(func(ctx context.Context, outputs chan<- *dydx.AccountChannelResponse) error {
-			return client.SubscribeAccount(ctx, 0, outputs)
+			return client.SubscribeAccount(ctx, 0, outputs, dydx.SetSubscriptionStaleTimeout(time.Duration(c.staleTimeout)))
 		}, time.Duration(c.sublength), defaultLoopPrinter[dydx.AccountChannelResponseContents])
 	}
 }
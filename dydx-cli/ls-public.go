@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -14,13 +14,17 @@ import (
 
 type lsPublicCmd struct {
 	*cobra.Command
-	isMainnet    bool
-	market       string
-	sub          bool
-	timeout      duration
-	sublength    duration
-	orderbookTop bool
-	outputFile   string
+	isMainnet     bool
+	market        string
+	sub           bool
+	timeout       duration
+	sublength     duration
+	orderbookTop  bool
+	resyncCrossed bool
+	outputFile    string
+	batched       bool
+	recordDir     string
+	reconnectFields
 
 	orderbook *cobra.Command
 	markets   *cobra.Command
@@ -36,7 +40,7 @@ func newLsPublicCmd() *lsPublicCmd {
 
 - Use Ctrl-C to cancel the subscription.
 - After the time period has elapsed, the subscription will stop.
-- Will **NOT** reconnect.
+- Will reconnect with exponential backoff after the connection is lost, unless --no-reconnect is set.
 `,
 		},
 		orderbook: &cobra.Command{
@@ -60,12 +64,22 @@ func newLsPublicCmd() *lsPublicCmd {
 	c.timeout = duration(time.Second * 15)
 	c.PersistentFlags().Var(&c.timeout, "time-out", "time out for all requests.")
 
+	c.setupReconnectFields(c.Command)
+
+	c.PersistentFlags().StringVar(&c.recordDir, "record-dir", "", "record the raw websocket messages into hourly files in the directory")
+	c.MarkPersistentFlagDirname("record-dir")
+
 	c.sublength = duration(time.Hour * 24)
 	c.Flags().Var(&c.sublength, "subscribe-length", "how long to subscribe to")
 
 	c.orderbook.Flags().BoolVar(&c.orderbookTop, "top", false, "show order book top instead of the data")
-	c.orderbook.Flags().StringVarP(&c.outputFile, "out", "o", "", "dump messages for orderbook into a directory")
-	c.orderbook.MarkFlagFilename("out", "json")
+	c.orderbook.Flags().BoolVar(&c.resyncCrossed, "resync-crossed", false, "with --top, fetch the order book from the rest api when the book is crossed")
+	c.orderbook.Flags().StringVarP(&c.outputFile, "out", "o", "", "with --top, write the orderbook messages into the file as json lines")
+	c.orderbook.MarkFlagFilename("out", "jsonl")
+
+	for _, cmd := range []*cobra.Command{c.orderbook, c.trades} {
+		cmd.Flags().BoolVar(&c.batched, "batched", false, "subscribe to batched updates")
+	}
 
 	c.orderbook.Run = c.doOrderbook
 	c.markets.Run = c.doMarkets
@@ -76,12 +90,22 @@ func newLsPublicCmd() *lsPublicCmd {
 	return c
 }
 
+// getRecorder returns the writer for the recorded messages and the function to close it.
+// The writer is nil if --record-dir is not set.
+func (c *lsPublicCmd) getRecorder(name string) (io.Writer, func()) {
+	if c.recordDir == "" {
+		return nil, func() {}
+	}
+	w := getOrPanic(dydx.NewRotatingFileWriter(c.recordDir, name, 0, time.Hour))
+	return w, func() { orPanic(w.Close()) }
+}
+
 func (c *lsPublicCmd) doOrderbook(*cobra.Command, []string) {
 	if c.market == "" {
 		orPanic(fmt.Errorf("market is required for orderbook request"))
 	}
 
-	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet))
+	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet, dydx.SetClientReconnectPolicy(c.getReconnectPolicy())))
 	if !c.sub {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 		defer cancel()
@@ -90,7 +114,29 @@ func (c *lsPublicCmd) doOrderbook(*cobra.Command, []string) {
 		printer := defaultLoopPrinter[dydx.OrderbookChannelResponseContents]
 		var ob *dydx.OrderbookProcessor
 		if c.orderbookTop {
-			ob = dydx.NewOrderbookProcessor(c.market, false)
+			var resync func(string) (*dydx.OrderbookResponse, error)
+			if c.resyncCrossed {
+				resync = func(market string) (*dydx.OrderbookResponse, error) {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
+					defer cancel()
+					return client.GetOrderbook(ctx, market)
+				}
+			}
+			// the updates are written to the output file as they arrive.
+			var sink dydx.UpdateSink[*dydx.OrderbookChannelResponse] = dydx.DiscardSink[*dydx.OrderbookChannelResponse]{}
+			if c.outputFile != "" {
+				outputFile := getOrPanic(os.Create(c.outputFile))
+				defer func() { orPanic(outputFile.Close()) }()
+				jsonLinesSink := dydx.NewJsonLinesSink[*dydx.OrderbookChannelResponse](outputFile)
+				defer func() { orPanic(jsonLinesSink.Err()) }()
+				sink = jsonLinesSink
+			}
+			ob = dydx.NewOrderbookProcessor(c.market, true,
+				dydx.SetOrderbookProcessorSink(sink),
+				dydx.SetOrderbookProcessorCrossedBookHandler(func(e *dydx.CrossedBookEvent) {
+					log.Printf("crossed book: bid $%s ask $%s, dropped %d bids %d asks, resynced: %t", e.Bid.PriceString, e.Ask.PriceString, len(e.DroppedBids), len(e.DroppedAsks), e.Resynced)
+				}),
+				dydx.SetOrderbookProcessorResync(resync))
 			printer = func(v *dydx.OrderbookChannelResponse) {
 				ob.Process(v)
 				bid, ask := ob.BookTop()
@@ -105,37 +151,40 @@ func (c *lsPublicCmd) doOrderbook(*cobra.Command, []string) {
 				log.Printf("%s || %s", bidstr, askstr)
 			}
 		}
+		recorder, closeRecorder := c.getRecorder("orderbook-" + c.market)
+		defer closeRecorder()
 		runLoop(func(ctx context.Context, outputs chan<- *dydx.OrderbookChannelResponse) error {
-			return client.SubscribeOrderbook(ctx, c.market, outputs)
+			return client.SubscribeOrderbook(ctx, c.market, outputs, dydx.SetSubscriptionStaleTimeout(time.Duration(c.staleTimeout)), dydx.SetSubscriptionBatched(c.batched), dydx.SetSubscriptionRecorder(recorder))
 		}, time.Duration(c.sublength), printer)
-		if ob != nil && c.outputFile != "" {
-			os.WriteFile(c.outputFile, getOrPanic(json.Marshal(ob.Data)), 0o666)
-		}
 	}
 }
 
 func (c *lsPublicCmd) doMarkets(*cobra.Command, []string) {
-	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet))
+	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet, dydx.SetClientReconnectPolicy(c.getReconnectPolicy())))
 	if !c.sub {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 		defer cancel()
 		printOrPanic(getOrPanic(client.GetMarkets(ctx)))
 	} else {
+		recorder, closeRecorder := c.getRecorder("markets")
+		defer closeRecorder()
 		runLoop(func(ctx context.Context, outputs chan<- *dydx.MarketsChannelResponse) error {
-			return client.SubscribeMarkets(ctx, outputs)
+			return client.SubscribeMarkets(ctx, outputs, dydx.SetSubscriptionStaleTimeout(time.Duration(c.staleTimeout)), dydx.SetSubscriptionRecorder(recorder))
 		}, time.Duration(c.sublength), defaultLoopPrinter[dydx.MarketsChannelResponseContents])
 	}
 }
 
 func (c *lsPublicCmd) doTrades(*cobra.Command, []string) {
-	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet))
+	client := getOrPanic(dydx.NewClient(nil, nil, "", c.isMainnet, dydx.SetClientReconnectPolicy(c.getReconnectPolicy())))
 	if !c.sub {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 		defer cancel()
 		printOrPanic(getOrPanic(client.GetTrades(ctx, &dydx.TradesParam{MarketID: c.market})))
 	} else {
+		recorder, closeRecorder := c.getRecorder("trades-" + c.market)
+		defer closeRecorder()
 		runLoop(func(ctx context.Context, outputs chan<- *dydx.TradesChannelResponse) error {
-			return client.SubscribeTrades(ctx, c.market, outputs)
+			return client.SubscribeTrades(ctx, c.market, outputs, dydx.SetSubscriptionStaleTimeout(time.Duration(c.staleTimeout)), dydx.SetSubscriptionBatched(c.batched), dydx.SetSubscriptionRecorder(recorder))
 		}, time.Duration(c.sublength), defaultLoopPrinter[dydx.TradesChannelResponseContents])
 	}
 }
@@ -22,12 +22,16 @@ func newRootCmd() *rootCmd {
 	cancelCmd := newCancelCmd()
 	subCmd := newLsPublicCmd()
 	testnetokenCmd := newTestnetTokenCmd()
+	keystoreCmd := newKeystoreCmd()
+	convertFeedCmd := newConvertFeedCmd()
 	c.AddCommand(
 		send.Command,
 		getCmd.Command,
 		cancelCmd.Command,
 		subCmd.Command,
-		testnetokenCmd.Command)
+		testnetokenCmd.Command,
+		keystoreCmd.Command,
+		convertFeedCmd.Command)
 
 	return c
 }
@@ -70,7 +70,7 @@ func newSendCmd() *sendCmd {
 }
 
 func (c *sendCmd) do(*cobra.Command, []string) {
-	client := getOrPanic(dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), c.ethAddress, c.isMainnet))
+	client := getOrPanic(dydx.NewClient((*dydx.StarkKey)(&c.starkKey), (*dydx.ApiKey)(&c.apiKey), getOrPanic(c.getEthAddress()), c.isMainnet))
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.timeout))
 	defer cancel()
 
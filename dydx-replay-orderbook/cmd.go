@@ -2,12 +2,16 @@
 package main
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
 	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/feedcodec"
 	"github.com/spf13/cobra"
 )
 
@@ -48,12 +52,56 @@ func orPanic(err error) {
 	}
 }
 
+// forEachUpdate reads the updates from a json array, json lines written by `dydx-cli ls-pub orderbook --top --out`,
+// or the binary format of package feedcodec.
+func forEachUpdate(r io.Reader, f func(int, *dydx.OrderbookChannelResponse)) error {
+	reader := bufio.NewReader(r)
+	if feedcodec.IsBinaryFeed(reader) {
+		return forEachBinaryUpdate(reader, f)
+	}
+
+	i := 0
+	return feedcodec.ForEachJsonValue(reader, func(data json.RawMessage) error {
+		var v dydx.OrderbookChannelResponse
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		f(i, &v)
+		i++
+		return nil
+	})
+}
+
+// forEachBinaryUpdate reads the updates in the binary format of package feedcodec.
+func forEachBinaryUpdate(r io.Reader, f func(int, *dydx.OrderbookChannelResponse)) error {
+	decoder, err := feedcodec.NewDecoder(r)
+	if err != nil {
+		return err
+	}
+	header := decoder.Header()
+	if header.Channel != dydx.OrderbookChannel {
+		return fmt.Errorf("binary feed of %s is not orderbook", header.Channel)
+	}
+	log.Printf("binary feed of %s, tick size %s, step size %s", header.Market, header.TickSize, header.StepSize)
+
+	for i := 0; ; i++ {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f(i, record.Orderbook)
+	}
+}
+
 func (c *rootCmd) do(cmd *cobra.Command, args []string) {
 	log.Printf("reading messages from %s", args[0])
-	var data []*dydx.OrderbookChannelResponse
-	orPanic(json.Unmarshal(getOrPanic(os.ReadFile(args[0])), &data))
+	file := getOrPanic(os.Open(args[0]))
+	defer file.Close()
 	ob := dydx.NewOrderbookProcessor("BTC-USD", true)
-	for i, v := range data {
+	orPanic(forEachUpdate(file, func(i int, v *dydx.OrderbookChannelResponse) {
 		if c.printUpdate {
 			log.Printf("index %d resp: %s", i, getOrPanic(json.MarshalIndent(v, "", "  ")))
 		}
@@ -72,7 +120,7 @@ func (c *rootCmd) do(cmd *cobra.Command, args []string) {
 			log.Printf("index %d bids: %s", i, getOrPanic(json.MarshalIndent(ob.Bids, "", "  ")))
 			log.Printf("index %d asks: %s", i, getOrPanic(json.MarshalIndent(ob.Asks, "", "  ")))
 		}
-	}
+	}))
 }
 
 func main() {
@@ -0,0 +1,441 @@
+package dydxtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fardream/go-dydx"
+)
+
+// FakeMethod records the calls to a method of FakeExchange, and returns the programmed results.
+//
+// The result of a call is from the stub if it is set, then the result for the index of the call, then the default result.
+// The subscription methods use struct{} as the result, and block until the context is done when no result is programmed,
+// like the subscriptions of dydx.Client.
+type FakeMethod[TArgs any, TResult any] struct {
+	mutex  sync.Mutex
+	calls  []TArgs
+	stub   func(TArgs) (TResult, error)
+	onCall map[int]fakeResult[TResult]
+	result fakeResult[TResult]
+}
+
+type fakeResult[TResult any] struct {
+	result TResult
+	err    error
+	// set is true when the result is programmed.
+	set bool
+}
+
+// Returns sets the default result.
+func (m *FakeMethod[TArgs, TResult]) Returns(result TResult, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.result = fakeResult[TResult]{result: result, err: err, set: true}
+}
+
+// ReturnsOnCall sets the result for the call at the index, which starts from 0.
+func (m *FakeMethod[TArgs, TResult]) ReturnsOnCall(i int, result TResult, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.onCall == nil {
+		m.onCall = make(map[int]fakeResult[TResult])
+	}
+	m.onCall[i] = fakeResult[TResult]{result: result, err: err, set: true}
+}
+
+// Stub sets the function called with the arguments of each call. nil clears the stub.
+func (m *FakeMethod[TArgs, TResult]) Stub(stub func(TArgs) (TResult, error)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stub = stub
+}
+
+// CallCount returns the number of calls.
+func (m *FakeMethod[TArgs, TResult]) CallCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.calls)
+}
+
+// ArgsForCall returns the arguments of the call at the index, which starts from 0.
+func (m *FakeMethod[TArgs, TResult]) ArgsForCall(i int) TArgs {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls[i]
+}
+
+func (m *FakeMethod[TArgs, TResult]) call(args TArgs) (TResult, error) {
+	result := m.callProgrammed(args)
+	return result.result, result.err
+}
+
+// callOrWait waits for the context to be done if no result is programmed for the call.
+func (m *FakeMethod[TArgs, TResult]) callOrWait(ctx context.Context, args TArgs) (TResult, error) {
+	result := m.callProgrammed(args)
+	if !result.set {
+		<-ctx.Done()
+		return result.result, ctx.Err()
+	}
+	return result.result, result.err
+}
+
+// callProgrammed records the call, and returns the result from the stub, the result for the index or the default result.
+func (m *FakeMethod[TArgs, TResult]) callProgrammed(args TArgs) fakeResult[TResult] {
+	m.mutex.Lock()
+	index := len(m.calls)
+	m.calls = append(m.calls, args)
+	stub := m.stub
+	result, ok := m.onCall[index]
+	if !ok {
+		result = m.result
+	}
+	m.mutex.Unlock()
+
+	if stub != nil {
+		r, err := stub(args)
+		return fakeResult[TResult]{result: r, err: err, set: true}
+	}
+	return result
+}
+
+// FakeExchange is an in-memory implementation of dydx.Exchange for tests. Each method XXX records the calls in XXXCalls,
+// where the results can be programmed. The methods return nil results and nil errors by default,
+// except the subscriptions, which block until the context is done.
+//
+//	fake := &dydxtest.FakeExchange{}
+//	fake.GetOrderbookCalls.Returns(&dydx.OrderbookResponse{}, nil)
+//	fake.SubscribeTradesCalls.Stub(func(args dydxtest.SubscribeTradesArgs) (struct{}, error) {
+//		args.OutputChan <- &dydx.TradesChannelResponse{}
+//		<-args.Ctx.Done()
+//		return struct{}{}, nil
+//	})
+type FakeExchange struct {
+	GetMarketsCalls           FakeMethod[GetMarketsArgs, *dydx.MarketsResponse]
+	GetOrderbookCalls         FakeMethod[GetOrderbookArgs, *dydx.OrderbookResponse]
+	GetTradesCalls            FakeMethod[GetTradesArgs, *dydx.TradesResponse]
+	GetCandlesCalls           FakeMethod[GetCandlesArgs, *dydx.CandlesResponse]
+	GetHistoricalFundingCalls FakeMethod[GetHistoricalFundingArgs, *dydx.HistoricalFundingsResponse]
+	GetUserCalls              FakeMethod[GetUserArgs, *dydx.UsersResponse]
+	GetAccountsCalls          FakeMethod[GetAccountsArgs, *dydx.AccountsResponse]
+	GetAccountCalls           FakeMethod[GetAccountArgs, *dydx.AccountResponse]
+	GetPositionsCalls         FakeMethod[GetPositionsArgs, *dydx.PositionResponse]
+	GetFillsCalls             FakeMethod[GetFillsArgs, *dydx.FillsResponse]
+	GetFundingPaymentsCalls   FakeMethod[GetFundingPaymentsArgs, *dydx.FundingPaymentsResponse]
+	GetHistoricalPnLCalls     FakeMethod[GetHistoricalPnLArgs, *dydx.HistoricalPnLResponse]
+	GetTradingRewardsCalls    FakeMethod[GetTradingRewardsArgs, *dydx.TradingRewardsResponse]
+	GetOrdersCalls            FakeMethod[GetOrdersArgs, *dydx.OrdersResponse]
+	GetOrderByIdCalls         FakeMethod[GetOrderByIdArgs, *dydx.OrderResponse]
+	GetOrderByClientIdCalls   FakeMethod[GetOrderByClientIdArgs, *dydx.OrderResponse]
+	GetActiveOrdersCalls      FakeMethod[GetActiveOrdersArgs, *dydx.ActiveOrdersResponse]
+	NewOrderCalls             FakeMethod[NewOrderArgs, *dydx.CreateOrderResponse]
+	CancelOrderCalls          FakeMethod[CancelOrderArgs, *dydx.CancelOrderResponse]
+	CancelOrdersCalls         FakeMethod[CancelOrdersArgs, *dydx.CancelOrdersResponse]
+	CancelActiveOrdersCalls   FakeMethod[CancelActiveOrdersArgs, *dydx.CancelActiveOrdersResponse]
+	SubscribeMarketsCalls     FakeMethod[SubscribeMarketsArgs, struct{}]
+	SubscribeOrderbookCalls   FakeMethod[SubscribeOrderbookArgs, struct{}]
+	SubscribeTradesCalls      FakeMethod[SubscribeTradesArgs, struct{}]
+	SubscribeAccountCalls     FakeMethod[SubscribeAccountArgs, struct{}]
+
+	invocationsMutex sync.Mutex
+	invocations      []string
+}
+
+var _ dydx.Exchange = (*FakeExchange)(nil)
+
+// Invocations returns the names of the methods called, in the order of the calls.
+func (f *FakeExchange) Invocations() []string {
+	f.invocationsMutex.Lock()
+	defer f.invocationsMutex.Unlock()
+	return append([]string(nil), f.invocations...)
+}
+
+func (f *FakeExchange) recordInvocation(name string) {
+	f.invocationsMutex.Lock()
+	defer f.invocationsMutex.Unlock()
+	f.invocations = append(f.invocations, name)
+}
+
+// GetMarketsArgs are the arguments of FakeExchange.GetMarkets.
+type GetMarketsArgs struct {
+	Ctx context.Context
+}
+
+func (f *FakeExchange) GetMarkets(ctx context.Context) (*dydx.MarketsResponse, error) {
+	f.recordInvocation("GetMarkets")
+	return f.GetMarketsCalls.call(GetMarketsArgs{Ctx: ctx})
+}
+
+// GetOrderbookArgs are the arguments of FakeExchange.GetOrderbook.
+type GetOrderbookArgs struct {
+	Ctx    context.Context
+	Market string
+}
+
+func (f *FakeExchange) GetOrderbook(ctx context.Context, market string) (*dydx.OrderbookResponse, error) {
+	f.recordInvocation("GetOrderbook")
+	return f.GetOrderbookCalls.call(GetOrderbookArgs{Ctx: ctx, Market: market})
+}
+
+// GetTradesArgs are the arguments of FakeExchange.GetTrades.
+type GetTradesArgs struct {
+	Ctx    context.Context
+	Params *dydx.TradesParam
+}
+
+func (f *FakeExchange) GetTrades(ctx context.Context, params *dydx.TradesParam) (*dydx.TradesResponse, error) {
+	f.recordInvocation("GetTrades")
+	return f.GetTradesCalls.call(GetTradesArgs{Ctx: ctx, Params: params})
+}
+
+// GetCandlesArgs are the arguments of FakeExchange.GetCandles.
+type GetCandlesArgs struct {
+	Ctx    context.Context
+	Params *dydx.CandlesParam
+}
+
+func (f *FakeExchange) GetCandles(ctx context.Context, params *dydx.CandlesParam) (*dydx.CandlesResponse, error) {
+	f.recordInvocation("GetCandles")
+	return f.GetCandlesCalls.call(GetCandlesArgs{Ctx: ctx, Params: params})
+}
+
+// GetHistoricalFundingArgs are the arguments of FakeExchange.GetHistoricalFunding.
+type GetHistoricalFundingArgs struct {
+	Ctx    context.Context
+	Params *dydx.HistoricalFundingsParam
+}
+
+func (f *FakeExchange) GetHistoricalFunding(ctx context.Context, params *dydx.HistoricalFundingsParam) (*dydx.HistoricalFundingsResponse, error) {
+	f.recordInvocation("GetHistoricalFunding")
+	return f.GetHistoricalFundingCalls.call(GetHistoricalFundingArgs{Ctx: ctx, Params: params})
+}
+
+// GetUserArgs are the arguments of FakeExchange.GetUser.
+type GetUserArgs struct {
+	Ctx context.Context
+}
+
+func (f *FakeExchange) GetUser(ctx context.Context) (*dydx.UsersResponse, error) {
+	f.recordInvocation("GetUser")
+	return f.GetUserCalls.call(GetUserArgs{Ctx: ctx})
+}
+
+// GetAccountsArgs are the arguments of FakeExchange.GetAccounts.
+type GetAccountsArgs struct {
+	Ctx context.Context
+}
+
+func (f *FakeExchange) GetAccounts(ctx context.Context) (*dydx.AccountsResponse, error) {
+	f.recordInvocation("GetAccounts")
+	return f.GetAccountsCalls.call(GetAccountsArgs{Ctx: ctx})
+}
+
+// GetAccountArgs are the arguments of FakeExchange.GetAccount.
+type GetAccountArgs struct {
+	Ctx context.Context
+	Id  string
+}
+
+func (f *FakeExchange) GetAccount(ctx context.Context, id string) (*dydx.AccountResponse, error) {
+	f.recordInvocation("GetAccount")
+	return f.GetAccountCalls.call(GetAccountArgs{Ctx: ctx, Id: id})
+}
+
+// GetPositionsArgs are the arguments of FakeExchange.GetPositions.
+type GetPositionsArgs struct {
+	Ctx    context.Context
+	Params *dydx.PositionParams
+}
+
+func (f *FakeExchange) GetPositions(ctx context.Context, params *dydx.PositionParams) (*dydx.PositionResponse, error) {
+	f.recordInvocation("GetPositions")
+	return f.GetPositionsCalls.call(GetPositionsArgs{Ctx: ctx, Params: params})
+}
+
+// GetFillsArgs are the arguments of FakeExchange.GetFills.
+type GetFillsArgs struct {
+	Ctx    context.Context
+	Params *dydx.FillsParam
+}
+
+func (f *FakeExchange) GetFills(ctx context.Context, params *dydx.FillsParam) (*dydx.FillsResponse, error) {
+	f.recordInvocation("GetFills")
+	return f.GetFillsCalls.call(GetFillsArgs{Ctx: ctx, Params: params})
+}
+
+// GetFundingPaymentsArgs are the arguments of FakeExchange.GetFundingPayments.
+type GetFundingPaymentsArgs struct {
+	Ctx    context.Context
+	Params *dydx.FundingPaymentsParam
+}
+
+func (f *FakeExchange) GetFundingPayments(ctx context.Context, params *dydx.FundingPaymentsParam) (*dydx.FundingPaymentsResponse, error) {
+	f.recordInvocation("GetFundingPayments")
+	return f.GetFundingPaymentsCalls.call(GetFundingPaymentsArgs{Ctx: ctx, Params: params})
+}
+
+// GetHistoricalPnLArgs are the arguments of FakeExchange.GetHistoricalPnL.
+type GetHistoricalPnLArgs struct {
+	Ctx    context.Context
+	Params *dydx.HistoricalPnLParam
+}
+
+func (f *FakeExchange) GetHistoricalPnL(ctx context.Context, params *dydx.HistoricalPnLParam) (*dydx.HistoricalPnLResponse, error) {
+	f.recordInvocation("GetHistoricalPnL")
+	return f.GetHistoricalPnLCalls.call(GetHistoricalPnLArgs{Ctx: ctx, Params: params})
+}
+
+// GetTradingRewardsArgs are the arguments of FakeExchange.GetTradingRewards.
+type GetTradingRewardsArgs struct {
+	Ctx   context.Context
+	Epoch int64
+}
+
+func (f *FakeExchange) GetTradingRewards(ctx context.Context, epoch int64) (*dydx.TradingRewardsResponse, error) {
+	f.recordInvocation("GetTradingRewards")
+	return f.GetTradingRewardsCalls.call(GetTradingRewardsArgs{Ctx: ctx, Epoch: epoch})
+}
+
+// GetOrdersArgs are the arguments of FakeExchange.GetOrders.
+type GetOrdersArgs struct {
+	Ctx    context.Context
+	Params *dydx.OrderQueryParam
+}
+
+func (f *FakeExchange) GetOrders(ctx context.Context, params *dydx.OrderQueryParam) (*dydx.OrdersResponse, error) {
+	f.recordInvocation("GetOrders")
+	return f.GetOrdersCalls.call(GetOrdersArgs{Ctx: ctx, Params: params})
+}
+
+// GetOrderByIdArgs are the arguments of FakeExchange.GetOrderById.
+type GetOrderByIdArgs struct {
+	Ctx context.Context
+	Id  string
+}
+
+func (f *FakeExchange) GetOrderById(ctx context.Context, id string) (*dydx.OrderResponse, error) {
+	f.recordInvocation("GetOrderById")
+	return f.GetOrderByIdCalls.call(GetOrderByIdArgs{Ctx: ctx, Id: id})
+}
+
+// GetOrderByClientIdArgs are the arguments of FakeExchange.GetOrderByClientId.
+type GetOrderByClientIdArgs struct {
+	Ctx      context.Context
+	ClientId string
+}
+
+func (f *FakeExchange) GetOrderByClientId(ctx context.Context, clientId string) (*dydx.OrderResponse, error) {
+	f.recordInvocation("GetOrderByClientId")
+	return f.GetOrderByClientIdCalls.call(GetOrderByClientIdArgs{Ctx: ctx, ClientId: clientId})
+}
+
+// GetActiveOrdersArgs are the arguments of FakeExchange.GetActiveOrders.
+type GetActiveOrdersArgs struct {
+	Ctx    context.Context
+	Params *dydx.QueryActiveOrdersParam
+}
+
+func (f *FakeExchange) GetActiveOrders(ctx context.Context, params *dydx.QueryActiveOrdersParam) (*dydx.ActiveOrdersResponse, error) {
+	f.recordInvocation("GetActiveOrders")
+	return f.GetActiveOrdersCalls.call(GetActiveOrdersArgs{Ctx: ctx, Params: params})
+}
+
+// NewOrderArgs are the arguments of FakeExchange.NewOrder.
+type NewOrderArgs struct {
+	Ctx        context.Context
+	Order      *dydx.CreateOrderRequest
+	PositionId int64
+}
+
+func (f *FakeExchange) NewOrder(ctx context.Context, order *dydx.CreateOrderRequest, positionId int64) (*dydx.CreateOrderResponse, error) {
+	f.recordInvocation("NewOrder")
+	return f.NewOrderCalls.call(NewOrderArgs{Ctx: ctx, Order: order, PositionId: positionId})
+}
+
+// CancelOrderArgs are the arguments of FakeExchange.CancelOrder.
+type CancelOrderArgs struct {
+	Ctx context.Context
+	Id  string
+}
+
+func (f *FakeExchange) CancelOrder(ctx context.Context, id string) (*dydx.CancelOrderResponse, error) {
+	f.recordInvocation("CancelOrder")
+	return f.CancelOrderCalls.call(CancelOrderArgs{Ctx: ctx, Id: id})
+}
+
+// CancelOrdersArgs are the arguments of FakeExchange.CancelOrders.
+type CancelOrdersArgs struct {
+	Ctx    context.Context
+	Params *dydx.CancelOrdersParam
+}
+
+func (f *FakeExchange) CancelOrders(ctx context.Context, params *dydx.CancelOrdersParam) (*dydx.CancelOrdersResponse, error) {
+	f.recordInvocation("CancelOrders")
+	return f.CancelOrdersCalls.call(CancelOrdersArgs{Ctx: ctx, Params: params})
+}
+
+// CancelActiveOrdersArgs are the arguments of FakeExchange.CancelActiveOrders.
+type CancelActiveOrdersArgs struct {
+	Ctx    context.Context
+	Params *dydx.CancelActiveOrdersParam
+}
+
+func (f *FakeExchange) CancelActiveOrders(ctx context.Context, params *dydx.CancelActiveOrdersParam) (*dydx.CancelActiveOrdersResponse, error) {
+	f.recordInvocation("CancelActiveOrders")
+	return f.CancelActiveOrdersCalls.call(CancelActiveOrdersArgs{Ctx: ctx, Params: params})
+}
+
+// SubscribeMarketsArgs are the arguments of FakeExchange.SubscribeMarkets.
+type SubscribeMarketsArgs struct {
+	Ctx        context.Context
+	OutputChan chan<- *dydx.MarketsChannelResponse
+	Options    []dydx.SubscriptionOption
+}
+
+func (f *FakeExchange) SubscribeMarkets(ctx context.Context, outputChan chan<- *dydx.MarketsChannelResponse, options ...dydx.SubscriptionOption) error {
+	f.recordInvocation("SubscribeMarkets")
+	_, err := f.SubscribeMarketsCalls.callOrWait(ctx, SubscribeMarketsArgs{Ctx: ctx, OutputChan: outputChan, Options: options})
+	return err
+}
+
+// SubscribeOrderbookArgs are the arguments of FakeExchange.SubscribeOrderbook.
+type SubscribeOrderbookArgs struct {
+	Ctx        context.Context
+	Market     string
+	OutputChan chan<- *dydx.OrderbookChannelResponse
+	Options    []dydx.SubscriptionOption
+}
+
+func (f *FakeExchange) SubscribeOrderbook(ctx context.Context, market string, outputChan chan<- *dydx.OrderbookChannelResponse, options ...dydx.SubscriptionOption) error {
+	f.recordInvocation("SubscribeOrderbook")
+	_, err := f.SubscribeOrderbookCalls.callOrWait(ctx, SubscribeOrderbookArgs{Ctx: ctx, Market: market, OutputChan: outputChan, Options: options})
+	return err
+}
+
+// SubscribeTradesArgs are the arguments of FakeExchange.SubscribeTrades.
+type SubscribeTradesArgs struct {
+	Ctx        context.Context
+	Market     string
+	OutputChan chan<- *dydx.TradesChannelResponse
+	Options    []dydx.SubscriptionOption
+}
+
+func (f *FakeExchange) SubscribeTrades(ctx context.Context, market string, outputChan chan<- *dydx.TradesChannelResponse, options ...dydx.SubscriptionOption) error {
+	f.recordInvocation("SubscribeTrades")
+	_, err := f.SubscribeTradesCalls.callOrWait(ctx, SubscribeTradesArgs{Ctx: ctx, Market: market, OutputChan: outputChan, Options: options})
+	return err
+}
+
+// SubscribeAccountArgs are the arguments of FakeExchange.SubscribeAccount.
+type SubscribeAccountArgs struct {
+	Ctx           context.Context
+	AccountNumber int
+	OutputChan    chan<- *dydx.AccountChannelResponse
+	Options       []dydx.SubscriptionOption
+}
+
+func (f *FakeExchange) SubscribeAccount(ctx context.Context, accountNumber int, outputChan chan<- *dydx.AccountChannelResponse, options ...dydx.SubscriptionOption) error {
+	f.recordInvocation("SubscribeAccount")
+	_, err := f.SubscribeAccountCalls.callOrWait(ctx, SubscribeAccountArgs{Ctx: ctx, AccountNumber: accountNumber, OutputChan: outputChan, Options: options})
+	return err
+}
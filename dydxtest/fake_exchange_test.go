@@ -0,0 +1,76 @@
+package dydxtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/dydxtest"
+)
+
+// lastTradePrice only depends on the smaller interfaces.
+func lastTradePrice(ctx context.Context, exchange dydx.PublicApi, market string) (string, error) {
+	trades, err := exchange.GetTrades(ctx, &dydx.TradesParam{MarketID: market, Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	if len(trades.Trades) == 0 {
+		return "", errors.New("no trades")
+	}
+	return trades.Trades[0].Price.String(), nil
+}
+
+func TestFakeExchange(t *testing.T) {
+	fake := &dydxtest.FakeExchange{}
+	ctx := context.Background()
+
+	price, _ := dydx.NewDecimalFromString("100.5")
+	fake.GetTradesCalls.Returns(&dydx.TradesResponse{Trades: []dydx.Trade{{Price: *price}}}, nil)
+	fake.GetTradesCalls.ReturnsOnCall(1, nil, errors.New("rate limited"))
+
+	if p, err := lastTradePrice(ctx, fake, "BTC-USD"); err != nil || p != "100.5" {
+		t.Fatalf("unexpected price %s: %v", p, err)
+	}
+	if _, err := lastTradePrice(ctx, fake, "ETH-USD"); err == nil {
+		t.Fatalf("second call should return the error")
+	}
+	if fake.GetTradesCalls.CallCount() != 2 || fake.GetTradesCalls.ArgsForCall(1).Params.MarketID != "ETH-USD" {
+		t.Fatalf("unexpected calls: %d", fake.GetTradesCalls.CallCount())
+	}
+
+	fake.SubscribeOrderbookCalls.Stub(func(args dydxtest.SubscribeOrderbookArgs) (struct{}, error) {
+		args.OutputChan <- &dydx.OrderbookChannelResponse{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe, Id: args.Market}}
+		<-args.Ctx.Done()
+		return struct{}{}, args.Ctx.Err()
+	})
+
+	subCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	outputChan := make(chan *dydx.OrderbookChannelResponse)
+	done := make(chan error)
+	go func() {
+		done <- fake.SubscribeOrderbook(subCtx, "BTC-USD", outputChan)
+	}()
+	if v := <-outputChan; v.Id != "BTC-USD" {
+		t.Fatalf("unexpected subscribed message: %#v", v)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected subscription error: %v", err)
+	}
+
+	// subscriptions without programmed results block until the context is done.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	if err := fake.SubscribeTrades(waitCtx, "BTC-USD", make(chan *dydx.TradesChannelResponse)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected subscription error: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"GetTrades", "GetTrades", "SubscribeOrderbook", "SubscribeTrades"}, fake.Invocations()); diff != "" {
+		t.Fatalf("unexpected invocations: %s", diff)
+	}
+}
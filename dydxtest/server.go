@@ -0,0 +1,602 @@
+// dydxtest provides an in-process dydx v3 server for tests, with the main rest endpoints and the websocket channels.
+//
+// The server keeps simple states of the accounts and orders, verifies the api key signatures of the private requests,
+// and verifies the stark signatures of the new orders. Markets, orderbooks and trades are set by the tests, and updates
+// can be published to the websocket subscribers. Errors, delays and disconnects can be injected.
+//
+//	server := dydxtest.NewServer()
+//	defer server.Close()
+//	server.AddAccount(apiKey, starkKey, &dydx.Account{ID: "account", PositionId: 1})
+//	client, _ := dydx.NewClient(starkKey, apiKey, "", false, dydx.SetClientRpcUrl(server.URL()), dydx.SetClientWsUrl(server.WsURL()))
+//
+// Code depending on dydx.Exchange (or the smaller interfaces) can also be tested without a server with FakeExchange.
+package dydxtest
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/starkex"
+)
+
+type serverOption func(s *Server)
+
+// SetServerNetworkId sets the network id used to verify the order signatures. The default is dydx.NetworkIdRopsten,
+// which matches a client created with isMainnet = false.
+func SetServerNetworkId(networkId int) serverOption {
+	return func(s *Server) {
+		s.networkId = networkId
+	}
+}
+
+// SetServerAssetRegistry sets the asset registry used to verify the order signatures. By default the server has its own registry, which uses the hard-coded tables.
+func SetServerAssetRegistry(registry *starkex.AssetRegistry) serverOption {
+	return func(s *Server) {
+		s.assetRegistry = registry
+	}
+}
+
+// Server is an in-process dydx server.
+type Server struct {
+	server *httptest.Server
+
+	networkId     int
+	assetRegistry *starkex.AssetRegistry
+
+	mutex sync.Mutex
+
+	// accounts by api key.
+	accounts map[string]*serverAccount
+
+	markets    map[string]dydx.Market
+	orderbooks map[string]*dydx.OrderbookResponse
+	trades     map[string][]dydx.Trade
+
+	faults []*fault
+	delay  time.Duration
+
+	wsConns map[*wsConn]struct{}
+	// scripts are sent after the subscribed message, keyed by channel and id.
+	scripts map[wsKey][]any
+}
+
+type serverAccount struct {
+	apiKey   *dydx.ApiKey
+	starkKey *dydx.StarkKey
+	account  *dydx.Account
+	orders   []*dydx.Order
+}
+
+// fault is an injected error for the requests matching method and path.
+type fault struct {
+	method     string
+	path       string
+	statusCode int
+	body       string
+	count      int
+}
+
+// NewServer starts the server.
+func NewServer(options ...serverOption) *Server {
+	s := &Server{
+		networkId:     dydx.NetworkIdRopsten,
+		assetRegistry: starkex.NewAssetRegistry(),
+		accounts:      make(map[string]*serverAccount),
+		markets:       make(map[string]dydx.Market),
+		orderbooks:    make(map[string]*dydx.OrderbookResponse),
+		trades:        make(map[string][]dydx.Trade),
+		wsConns:       make(map[*wsConn]struct{}),
+		scripts:       make(map[wsKey][]any),
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// URL is the rest api endpoint, see dydx.SetClientRpcUrl.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// WsURL is the websocket endpoint, see dydx.SetClientWsUrl.
+func (s *Server) WsURL() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http") + "/v3/ws"
+}
+
+// Close disconnects all the websockets and shuts down the server.
+func (s *Server) Close() {
+	s.DisconnectWebsockets()
+	s.server.Close()
+}
+
+// AddAccount adds an account accessible with the api key. Orders are verified against the public key of the stark key,
+// and the position id of the account. The account is returned for the account number in the account channel.
+func (s *Server) AddAccount(apiKey *dydx.ApiKey, starkKey *dydx.StarkKey, account *dydx.Account) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if account.StarkKey == "" && starkKey != nil {
+		account.StarkKey = starkKey.PublicKey
+	}
+	s.accounts[apiKey.Key] = &serverAccount{apiKey: apiKey, starkKey: starkKey, account: account}
+}
+
+// SetMarket sets the market returned by the markets endpoint and channel.
+func (s *Server) SetMarket(market dydx.Market) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.markets[market.Market] = market
+}
+
+// SetOrderbook sets the orderbook returned by the orderbook endpoint, and in the subscribed message of the orderbook channel.
+func (s *Server) SetOrderbook(market string, orderbook *dydx.OrderbookResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.orderbooks[market] = orderbook
+}
+
+// SetTrades sets the trades returned by the trades endpoint, and in the subscribed message of the trades channel.
+func (s *Server) SetTrades(market string, trades []dydx.Trade) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.trades[market] = trades
+}
+
+// GetOrders returns a copy of the orders of the account with the api key.
+func (s *Server) GetOrders(apiKey string) []dydx.Order {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	account, ok := s.accounts[apiKey]
+	if !ok {
+		return nil
+	}
+	orders := make([]dydx.Order, 0, len(account.orders))
+	for _, v := range account.orders {
+		orders = append(orders, *v)
+	}
+	return orders
+}
+
+// InjectError makes the next count requests with the method and path (such as /v3/orders, without the query) fail
+// with the status code and body. Empty method matches all methods.
+func (s *Server) InjectError(method, path string, statusCode int, body string, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.faults = append(s.faults, &fault{method: method, path: path, statusCode: statusCode, body: body, count: count})
+}
+
+// SetDelay delays all the rest responses and the websocket subscribed messages.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.delay = delay
+}
+
+func (s *Server) getDelay() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.delay
+}
+
+// takeFault returns the injected fault for the request, if any.
+func (s *Server) takeFault(r *http.Request) *fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.faults {
+		if (f.method == "" || f.method == r.Method) && f.path == r.URL.Path {
+			f.count--
+			if f.count <= 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v3/ws" && websocket.IsWebSocketUpgrade(r) {
+		s.serveWs(w, r)
+		return
+	}
+
+	if delay := s.getDelay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if f := s.takeFault(r); f != nil {
+		w.WriteHeader(f.statusCode)
+		w.Write([]byte(f.body))
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "v3" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	segments = segments[1:]
+
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "markets":
+		s.getMarkets(w)
+	case r.Method == http.MethodGet && len(segments) == 2 && segments[0] == "orderbook":
+		s.getOrderbook(w, segments[1])
+	case r.Method == http.MethodGet && len(segments) == 2 && segments[0] == "trades":
+		s.getTrades(w, segments[1])
+	default:
+		s.servePrivate(w, r, segments)
+	}
+}
+
+func (s *Server) servePrivate(w http.ResponseWriter, r *http.Request, segments []string) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	account, err := s.authenticate(r, body)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "accounts":
+		s.getAccounts(w, account)
+	case r.Method == http.MethodGet && len(segments) == 2 && segments[0] == "accounts":
+		s.getAccount(w, account, segments[1])
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "positions":
+		s.getPositions(w, account)
+	case r.Method == http.MethodPost && len(segments) == 1 && segments[0] == "orders":
+		s.createOrder(w, account, body)
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "orders":
+		s.getOrders(w, account, r)
+	case r.Method == http.MethodGet && len(segments) == 2 && segments[0] == "orders":
+		s.getOrder(w, account, func(o *dydx.Order) bool { return o.ID == segments[1] })
+	case r.Method == http.MethodGet && len(segments) == 3 && segments[0] == "orders" && segments[1] == "client":
+		s.getOrder(w, account, func(o *dydx.Order) bool { return o.ClientID == segments[2] })
+	case r.Method == http.MethodDelete && len(segments) == 2 && segments[0] == "orders":
+		s.cancelOrder(w, account, segments[1])
+	case r.Method == http.MethodDelete && len(segments) == 1 && segments[0] == "orders":
+		s.cancelOrders(w, account, r)
+	case r.Method == http.MethodGet && len(segments) == 1 && segments[0] == "active-orders":
+		s.getActiveOrders(w, account, r)
+	case r.Method == http.MethodDelete && len(segments) == 1 && segments[0] == "active-orders":
+		s.cancelActiveOrders(w, account, r)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// authenticate verifies the api key headers of the request.
+func (s *Server) authenticate(r *http.Request, body []byte) (*serverAccount, error) {
+	key := r.Header.Get("DYDX-API-KEY")
+	s.mutex.Lock()
+	account, ok := s.accounts[key]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown api key: %s", key)
+	}
+
+	if err := verifyApiKeySignature(account.apiKey, r.URL.RequestURI(), r.Method, r.Header.Get("DYDX-TIMESTAMP"), body, r.Header.Get("DYDX-SIGNATURE")); err != nil {
+		return nil, err
+	}
+	if r.Header.Get("DYDX-PASSPHRASE") != account.apiKey.Passphrase {
+		return nil, fmt.Errorf("invalid passphrase")
+	}
+
+	return account, nil
+}
+
+// verifyApiKeySignature checks the signature generated by dydx.ApiKey.Sign.
+func verifyApiKeySignature(apiKey *dydx.ApiKey, requestPath, method, isoTimestamp string, body []byte, signature string) error {
+	if isoTimestamp == "" {
+		return fmt.Errorf("timestamp is missing")
+	}
+	expected := apiKey.Sign(requestPath, method, isoTimestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid signature for %s %s", method, requestPath)
+	}
+	return nil
+}
+
+func (s *Server) getMarkets(w http.ResponseWriter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, &dydx.MarketsResponse{Markets: s.markets})
+}
+
+func (s *Server) getOrderbook(w http.ResponseWriter, market string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	orderbook, ok := s.orderbooks[market]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("market %s not found", market))
+		return
+	}
+	writeJSON(w, orderbook)
+}
+
+func (s *Server) getTrades(w http.ResponseWriter, market string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, &dydx.TradesResponse{Trades: s.trades[market]})
+}
+
+func (s *Server) getAccounts(w http.ResponseWriter, account *serverAccount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, &dydx.AccountsResponse{Accounts: []*dydx.Account{account.account}})
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, account *serverAccount, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if account.account.ID != id {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("account %s not found", id))
+		return
+	}
+	writeJSON(w, &dydx.AccountResponse{Account: *account.account})
+}
+
+func (s *Server) getPositions(w http.ResponseWriter, account *serverAccount) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	positions := make([]dydx.Position, 0, len(account.account.OpenPositions))
+	for _, v := range account.account.OpenPositions {
+		positions = append(positions, v)
+	}
+	writeJSON(w, &dydx.PositionResponse{Positions: positions})
+}
+
+// createOrder verifies the stark signature of the order and adds it as an open order.
+func (s *Server) createOrder(w http.ResponseWriter, account *serverAccount, body []byte) {
+	var request dydx.CreateOrderRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("failed to parse order: %v", err))
+		return
+	}
+	if request.Size == nil || request.Price == nil || request.LimitFee == nil {
+		writeError(w, http.StatusBadRequest, "size, price and limitFee are required")
+		return
+	}
+
+	if err := s.verifyOrderSignature(account, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	for _, v := range account.orders {
+		if v.ClientID == request.ClientId {
+			s.mutex.Unlock()
+			writeError(w, http.StatusConflict, fmt.Sprintf("order with client id %s already exists", request.ClientId))
+			return
+		}
+	}
+
+	order := &dydx.Order{
+		ID:            uuid.NewString(),
+		ClientID:      request.ClientId,
+		AccountID:     account.account.ID,
+		Market:        request.Market,
+		Side:          request.Side,
+		Price:         *request.Price,
+		Size:          *request.Size,
+		RemainingSize: *request.Size,
+		Type:          request.Type,
+		Status:        dydx.OrderStatusOpen,
+		TimeInForce:   request.TimeInForce,
+		PostOnly:      request.PostOnly,
+		CreatedAt:     time.Now().UTC(),
+		ExpiresAt:     request.Expiration,
+	}
+	account.orders = append(account.orders, order)
+	result := *order
+	s.mutex.Unlock()
+
+	s.publishOrders(account, []*dydx.Order{&result})
+
+	writeJSON(w, &dydx.CreateOrderResponse{Order: &result})
+}
+
+// verifyOrderSignature recomputes the hash of the order the same way as dydx.Client.NewOrderSignParam, and verifies it against the stark public key.
+func (s *Server) verifyOrderSignature(account *serverAccount, request *dydx.CreateOrderRequest) error {
+	if account.starkKey == nil {
+		return fmt.Errorf("account doesn't have a stark key")
+	}
+	if request.Signature == "" {
+		return fmt.Errorf("order signature is missing")
+	}
+
+	hash, err := s.assetRegistry.GetOrderHash(starkex.OrderSignParam{
+		NetworkId:  s.networkId,
+		Market:     request.Market,
+		Side:       string(request.Side),
+		PositionId: account.account.PositionId,
+		HumanSize:  request.Size.String(),
+		HumanPrice: request.Price.String(),
+		LimitFee:   request.LimitFee.String(),
+		ClientId:   request.ClientId,
+		Expiration: dydx.GetIsoDateStr(request.Expiration),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get order hash: %w", err)
+	}
+
+	ok, err := starkex.VerifySignature(hash, request.Signature, account.starkKey.PublicKey, account.starkKey.PublicKeyYCoordinate)
+	if err != nil {
+		return fmt.Errorf("failed to verify order signature: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid order signature")
+	}
+
+	return nil
+}
+
+func (s *Server) getOrders(w http.ResponseWriter, account *serverAccount, r *http.Request) {
+	query := r.URL.Query()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	orders := []dydx.Order{}
+	for _, v := range account.orders {
+		if (query.Get("market") == "" || v.Market == query.Get("market")) &&
+			(query.Get("status") == "" || string(v.Status) == query.Get("status")) &&
+			(query.Get("side") == "" || string(v.Side) == query.Get("side")) {
+			orders = append(orders, *v)
+		}
+	}
+	writeJSON(w, &dydx.OrdersResponse{Orders: orders})
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, account *serverAccount, match func(*dydx.Order) bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, v := range account.orders {
+		if match(v) {
+			writeJSON(w, &dydx.OrderResponse{Order: *v})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "order not found")
+}
+
+// cancelOrdersLocked cancels the open orders matching the filter. mutex must be held.
+func (s *Server) cancelOrdersLocked(account *serverAccount, match func(*dydx.Order) bool) []*dydx.Order {
+	var canceled []*dydx.Order
+	for _, v := range account.orders {
+		if v.Status != dydx.OrderStatusOpen && v.Status != dydx.OrderStatusPending && v.Status != dydx.OrderStatusUntriggered {
+			continue
+		}
+		if !match(v) {
+			continue
+		}
+		reason := dydx.CancelReasonUserCancelled
+		v.Status = dydx.OrderStatusCanceled
+		v.CancelReason = &reason
+		order := *v
+		canceled = append(canceled, &order)
+	}
+	return canceled
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, account *serverAccount, id string) {
+	s.mutex.Lock()
+	canceled := s.cancelOrdersLocked(account, func(o *dydx.Order) bool { return o.ID == id })
+	s.mutex.Unlock()
+
+	if len(canceled) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("open order %s not found", id))
+		return
+	}
+
+	s.publishOrders(account, canceled)
+
+	writeJSON(w, &dydx.CancelOrderResponse{CancelOrder: *canceled[0]})
+}
+
+func (s *Server) cancelOrders(w http.ResponseWriter, account *serverAccount, r *http.Request) {
+	market := r.URL.Query().Get("market")
+	s.mutex.Lock()
+	canceled := s.cancelOrdersLocked(account, func(o *dydx.Order) bool { return market == "" || o.Market == market })
+	s.mutex.Unlock()
+
+	s.publishOrders(account, canceled)
+
+	orders := []dydx.Order{}
+	for _, v := range canceled {
+		orders = append(orders, *v)
+	}
+	writeJSON(w, &dydx.CancelOrdersResponse{CancelOrders: orders})
+}
+
+// activeOrderFilter matches the orders with the market, side and id in the query of the request.
+func activeOrderFilter(r *http.Request) func(*dydx.Order) bool {
+	query := r.URL.Query()
+	return func(o *dydx.Order) bool {
+		return o.Market == query.Get("market") &&
+			(query.Get("side") == "" || string(o.Side) == query.Get("side")) &&
+			(query.Get("id") == "" || o.ID == query.Get("id"))
+	}
+}
+
+func toActiveOrder(o *dydx.Order) dydx.ActiveOrder {
+	return dydx.ActiveOrder{
+		ID:            o.ID,
+		AccountID:     o.AccountID,
+		Market:        o.Market,
+		Side:          o.Side,
+		Price:         o.Price,
+		RemainingSize: o.RemainingSize,
+	}
+}
+
+func (s *Server) getActiveOrders(w http.ResponseWriter, account *serverAccount, r *http.Request) {
+	match := activeOrderFilter(r)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	orders := []dydx.ActiveOrder{}
+	for _, v := range account.orders {
+		if v.Status == dydx.OrderStatusOpen && match(v) {
+			orders = append(orders, toActiveOrder(v))
+		}
+	}
+	writeJSON(w, &dydx.ActiveOrdersResponse{Orders: orders})
+}
+
+func (s *Server) cancelActiveOrders(w http.ResponseWriter, account *serverAccount, r *http.Request) {
+	s.mutex.Lock()
+	canceled := s.cancelOrdersLocked(account, activeOrderFilter(r))
+	s.mutex.Unlock()
+
+	s.publishOrders(account, canceled)
+
+	orders := []dydx.ActiveOrder{}
+	for _, v := range canceled {
+		orders = append(orders, toActiveOrder(v))
+	}
+	writeJSON(w, &dydx.CancelActiveOrdersResponse{CancelOrders: orders})
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// writeError writes the error in the format of dydx.
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	data, _ := json.Marshal(map[string]any{"errors": []map[string]string{{"msg": message}}})
+	w.Write(data)
+}
@@ -0,0 +1,244 @@
+package dydxtest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/dydxtest"
+)
+
+var (
+	testStarkKey = &dydx.StarkKey{
+		PublicKey:  "3b865a18323b8d147a12c556bfb1d502516c325b1477a23ba6c77af31f020fd",
+		PrivateKey: "58c7d5a90b1776bde86ebac077e053ed85b0f7164f53b080304a531947f46e3",
+	}
+	testApiKey = dydx.NewApiKey("cdb76448-91af-1546-c841-2f7370164155", "QyeP9h46NTRBFQUX-eqN", "bP5omVCq4dVI1-t1vCr4t4fwC8NZ-_jJcns8espY")
+)
+
+func newTestServer(t *testing.T) *dydxtest.Server {
+	server := dydxtest.NewServer()
+	server.AddAccount(testApiKey, testStarkKey, &dydx.Account{ID: "account-id", PositionId: 12345})
+	server.SetMarket(dydx.Market{Market: "BTC-USD", Status: "ONLINE"})
+	offset := int64(10)
+	server.SetOrderbook("BTC-USD", &dydx.OrderbookResponse{
+		Offset: &offset,
+		Bids:   []*dydx.OrderbookOrder{{Price: mustDecimal(t, "100"), Size: mustDecimal(t, "1")}},
+		Asks:   []*dydx.OrderbookOrder{{Price: mustDecimal(t, "101"), Size: mustDecimal(t, "2")}},
+	})
+	server.SetTrades("BTC-USD", nil)
+	return server
+}
+
+func mustDecimal(t *testing.T, s string) *dydx.Decimal {
+	d, err := dydx.NewDecimalFromString(s)
+	if err != nil {
+		t.Fatalf("failed to parse decimal %s: %v", s, err)
+	}
+	return d
+}
+
+func newTestClient(server *dydxtest.Server, apiKey *dydx.ApiKey) *dydx.Client {
+	policy := &dydx.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2, MaxAttempts: 5}
+	client, _ := dydx.NewClient(testStarkKey, apiKey, "", false, dydx.SetClientRpcUrl(server.URL()), dydx.SetClientWsUrl(server.WsURL()), dydx.SetClientReconnectPolicy(policy))
+	return client
+}
+
+func newTestOrder(t *testing.T, clientId string) *dydx.CreateOrderRequest {
+	return dydx.NewCreateOrderRequest("BTC-USD", dydx.OrderSideBuy, dydx.OrderTypeLimit, mustDecimal(t, "0.01"), mustDecimal(t, "100"), clientId, dydx.TimeInForceGtt, time.Now().Add(time.Hour), mustDecimal(t, "0.001"), false)
+}
+
+func TestServerRest(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := newTestClient(server, testApiKey)
+	ctx := context.Background()
+
+	orderbook, err := client.GetOrderbook(ctx, "BTC-USD")
+	if err != nil || len(orderbook.Bids) != 1 || *orderbook.Offset != 10 {
+		t.Fatalf("unexpected orderbook %#v: %v", orderbook, err)
+	}
+
+	order, err := client.NewOrder(ctx, newTestOrder(t, "order-1"), 12345)
+	if err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+	if order.Order.Status != dydx.OrderStatusOpen || order.Order.AccountID != "account-id" {
+		t.Fatalf("unexpected order: %#v", order.Order)
+	}
+
+	orders, err := client.GetOrders(ctx, &dydx.OrderQueryParam{Market: "BTC-USD"})
+	if err != nil || len(orders.Orders) != 1 || orders.Orders[0].ClientID != "order-1" {
+		t.Fatalf("unexpected orders %#v: %v", orders, err)
+	}
+
+	// signed with a different position id.
+	_, err = client.NewOrder(ctx, newTestOrder(t, "order-2"), 1)
+	var dydxErr *dydx.DydxError
+	if !errors.As(err, &dydxErr) || dydxErr.HttpStatusCode != http.StatusBadRequest {
+		t.Fatalf("order with invalid signature should fail: %v", err)
+	}
+
+	canceled, err := client.CancelOrder(ctx, order.Order.ID)
+	if err != nil || canceled.CancelOrder.Status != dydx.OrderStatusCanceled {
+		t.Fatalf("failed to cancel order %#v: %v", canceled, err)
+	}
+	if orders := server.GetOrders(testApiKey.Key); len(orders) != 1 || orders[0].Status != dydx.OrderStatusCanceled {
+		t.Fatalf("order is not canceled on the server: %#v", orders)
+	}
+
+	badClient := newTestClient(server, dydx.NewApiKey(testApiKey.Key, testApiKey.Passphrase, "8k1btcHszt_6ShxTzSt1FRq5NwxaiIxhi9TTQclx"))
+	_, err = badClient.GetAccounts(ctx)
+	if !errors.As(err, &dydxErr) || dydxErr.HttpStatusCode != http.StatusUnauthorized {
+		t.Fatalf("request with invalid api key signature should fail: %v", err)
+	}
+
+	server.InjectError(http.MethodGet, "/v3/accounts", http.StatusTooManyRequests, `{"errors":[{"msg":"rate limited"}]}`, 1)
+	_, err = client.GetAccounts(ctx)
+	if !errors.As(err, &dydxErr) || dydxErr.HttpStatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expecting injected error, got %v", err)
+	}
+	accounts, err := client.GetAccounts(ctx)
+	if err != nil || len(accounts.Accounts) != 1 {
+		t.Fatalf("unexpected accounts %#v: %v", accounts, err)
+	}
+}
+
+func TestServerWebsocket(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	client := newTestClient(server, testApiKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	orderbooks := make(chan *dydx.OrderbookChannelResponse)
+	go client.SubscribeOrderbook(ctx, "BTC-USD", orderbooks)
+	accounts := make(chan *dydx.AccountChannelResponse)
+	go client.SubscribeAccount(ctx, 0, accounts)
+
+	receive := func(t *testing.T, expectedType string) *dydx.OrderbookChannelResponse {
+		t.Helper()
+		select {
+		case v := <-orderbooks:
+			if v.Type != expectedType {
+				t.Fatalf("expecting %s, got %#v", expectedType, v)
+			}
+			return v
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", expectedType)
+		}
+		return nil
+	}
+
+	if v := receive(t, dydx.ChannelResponseTypeSubscribe); len(v.Contents.Bids) != 1 {
+		t.Fatalf("unexpected snapshot: %#v", v.Contents)
+	}
+
+	select {
+	case v := <-accounts:
+		if v.Type != dydx.ChannelResponseTypeSubscribe || v.Id != "account-id" || v.Contents.Account.PositionId != 12345 {
+			t.Fatalf("unexpected account subscribed message: %#v", v)
+		}
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for account")
+	}
+
+	offset := int64(11)
+	server.Publish(dydx.OrderbookChannel, "BTC-USD", &dydx.OrderbookResponse{Offset: &offset, Bids: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "99"), Size: mustDecimal(t, "3")}}})
+	receive(t, dydx.ChannelResponseTypeChannelData)
+
+	if _, err := client.NewOrder(ctx, newTestOrder(t, "order-1"), 12345); err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+	select {
+	case v := <-accounts:
+		if v.Type != dydx.ChannelResponseTypeChannelData || len(v.Contents.Orders) != 1 || v.Contents.Orders[0].ClientID != "order-1" {
+			t.Fatalf("unexpected account update: %#v", v)
+		}
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for order update")
+	}
+
+	server.DisconnectWebsockets()
+	receive(t, dydx.ChannelResponseTypeReconnected)
+	receive(t, dydx.ChannelResponseTypeSubscribe)
+
+	if count := server.WsConnectionCount(); count != 1 {
+		t.Fatalf("subscriptions should share one connection, got %d", count)
+	}
+}
+
+func TestServerWebsocketGap(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	server.SetTrades("ETH-USD", nil)
+	client := newTestClient(server, testApiKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(map[string]chan *dydx.TradesChannelResponse)
+	for _, market := range []string{"BTC-USD", "ETH-USD"} {
+		outputs[market] = make(chan *dydx.TradesChannelResponse, 16)
+		go client.SubscribeTrades(ctx, market, outputs[market])
+	}
+
+	receive := func(t *testing.T, market string, expectedType string) {
+		t.Helper()
+		select {
+		case v := <-outputs[market]:
+			if v.Type != expectedType {
+				t.Fatalf("expecting %s for %s, got %#v", expectedType, market, v)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s of %s", expectedType, market)
+		}
+	}
+	receive(t, "BTC-USD", dydx.ChannelResponseTypeSubscribe)
+	receive(t, "ETH-USD", dydx.ChannelResponseTypeSubscribe)
+
+	// the gap is only reported to the subscription of the message after the skipped id.
+	server.InjectMessageIdGap()
+	for _, market := range []string{"BTC-USD", "ETH-USD"} {
+		server.Publish(dydx.TradesChannel, market, &dydx.TradesResponse{})
+	}
+	receive(t, "BTC-USD", dydx.ChannelResponseTypeGap)
+	receive(t, "BTC-USD", dydx.ChannelResponseTypeChannelData)
+	receive(t, "ETH-USD", dydx.ChannelResponseTypeChannelData)
+}
+
+func TestClientAssetRegistryIsolated(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	server.SetMarket(dydx.Market{Market: "BTC-USD", Status: "ONLINE", SyntheticAssetID: "0x1234", AssetResolution: "10000000000"})
+
+	loaded := newTestClient(server, testApiKey)
+	other := newTestClient(server, testApiKey)
+	order := newTestOrder(t, "client-id")
+	before, err := other.GetOrderHash(order, 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.LoadAssetRegistry(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	loadedHash, err := loaded.GetOrderHash(order, 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := other.GetOrderHash(order, 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadedHash.Cmp(before) == 0 {
+		t.Errorf("loaded asset is not used by the client")
+	}
+	if after.Cmp(before) != 0 {
+		t.Errorf("loading the registry of one client changes the order hash of another client")
+	}
+}
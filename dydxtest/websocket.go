@@ -0,0 +1,317 @@
+package dydxtest
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/fardream/go-dydx"
+)
+
+type wsKey struct {
+	channel string
+	id      string
+}
+
+// wsConn is a websocket connection to the server.
+type wsConn struct {
+	conn *websocket.Conn
+	id   string
+
+	// writeMutex protects the writes and the message ids.
+	writeMutex sync.Mutex
+	// messageIDs are the last message ids of each channel and id.
+	messageIDs map[wsKey]int
+	// skipMessageID is set by InjectMessageIdGap to skip one message id.
+	skipMessageID bool
+
+	// subs are the subscriptions of the connection and whether they are batched, protected by the mutex of the server.
+	subs map[wsKey]bool
+}
+
+// wsRequest is the subscribe and unsubscribe request.
+type wsRequest struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Batched bool   `json:"batched"`
+
+	AccountNumber dydx.JsonInt `json:"accountNumber"`
+	ApiKey        string       `json:"apiKey"`
+	Signature     string       `json:"signature"`
+	Timestamp     string       `json:"timestamp"`
+	Passphrase    string       `json:"passphrase"`
+}
+
+// wsMessage is the message sent to the client.
+type wsMessage struct {
+	dydx.ChannelResponseHeader
+	Contents any `json:"contents,omitempty"`
+}
+
+// send writes the message with the next message id of the channel and id on the connection.
+func (c *wsConn) send(msg *wsMessage) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	key := wsKey{channel: msg.Channel, id: msg.Id}
+	if c.skipMessageID {
+		c.skipMessageID = false
+		c.messageIDs[key]++
+	}
+	c.messageIDs[key]++
+	msg.ConnectionID = c.id
+	msg.MessageID = c.messageIDs[key]
+	return c.conn.WriteJSON(msg)
+}
+
+func (c *wsConn) sendError(channel, id, message string) error {
+	return c.send(&wsMessage{ChannelResponseHeader: dydx.ChannelResponseHeader{
+		Type:    dydx.ChannelResponseTypeError,
+		Channel: channel,
+		Id:      id,
+		Message: message,
+	}})
+}
+
+func (s *Server) serveWs(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	c := &wsConn{conn: conn, id: uuid.NewString(), messageIDs: make(map[wsKey]int), subs: make(map[wsKey]bool)}
+
+	s.mutex.Lock()
+	s.wsConns[c] = struct{}{}
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.wsConns, c)
+		s.mutex.Unlock()
+	}()
+
+	// the connected message doesn't have a message id.
+	c.writeMutex.Lock()
+	err = conn.WriteJSON(&wsMessage{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeConnected, ConnectionID: c.id}})
+	c.writeMutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	for {
+		var request wsRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+
+		switch request.Type {
+		case "subscribe":
+			err = s.subscribe(c, &request)
+		case "unsubscribe":
+			err = s.unsubscribe(c, &request)
+		default:
+			err = c.sendError("", "", fmt.Sprintf("Invalid message type: %s", request.Type))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// subscribe sends the subscribed message with the initial contents of the channel, followed by the scripts.
+func (s *Server) subscribe(c *wsConn, request *wsRequest) error {
+	if delay := s.getDelay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	id, contents, err := s.getInitialContents(request)
+	if err != nil {
+		return c.sendError("", "", err.Error())
+	}
+
+	key := wsKey{channel: request.Channel, id: id}
+	s.mutex.Lock()
+	if _, ok := c.subs[key]; ok {
+		s.mutex.Unlock()
+		return c.sendError("", "", fmt.Sprintf("Invalid subscribe message: already subscribed (%s, %s)", key.channel, key.id))
+	}
+	c.subs[key] = request.Batched
+	scripts := s.scripts[key]
+	s.mutex.Unlock()
+
+	if err := c.send(&wsMessage{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe, Channel: key.channel, Id: key.id},
+		Contents:              contents,
+	}); err != nil {
+		return err
+	}
+
+	for _, contents := range scripts {
+		if err := c.send(newChannelData(key, contents)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getInitialContents validates the request, and returns the id and the contents of the subscribed message.
+func (s *Server) getInitialContents(request *wsRequest) (string, any, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch request.Channel {
+	case dydx.OrderbookChannel:
+		orderbook, ok := s.orderbooks[request.ID]
+		if !ok {
+			return "", nil, fmt.Errorf("Invalid subscription id for channel: (%s, %s)", request.Channel, request.ID)
+		}
+		return request.ID, orderbook, nil
+
+	case dydx.TradesChannel:
+		trades, ok := s.trades[request.ID]
+		if !ok {
+			return "", nil, fmt.Errorf("Invalid subscription id for channel: (%s, %s)", request.Channel, request.ID)
+		}
+		return request.ID, &dydx.TradesResponse{Trades: trades}, nil
+
+	case dydx.MarketsChannel:
+		return "", &dydx.MarketsResponse{Markets: s.markets}, nil
+
+	case dydx.AccountChannel:
+		account, ok := s.accounts[request.ApiKey]
+		if !ok {
+			return "", nil, fmt.Errorf("Invalid api key: %s", request.ApiKey)
+		}
+		if err := verifyApiKeySignature(account.apiKey, "/ws/accounts", http.MethodGet, request.Timestamp, nil, request.Signature); err != nil {
+			return "", nil, err
+		}
+		if request.Passphrase != account.apiKey.Passphrase {
+			return "", nil, fmt.Errorf("invalid passphrase")
+		}
+		if request.AccountNumber != account.account.AccountNumber {
+			return "", nil, fmt.Errorf("account number %d not found", request.AccountNumber)
+		}
+		var orders []*dydx.Order
+		for _, v := range account.orders {
+			if v.Status == dydx.OrderStatusOpen || v.Status == dydx.OrderStatusPending || v.Status == dydx.OrderStatusUntriggered {
+				order := *v
+				orders = append(orders, &order)
+			}
+		}
+		accountCopy := *account.account
+		return account.account.ID, &dydx.AccountChannelResponseContents{Account: &accountCopy, Orders: orders}, nil
+
+	default:
+		return "", nil, fmt.Errorf("Invalid channel: %s", request.Channel)
+	}
+}
+
+func (s *Server) unsubscribe(c *wsConn, request *wsRequest) error {
+	key := wsKey{channel: request.Channel, id: request.ID}
+	s.mutex.Lock()
+	_, ok := c.subs[key]
+	delete(c.subs, key)
+	s.mutex.Unlock()
+
+	if !ok {
+		return c.sendError(key.channel, key.id, fmt.Sprintf("Invalid unsubscribe message: not subscribed (%s, %s)", key.channel, key.id))
+	}
+
+	return c.send(&wsMessage{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeUnsubscribe, Channel: key.channel, Id: key.id}})
+}
+
+func newChannelData(key wsKey, contents any) *wsMessage {
+	return &wsMessage{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelData, Channel: key.channel, Id: key.id},
+		Contents:              contents,
+	}
+}
+
+// getSubscribers returns the connections subscribed to the key, and whether they are batched.
+func (s *Server) getSubscribers(key wsKey) map[*wsConn]bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make(map[*wsConn]bool)
+	for c := range s.wsConns {
+		if batched, ok := c.subs[key]; ok {
+			result[c] = batched
+		}
+	}
+	return result
+}
+
+// SetScript sets the contents sent as channel_data right after the subscribed message of each subscription to the channel and id.
+func (s *Server) SetScript(channel, id string, contents ...any) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.scripts[wsKey{channel: channel, id: id}] = contents
+}
+
+// Publish sends the contents as channel_data to the subscribers of the channel and id.
+func (s *Server) Publish(channel, id string, contents any) {
+	key := wsKey{channel: channel, id: id}
+	for c := range s.getSubscribers(key) {
+		c.send(newChannelData(key, contents))
+	}
+}
+
+// PublishBatch sends the contents in one channel_batch_data message to the batched subscribers of the channel and id,
+// and as separate channel_data messages to the other subscribers.
+func (s *Server) PublishBatch(channel, id string, contents ...any) {
+	key := wsKey{channel: channel, id: id}
+	for c, batched := range s.getSubscribers(key) {
+		if batched {
+			c.send(&wsMessage{
+				ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelBatchData, Channel: key.channel, Id: key.id},
+				Contents:              contents,
+			})
+			continue
+		}
+		for _, v := range contents {
+			c.send(newChannelData(key, v))
+		}
+	}
+}
+
+// publishOrders sends the updated orders to the subscribers of the account.
+func (s *Server) publishOrders(account *serverAccount, orders []*dydx.Order) {
+	if len(orders) == 0 {
+		return
+	}
+	s.Publish(dydx.AccountChannel, account.account.ID, &dydx.AccountChannelResponseContents{Orders: orders})
+}
+
+// DisconnectWebsockets closes all the websocket connections without the close handshake.
+func (s *Server) DisconnectWebsockets() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.wsConns {
+		c.conn.Close()
+	}
+}
+
+// InjectMessageIdGap skips one message id on each of the current websocket connections,
+// so the clients see a gap at the next message, which belongs to the channel and id of that message.
+func (s *Server) InjectMessageIdGap() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for c := range s.wsConns {
+		c.writeMutex.Lock()
+		c.skipMessageID = true
+		c.writeMutex.Unlock()
+	}
+}
+
+// WsConnectionCount returns the number of the current websocket connections.
+func (s *Server) WsConnectionCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.wsConns)
+}
@@ -16,7 +16,7 @@ func ExampleDeriveStarkKey() {
 		log.Fatalf("failed to generate an ethereum key: %#v", err)
 	}
 
-	stark_key, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(key), false)
+	stark_key, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(key), false, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		log.Fatalf("failed to derivate stark key: %#v", err)
 	}
@@ -0,0 +1,58 @@
+package dydx
+
+import "context"
+
+// PublicApi contains the methods for the public market data.
+type PublicApi interface {
+	GetMarkets(ctx context.Context) (*MarketsResponse, error)
+	GetOrderbook(ctx context.Context, market string) (*OrderbookResponse, error)
+	GetTrades(ctx context.Context, params *TradesParam) (*TradesResponse, error)
+	GetCandles(ctx context.Context, params *CandlesParam) (*CandlesResponse, error)
+	GetHistoricalFunding(ctx context.Context, params *HistoricalFundingsParam) (*HistoricalFundingsResponse, error)
+}
+
+// PrivateApi contains the methods for the account and the orders, which require the api key (and the stark key to create orders and withdrawals).
+type PrivateApi interface {
+	GetUser(ctx context.Context) (*UsersResponse, error)
+	GetAccounts(ctx context.Context) (*AccountsResponse, error)
+	GetAccount(ctx context.Context, id string) (*AccountResponse, error)
+	GetPositions(ctx context.Context, params *PositionParams) (*PositionResponse, error)
+	GetFills(ctx context.Context, params *FillsParam) (*FillsResponse, error)
+	GetFundingPayments(ctx context.Context, params *FundingPaymentsParam) (*FundingPaymentsResponse, error)
+	GetHistoricalPnL(ctx context.Context, params *HistoricalPnLParam) (*HistoricalPnLResponse, error)
+	GetTradingRewards(ctx context.Context, epoch int64) (*TradingRewardsResponse, error)
+
+	GetOrders(ctx context.Context, params *OrderQueryParam) (*OrdersResponse, error)
+	GetOrderById(ctx context.Context, id string) (*OrderResponse, error)
+	GetOrderByClientId(ctx context.Context, clientId string) (*OrderResponse, error)
+	GetActiveOrders(ctx context.Context, params *QueryActiveOrdersParam) (*ActiveOrdersResponse, error)
+	NewOrder(ctx context.Context, order *CreateOrderRequest, positionId int64) (*CreateOrderResponse, error)
+	CancelOrder(ctx context.Context, id string) (*CancelOrderResponse, error)
+	CancelOrders(ctx context.Context, params *CancelOrdersParam) (*CancelOrdersResponse, error)
+	CancelActiveOrders(ctx context.Context, params *CancelActiveOrdersParam) (*CancelActiveOrdersResponse, error)
+}
+
+// SubscriptionApi contains the methods for the websocket subscriptions.
+// StartSubscription can be used with these methods for the handler based api.
+type SubscriptionApi interface {
+	SubscribeMarkets(ctx context.Context, outputChan chan<- *MarketsChannelResponse, options ...SubscriptionOption) error
+	SubscribeOrderbook(ctx context.Context, market string, outputChan chan<- *OrderbookChannelResponse, options ...SubscriptionOption) error
+	SubscribeTrades(ctx context.Context, market string, outputChan chan<- *TradesChannelResponse, options ...SubscriptionOption) error
+	SubscribeAccount(ctx context.Context, accountNumber int, outputChan chan<- *AccountChannelResponse, options ...SubscriptionOption) error
+}
+
+// MarketDataApi contains the methods for the public market data and the subscriptions.
+type MarketDataApi interface {
+	PublicApi
+	SubscriptionApi
+}
+
+// Exchange contains all the methods of the exchange. Code depending on Exchange (or the smaller interfaces)
+// instead of *Client can be tested with dydxtest.FakeExchange.
+type Exchange interface {
+	PublicApi
+	PrivateApi
+	SubscriptionApi
+}
+
+var _ Exchange = (*Client)(nil)
@@ -0,0 +1,163 @@
+package feedcodec
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"unicode"
+
+	"github.com/fardream/go-dydx"
+)
+
+// FromJson reads the responses in json from r, and writes them to w in the binary format with the header.
+// It returns the number of the responses written.
+//
+// The input is a json array or json lines of the responses (such as written by `dydx-cli ls-pub orderbook --top --out`),
+// or the recording written by dydx.SetSubscriptionRecorder, whose frames of other channels or markets are skipped.
+// The receive time is only known for the recordings.
+func FromJson(w io.Writer, r io.Reader, header *Header) (int, error) {
+	output := bufio.NewWriter(w)
+	encoder, err := NewEncoder(output, header)
+	if err != nil {
+		return 0, err
+	}
+
+	index, count := 0, 0
+	err = ForEachJsonValue(r, func(data json.RawMessage) error {
+		index++
+		var frame dydx.RecordedFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return err
+		}
+		var receivedAt time.Time
+		if len(frame.Frame) > 0 {
+			var h dydx.ChannelResponseHeader
+			if err := json.Unmarshal(frame.Frame, &h); err != nil {
+				return err
+			}
+			if h.Channel != header.Channel || h.Id != header.Market {
+				return nil
+			}
+			data, receivedAt = frame.Frame, frame.ReceivedAt
+		}
+
+		var err error
+		switch header.Channel {
+		case dydx.OrderbookChannel:
+			var resp dydx.OrderbookChannelResponse
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+			err = encoder.EncodeOrderbook(receivedAt, &resp)
+		default:
+			var resp dydx.TradesChannelResponse
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+			err = encoder.EncodeTrades(receivedAt, &resp)
+		}
+		if err == nil {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to convert value %d: %w", index, err)
+	}
+
+	return count, output.Flush()
+}
+
+// ForEachJsonValue calls f on each value of a json array, or each value of json lines, and stops at the first error from f.
+func ForEachJsonValue(r io.Reader, f func(json.RawMessage) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			break
+		}
+		reader.ReadByte()
+	}
+
+	decoder := json.NewDecoder(reader)
+	if b, _ := reader.Peek(1); b[0] == '[' {
+		var values []json.RawMessage
+		if err := decoder.Decode(&values); err != nil {
+			return err
+		}
+		for _, v := range values {
+			if err := f(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		var v json.RawMessage
+		if err := decoder.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := f(v); err != nil {
+			return err
+		}
+	}
+}
+
+// ToJson reads the binary format from r, and writes the responses to w in the format of the recording
+// written by dydx.SetSubscriptionRecorder, which can be replayed by dydx.ReplayRecording.
+// It returns the number of the responses written.
+func ToJson(w io.Writer, r io.Reader) (int, error) {
+	decoder, err := NewDecoder(r)
+	if err != nil {
+		return 0, err
+	}
+
+	output := bufio.NewWriter(w)
+	count := 0
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		frame := &dydx.RecordedFrame{ReceivedAt: record.ReceivedAt}
+		switch header := record.Header(); {
+		case header.Type == dydx.ChannelResponseTypeReconnected || header.Type == dydx.ChannelResponseTypeGap || header.Type == dydx.ChannelResponseTypeStale:
+			frame.Synthetic = true
+			frame.Frame, err = json.Marshal(header)
+		case record.Orderbook != nil:
+			frame.Frame, err = json.Marshal(record.Orderbook)
+		default:
+			frame.Frame, err = json.Marshal(record.Trades)
+		}
+		if err != nil {
+			return count, err
+		}
+
+		line, err := json.Marshal(frame)
+		if err != nil {
+			return count, err
+		}
+		if _, err := output.Write(append(line, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, output.Flush()
+}
@@ -0,0 +1,390 @@
+package feedcodec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/fardream/go-dydx"
+)
+
+// Record is a response read by Decoder.
+type Record struct {
+	// ReceivedAt is the time the response was received, zero if unknown.
+	ReceivedAt time.Time
+	// Orderbook is set for the orderbook channel, and Trades for the trades channel.
+	Orderbook *dydx.OrderbookChannelResponse
+	Trades    *dydx.TradesChannelResponse
+}
+
+// Header returns the header of the response.
+func (r *Record) Header() *dydx.ChannelResponseHeader {
+	if r.Orderbook != nil {
+		return &r.Orderbook.ChannelResponseHeader
+	}
+	return &r.Trades.ChannelResponseHeader
+}
+
+// Decoder reads the responses written by Encoder.
+type Decoder struct {
+	r      *bufio.Reader
+	header Header
+	state  codecState
+}
+
+// NewDecoder reads the header from r.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	reader, ok := r.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
+	d := &Decoder{r: reader}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != Magic {
+		return nil, ErrInvalidMagic
+	}
+	version, err := d.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if version != Version {
+		return nil, fmt.Errorf("unsupported binary feed version: %d", version)
+	}
+	d.header.Version = int(version)
+	if d.header.Channel, err = d.readString(); err != nil {
+		return nil, err
+	}
+	if d.header.Market, err = d.readString(); err != nil {
+		return nil, err
+	}
+	if d.header.TickSize, err = d.readDecimalString(); err != nil {
+		return nil, err
+	}
+	if d.header.StepSize, err = d.readDecimalString(); err != nil {
+		return nil, err
+	}
+	if err := d.header.validate(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Header returns the header of the stream.
+func (d *Decoder) Header() *Header {
+	return &d.header
+}
+
+// Next returns the next response, or io.EOF at the end of the stream.
+// io.ErrUnexpectedEOF is returned if the stream ends in the middle of a response.
+func (d *Decoder) Next() (*Record, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	record, err := d.readRecord()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return record, err
+}
+
+func (d *Decoder) readRecord() (*Record, error) {
+	record := new(Record)
+	var h dydx.ChannelResponseHeader
+	if err := d.readHeader(record, &h); err != nil {
+		return nil, err
+	}
+
+	batched := h.Type == dydx.ChannelResponseTypeChannelBatchData
+	count := 1
+	if batched {
+		var err error
+		if count, err = d.readCount(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch d.header.Channel {
+	case dydx.OrderbookChannel:
+		resp := &dydx.OrderbookChannelResponse{ChannelResponseHeader: h}
+		for i := 0; i < count; i++ {
+			contents, err := d.readOrderbookContents()
+			if err != nil {
+				return nil, err
+			}
+			if batched {
+				resp.BatchContents = append(resp.BatchContents, contents)
+			} else {
+				resp.Contents = contents
+			}
+		}
+		record.Orderbook = resp
+	case dydx.TradesChannel:
+		resp := &dydx.TradesChannelResponse{ChannelResponseHeader: h}
+		for i := 0; i < count; i++ {
+			contents, err := d.readTradesContents()
+			if err != nil {
+				return nil, err
+			}
+			if batched {
+				resp.BatchContents = append(resp.BatchContents, contents)
+			} else {
+				resp.Contents = contents
+			}
+		}
+		record.Trades = resp
+	}
+
+	return record, nil
+}
+
+func (d *Decoder) readHeader(record *Record, h *dydx.ChannelResponseHeader) error {
+	flags, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	typeCode, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case typeCode == 0:
+		if h.Type, err = d.readString(); err != nil {
+			return err
+		}
+	case int(typeCode) < len(responseTypes):
+		h.Type = responseTypes[typeCode]
+	default:
+		return fmt.Errorf("unknown response type code: %d", typeCode)
+	}
+
+	if flags&recordHasReceivedAt != 0 {
+		receivedAt, err := d.readDelta(&d.state.receivedAt)
+		if err != nil {
+			return err
+		}
+		record.ReceivedAt = time.Unix(0, receivedAt).UTC()
+	}
+	if flags&recordHasConnectionID != 0 {
+		if d.state.connectionID, err = d.readString(); err != nil {
+			return err
+		}
+	}
+	h.ConnectionID = d.state.connectionID
+	messageID, err := d.readDelta(&d.state.messageID)
+	if err != nil {
+		return err
+	}
+	h.MessageID = int(messageID)
+	if flags&recordHasMessage != 0 {
+		if h.Message, err = d.readString(); err != nil {
+			return err
+		}
+	}
+	h.Channel, h.Id = d.header.Channel, d.header.Market
+	if flags&recordHasChannelAndID != 0 {
+		if h.Channel, err = d.readString(); err != nil {
+			return err
+		}
+		if h.Id, err = d.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) readOrderbookContents() (*dydx.OrderbookResponse, error) {
+	flags, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if flags&contentsPresent == 0 {
+		return nil, nil
+	}
+
+	contents := new(dydx.OrderbookResponse)
+	if flags&contentsHasOffset != 0 {
+		offset, err := d.readDelta(&d.state.offset)
+		if err != nil {
+			return nil, err
+		}
+		contents.Offset = &offset
+	}
+	if contents.Bids, err = d.readLevels(&d.state.bidPrice); err != nil {
+		return nil, err
+	}
+	if contents.Asks, err = d.readLevels(&d.state.askPrice); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+func (d *Decoder) readLevels(lastPrice *int64) ([]*dydx.OrderbookOrder, error) {
+	count, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make([]*dydx.OrderbookOrder, 0, count)
+	for i := 0; i < count; i++ {
+		flags, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		level := new(dydx.OrderbookOrder)
+		if level.Price, err = d.readScaled(flags&levelRawPrice != 0, d.header.TickSize, lastPrice); err != nil {
+			return nil, err
+		}
+		if level.Size, err = d.readScaled(flags&levelRawSize != 0, d.header.StepSize, nil); err != nil {
+			return nil, err
+		}
+		if flags&levelHasOffset != 0 {
+			offset, err := d.readDelta(&d.state.offset)
+			if err != nil {
+				return nil, err
+			}
+			level.Offset = &offset
+		}
+		level.PriceString = level.Price.String()
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func (d *Decoder) readTradesContents() (*dydx.TradesChannelResponseContents, error) {
+	flags, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if flags&contentsPresent == 0 {
+		return nil, nil
+	}
+
+	count, err := d.readCount()
+	if err != nil {
+		return nil, err
+	}
+	contents := &dydx.TradesChannelResponseContents{Trades: make([]dydx.Trade, 0, count)}
+	for i := 0; i < count; i++ {
+		var trade dydx.Trade
+		flags, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		sideCode := int(flags&tradeSideMask) >> tradeSideShift
+		switch {
+		case sideCode == 0:
+			if trade.Side, err = d.readString(); err != nil {
+				return nil, err
+			}
+		case sideCode < len(tradeSides):
+			trade.Side = tradeSides[sideCode]
+		default:
+			return nil, fmt.Errorf("unknown trade side code: %d", sideCode)
+		}
+
+		price, err := d.readScaled(flags&tradeRawPrice != 0, d.header.TickSize, &d.state.tradePrice)
+		if err != nil {
+			return nil, err
+		}
+		size, err := d.readScaled(flags&tradeRawSize != 0, d.header.StepSize, nil)
+		if err != nil {
+			return nil, err
+		}
+		trade.Price, trade.Size = *price, *size
+
+		if flags&tradeHasCreatedAt != 0 {
+			createdAt, err := d.readDelta(&d.state.tradeTime)
+			if err != nil {
+				return nil, err
+			}
+			trade.CreatedAt = time.Unix(0, createdAt).UTC()
+		}
+		contents.Trades = append(contents.Trades, trade)
+	}
+	return contents, nil
+}
+
+// readScaled reads a decimal stored as a string when raw is set, otherwise as the number of scales:
+// a delta from *last if last is not nil, or an unsigned varint.
+func (d *Decoder) readScaled(raw bool, scale *dydx.Decimal, last *int64) (*dydx.Decimal, error) {
+	if raw {
+		return d.readDecimalString()
+	}
+	if last != nil {
+		n, err := d.readDelta(last)
+		if err != nil {
+			return nil, err
+		}
+		return fromTicks(n, scale), nil
+	}
+	n, err := d.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("scaled value out of range: %d", n)
+	}
+	return fromTicks(int64(n), scale), nil
+}
+
+func (d *Decoder) readUvarint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+// readDelta reads a delta from *last, and sets *last to the value.
+func (d *Decoder) readDelta(last *int64) (int64, error) {
+	delta, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return 0, err
+	}
+	*last += delta
+	return *last, nil
+}
+
+// maxCount limits the number of items and the length of strings, so corrupted data doesn't allocate a huge slice.
+const maxCount = 1 << 20
+
+// readCount reads the number of items or the length of a string.
+func (d *Decoder) readCount() (int, error) {
+	n, err := d.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxCount {
+		return 0, fmt.Errorf("count out of range: %d", n)
+	}
+	return int(n), nil
+}
+
+func (d *Decoder) readString() (string, error) {
+	n, err := d.readCount()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *Decoder) readDecimalString() (*dydx.Decimal, error) {
+	s, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	v, err := dydx.NewDecimalFromString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decimal %q: %w", s, err)
+	}
+	return v, nil
+}
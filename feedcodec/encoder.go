@@ -0,0 +1,251 @@
+package feedcodec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fardream/go-dydx"
+)
+
+// Encoder writes the responses of one channel and market in the binary format.
+type Encoder struct {
+	w      io.Writer
+	header Header
+	state  codecState
+	buf    []byte
+}
+
+// NewEncoder writes the header to w, and returns an encoder for the responses of the header's channel.
+func NewEncoder(w io.Writer, header *Header) (*Encoder, error) {
+	if err := header.validate(); err != nil {
+		return nil, err
+	}
+	e := &Encoder{w: w, header: *header}
+	e.header.Version = Version
+
+	buf := append([]byte(nil), Magic...)
+	buf = binary.AppendUvarint(buf, Version)
+	buf = appendString(buf, header.Channel)
+	buf = appendString(buf, header.Market)
+	buf = appendString(buf, header.TickSize.String())
+	buf = appendString(buf, header.StepSize.String())
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Header returns the header of the stream.
+func (e *Encoder) Header() *Header {
+	return &e.header
+}
+
+// EncodeOrderbook writes an orderbook response received at receivedAt, which can be zero if unknown.
+func (e *Encoder) EncodeOrderbook(receivedAt time.Time, resp *dydx.OrderbookChannelResponse) error {
+	if e.header.Channel != dydx.OrderbookChannel {
+		return fmt.Errorf("cannot encode orderbook response to %s stream", e.header.Channel)
+	}
+	buf := e.appendHeader(e.buf[:0], receivedAt, &resp.ChannelResponseHeader)
+	if resp.Type == dydx.ChannelResponseTypeChannelBatchData {
+		buf = binary.AppendUvarint(buf, uint64(len(resp.BatchContents)))
+		for _, contents := range resp.BatchContents {
+			buf = e.appendOrderbookContents(buf, contents)
+		}
+	} else {
+		buf = e.appendOrderbookContents(buf, resp.Contents)
+	}
+	return e.write(buf)
+}
+
+// EncodeTrades writes a trades response received at receivedAt, which can be zero if unknown.
+func (e *Encoder) EncodeTrades(receivedAt time.Time, resp *dydx.TradesChannelResponse) error {
+	if e.header.Channel != dydx.TradesChannel {
+		return fmt.Errorf("cannot encode trades response to %s stream", e.header.Channel)
+	}
+	buf := e.appendHeader(e.buf[:0], receivedAt, &resp.ChannelResponseHeader)
+	if resp.Type == dydx.ChannelResponseTypeChannelBatchData {
+		buf = binary.AppendUvarint(buf, uint64(len(resp.BatchContents)))
+		for _, contents := range resp.BatchContents {
+			buf = e.appendTradesContents(buf, contents)
+		}
+	} else {
+		buf = e.appendTradesContents(buf, resp.Contents)
+	}
+	return e.write(buf)
+}
+
+func (e *Encoder) write(buf []byte) error {
+	e.buf = buf
+	_, err := e.w.Write(buf)
+	return err
+}
+
+func (e *Encoder) appendHeader(buf []byte, receivedAt time.Time, h *dydx.ChannelResponseHeader) []byte {
+	var flags byte
+	if !receivedAt.IsZero() {
+		flags |= recordHasReceivedAt
+	}
+	if h.ConnectionID != e.state.connectionID {
+		flags |= recordHasConnectionID
+	}
+	if h.Message != "" {
+		flags |= recordHasMessage
+	}
+	if h.Channel != e.header.Channel || h.Id != e.header.Market {
+		flags |= recordHasChannelAndID
+	}
+	buf = append(buf, flags)
+
+	typeCode := indexOf(responseTypes, h.Type)
+	buf = append(buf, byte(typeCode))
+	if typeCode == 0 {
+		buf = appendString(buf, h.Type)
+	}
+
+	if flags&recordHasReceivedAt != 0 {
+		buf = appendDelta(buf, receivedAt.UnixNano(), &e.state.receivedAt)
+	}
+	if flags&recordHasConnectionID != 0 {
+		buf = appendString(buf, h.ConnectionID)
+		e.state.connectionID = h.ConnectionID
+	}
+	buf = appendDelta(buf, int64(h.MessageID), &e.state.messageID)
+	if flags&recordHasMessage != 0 {
+		buf = appendString(buf, h.Message)
+	}
+	if flags&recordHasChannelAndID != 0 {
+		buf = appendString(buf, h.Channel)
+		buf = appendString(buf, h.Id)
+	}
+	return buf
+}
+
+func (e *Encoder) appendOrderbookContents(buf []byte, contents *dydx.OrderbookResponse) []byte {
+	if contents == nil {
+		return append(buf, 0)
+	}
+	var flags byte = contentsPresent
+	if contents.Offset != nil {
+		flags |= contentsHasOffset
+	}
+	buf = append(buf, flags)
+	if contents.Offset != nil {
+		buf = appendDelta(buf, *contents.Offset, &e.state.offset)
+	}
+	buf = e.appendLevels(buf, contents.Bids, &e.state.bidPrice)
+	buf = e.appendLevels(buf, contents.Asks, &e.state.askPrice)
+	return buf
+}
+
+// appendLevels writes the levels, and the prices are the deltas from the previous price of the side.
+// Nil levels and levels without price or size are dropped.
+func (e *Encoder) appendLevels(buf []byte, levels []*dydx.OrderbookOrder, lastPrice *int64) []byte {
+	count := 0
+	for _, v := range levels {
+		if isValidLevel(v) {
+			count++
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(count))
+
+	for _, v := range levels {
+		if !isValidLevel(v) {
+			continue
+		}
+		price, priceOk := toTicks(v.Price, e.header.TickSize)
+		size, sizeOk := toTicks(v.Size, e.header.StepSize)
+		sizeOk = sizeOk && size >= 0
+
+		var flags byte
+		if v.Offset != nil {
+			flags |= levelHasOffset
+		}
+		if !priceOk {
+			flags |= levelRawPrice
+		}
+		if !sizeOk {
+			flags |= levelRawSize
+		}
+		buf = append(buf, flags)
+
+		if priceOk {
+			buf = appendDelta(buf, price, lastPrice)
+		} else {
+			buf = appendString(buf, v.Price.String())
+		}
+		if sizeOk {
+			buf = binary.AppendUvarint(buf, uint64(size))
+		} else {
+			buf = appendString(buf, v.Size.String())
+		}
+		if v.Offset != nil {
+			buf = appendDelta(buf, *v.Offset, &e.state.offset)
+		}
+	}
+	return buf
+}
+
+func isValidLevel(v *dydx.OrderbookOrder) bool {
+	return v != nil && v.Price != nil && v.Size != nil
+}
+
+func (e *Encoder) appendTradesContents(buf []byte, contents *dydx.TradesChannelResponseContents) []byte {
+	if contents == nil {
+		return append(buf, 0)
+	}
+	buf = append(buf, contentsPresent)
+	buf = binary.AppendUvarint(buf, uint64(len(contents.Trades)))
+
+	for i := range contents.Trades {
+		trade := &contents.Trades[i]
+		price, priceOk := toTicks(&trade.Price, e.header.TickSize)
+		size, sizeOk := toTicks(&trade.Size, e.header.StepSize)
+		sizeOk = sizeOk && size >= 0
+		sideCode := indexOf(tradeSides, trade.Side)
+
+		flags := byte(sideCode << tradeSideShift)
+		if !priceOk {
+			flags |= tradeRawPrice
+		}
+		if !sizeOk {
+			flags |= tradeRawSize
+		}
+		if !trade.CreatedAt.IsZero() {
+			flags |= tradeHasCreatedAt
+		}
+		buf = append(buf, flags)
+
+		if sideCode == 0 {
+			buf = appendString(buf, trade.Side)
+		}
+		if priceOk {
+			buf = appendDelta(buf, price, &e.state.tradePrice)
+		} else {
+			buf = appendString(buf, trade.Price.String())
+		}
+		if sizeOk {
+			buf = binary.AppendUvarint(buf, uint64(size))
+		} else {
+			buf = appendString(buf, trade.Size.String())
+		}
+		if flags&tradeHasCreatedAt != 0 {
+			buf = appendDelta(buf, trade.CreatedAt.UnixNano(), &e.state.tradeTime)
+		}
+	}
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendDelta writes v - *last as a varint, and sets *last to v.
+func appendDelta(buf []byte, v int64, last *int64) []byte {
+	buf = binary.AppendVarint(buf, v-*last)
+	*last = v
+	return buf
+}
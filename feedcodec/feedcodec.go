@@ -0,0 +1,161 @@
+// Package feedcodec is a compact binary encoding of the orderbook and trades channel responses.
+//
+// A stream starts with a header: the magic "DYDXFEED", the version, the channel, the market,
+// and the tick size and step size of the market. The records follow, one for each response.
+//
+// The prices are stored as varint deltas of the number of ticks from the previous price of the same side,
+// and the sizes as the number of steps, so a price level of an update usually takes 3 to 5 bytes.
+// The offsets, message ids, receive timestamps and trade times are varint deltas from the previous values.
+// Values that are not multiples of the tick or step size are stored as strings, so any response can be encoded.
+//
+// The decoded decimals are numerically equal to the encoded ones, but trailing zeros are not kept ("0.0010" is decoded as "0.001").
+package feedcodec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+
+	"github.com/cockroachdb/apd/v3"
+	"github.com/fardream/go-dydx"
+)
+
+// Magic is the first bytes of a stream.
+const Magic = "DYDXFEED"
+
+// Version is the version of the format written by Encoder.
+const Version = 1
+
+// ErrInvalidMagic is returned by NewDecoder when the stream doesn't start with Magic.
+var ErrInvalidMagic = errors.New("not a binary feed: invalid magic")
+
+// Header describes the responses of a stream.
+type Header struct {
+	// Version of the format. It is set by NewDecoder, and ignored by NewEncoder.
+	Version int
+	// Channel is dydx.OrderbookChannel or dydx.TradesChannel.
+	Channel string
+	// Market is the id of the subscription, such as BTC-USD.
+	Market string
+	// TickSize scales the prices, and StepSize scales the sizes. Use the values from dydx.Market.
+	TickSize *dydx.Decimal
+	StepSize *dydx.Decimal
+}
+
+func (h *Header) validate() error {
+	if h.Channel != dydx.OrderbookChannel && h.Channel != dydx.TradesChannel {
+		return fmt.Errorf("unsupported channel: %q", h.Channel)
+	}
+	if h.TickSize == nil || h.TickSize.Sign() <= 0 {
+		return fmt.Errorf("tick size must be positive: %v", h.TickSize)
+	}
+	if h.StepSize == nil || h.StepSize.Sign() <= 0 {
+		return fmt.Errorf("step size must be positive: %v", h.StepSize)
+	}
+	return nil
+}
+
+// IsBinaryFeed checks if the reader starts with Magic without consuming it.
+func IsBinaryFeed(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(Magic))
+	return string(b) == Magic
+}
+
+// responseTypes are the types of the responses stored as a code, which is the index. Code 0 is followed by the type as a string.
+// New types must be appended.
+var responseTypes = []string{
+	"",
+	dydx.ChannelResponseTypeSubscribe,
+	dydx.ChannelResponseTypeUnsubscribe,
+	dydx.ChannelResponseTypeError,
+	dydx.ChannelResponseTypeConnected,
+	dydx.ChannelResponseTypeChannelData,
+	dydx.ChannelResponseTypeChannelBatchData,
+	dydx.ChannelResponseTypeReconnected,
+	dydx.ChannelResponseTypeGap,
+	dydx.ChannelResponseTypeResync,
+	dydx.ChannelResponseTypeStale,
+}
+
+// flags of a record.
+const (
+	recordHasReceivedAt = 1 << iota
+	recordHasConnectionID
+	recordHasMessage
+	// recordHasChannelAndID is set when the channel and id are different from the header.
+	recordHasChannelAndID
+)
+
+// flags of the contents.
+const (
+	contentsPresent = 1 << iota
+	contentsHasOffset
+)
+
+// flags of an orderbook level.
+const (
+	levelHasOffset = 1 << iota
+	levelRawPrice
+	levelRawSize
+)
+
+// flags of a trade. The side is stored in the bits of tradeSideMask.
+const (
+	tradeRawPrice = 1 << iota
+	tradeRawSize
+	tradeHasCreatedAt
+	tradeSideShift = 3
+	tradeSideMask  = 3 << tradeSideShift
+)
+
+// tradeSides are the sides of the trades stored as a code, which is the index. Code 0 is followed by the side as a string.
+var tradeSides = []string{"", string(dydx.OrderSideBuy), string(dydx.OrderSideSell)}
+
+func indexOf(values []string, v string) int {
+	for i := 1; i < len(values); i++ {
+		if values[i] == v {
+			return i
+		}
+	}
+	return 0
+}
+
+// codecState is the previous values the deltas are based on, which are updated the same way by Encoder and Decoder.
+type codecState struct {
+	receivedAt   int64
+	messageID    int64
+	connectionID string
+	offset       int64
+	bidPrice     int64
+	askPrice     int64
+	tradePrice   int64
+	tradeTime    int64
+}
+
+// scaleContext is large enough for the multiplications and divisions by the tick size and step size to be exact.
+var scaleContext = apd.BaseContext.WithPrecision(64)
+
+// toTicks returns v / scale if it is an integer in the range of int64.
+func toTicks(v *dydx.Decimal, scale *dydx.Decimal) (int64, bool) {
+	if v.Form != apd.Finite {
+		return 0, false
+	}
+	var q apd.Decimal
+	cond, err := scaleContext.Quo(&q, &v.Decimal, &scale.Decimal)
+	if err != nil || cond.Inexact() {
+		return 0, false
+	}
+	n, err := q.Int64()
+	return n, err == nil
+}
+
+// fromTicks returns n * scale without trailing zeros.
+func fromTicks(n int64, scale *dydx.Decimal) *dydx.Decimal {
+	var r dydx.Decimal
+	r.SetInt64(n)
+	if _, err := scaleContext.Mul(&r.Decimal, &r.Decimal, &scale.Decimal); err != nil {
+		panic(err)
+	}
+	r.Reduce(&r.Decimal)
+	return &r
+}
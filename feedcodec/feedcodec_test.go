@@ -0,0 +1,324 @@
+package feedcodec_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/feedcodec"
+	"github.com/google/go-cmp/cmp"
+)
+
+// equateDecimals compares the decimals numerically, since the trailing zeros are not kept.
+var equateDecimals = cmp.Comparer(func(a, b dydx.Decimal) bool {
+	return a.Cmp(&b.Decimal) == 0
+})
+
+func mustDecimal(t *testing.T, s string) *dydx.Decimal {
+	t.Helper()
+	v, err := dydx.NewDecimalFromString(s)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", s, err)
+	}
+	return v
+}
+
+func newHeader(t *testing.T, channel string) *feedcodec.Header {
+	return &feedcodec.Header{Channel: channel, Market: "BTC-USD", TickSize: mustDecimal(t, "1"), StepSize: mustDecimal(t, "0.0001")}
+}
+
+func newLevel(t *testing.T, price, size string, offset *int64) *dydx.OrderbookOrder {
+	p := mustDecimal(t, price)
+	return &dydx.OrderbookOrder{Price: p, Size: mustDecimal(t, size), Offset: offset, PriceString: p.String()}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func decodeAll(t *testing.T, data []byte) (*feedcodec.Header, []*feedcodec.Record) {
+	t.Helper()
+	decoder, err := feedcodec.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+	var records []*feedcodec.Record
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return decoder.Header(), records
+		}
+		if err != nil {
+			t.Fatalf("failed to decode record %d: %v", len(records), err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestOrderbookRoundTrip(t *testing.T) {
+	jsonData, err := os.ReadFile("../tests/orderbook.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updates []*dydx.OrderbookChannelResponse
+	if err := json.Unmarshal(jsonData, &updates); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := feedcodec.NewEncoder(&buf, newHeader(t, dydx.OrderbookChannel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 10, 1, 0, 0, 0, 123456789, time.UTC)
+	for i, v := range updates {
+		if err := encoder.EncodeOrderbook(start.Add(time.Duration(i)*time.Millisecond), v); err != nil {
+			t.Fatalf("failed to encode update %d: %v", i, err)
+		}
+	}
+
+	var jsonLines bytes.Buffer
+	for _, v := range updates {
+		line, _ := json.Marshal(v)
+		jsonLines.Write(append(line, '\n'))
+	}
+	if buf.Len()*5 > jsonLines.Len() {
+		t.Errorf("binary size %d is not less than 1/5 of json lines size %d", buf.Len(), jsonLines.Len())
+	}
+
+	header, records := decodeAll(t, buf.Bytes())
+	if diff := cmp.Diff(&feedcodec.Header{Version: feedcodec.Version, Channel: dydx.OrderbookChannel, Market: "BTC-USD", TickSize: mustDecimal(t, "1"), StepSize: mustDecimal(t, "0.0001")}, header, equateDecimals); diff != "" {
+		t.Errorf("header mismatch (-want +got):\n%s", diff)
+	}
+	if len(records) != len(updates) {
+		t.Fatalf("want %d records, got %d", len(updates), len(records))
+	}
+	for i, record := range records {
+		if !record.ReceivedAt.Equal(start.Add(time.Duration(i) * time.Millisecond)) {
+			t.Errorf("record %d: wrong receive time %v", i, record.ReceivedAt)
+		}
+		if diff := cmp.Diff(updates[i], record.Orderbook, equateDecimals); diff != "" {
+			t.Fatalf("record %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestOrderbookSpecialValues(t *testing.T) {
+	updates := []*dydx.OrderbookChannelResponse{
+		{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeConnected, ConnectionID: "conn-1"}},
+		{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe, Channel: dydx.OrderbookChannel, ConnectionID: "conn-1", MessageID: 1, Id: "BTC-USD"},
+			Contents: &dydx.OrderbookResponse{
+				Bids: []*dydx.OrderbookOrder{newLevel(t, "20000", "1.5", int64Ptr(100)), newLevel(t, "19999.5", "0.00001", int64Ptr(90))},
+				Asks: []*dydx.OrderbookOrder{newLevel(t, "20001", "2", int64Ptr(80))},
+			},
+		},
+		{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelBatchData, Channel: dydx.OrderbookChannel, ConnectionID: "conn-1", MessageID: 2, Id: "BTC-USD"},
+			BatchContents: []*dydx.OrderbookResponse{
+				{Offset: int64Ptr(101), Bids: []*dydx.OrderbookOrder{newLevel(t, "20000", "0", nil)}, Asks: []*dydx.OrderbookOrder{}},
+				{Offset: int64Ptr(99), Bids: []*dydx.OrderbookOrder{}, Asks: []*dydx.OrderbookOrder{newLevel(t, "19990", "-1", nil)}},
+			},
+		},
+		{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeReconnected, Channel: dydx.OrderbookChannel, Id: "BTC-USD"}},
+		{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: "unknown_type", Channel: dydx.OrderbookChannel, ConnectionID: "conn-2", MessageID: 1, Id: "BTC-USD", Message: "some message"}},
+	}
+
+	var buf bytes.Buffer
+	encoder, err := feedcodec.NewEncoder(&buf, newHeader(t, dydx.OrderbookChannel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range updates {
+		if err := encoder.EncodeOrderbook(time.Time{}, v); err != nil {
+			t.Fatalf("failed to encode update %d: %v", i, err)
+		}
+	}
+	if err := encoder.EncodeTrades(time.Time{}, &dydx.TradesChannelResponse{}); err == nil {
+		t.Errorf("trades response is encoded to orderbook stream")
+	}
+
+	_, records := decodeAll(t, buf.Bytes())
+	if len(records) != len(updates) {
+		t.Fatalf("want %d records, got %d", len(updates), len(records))
+	}
+	for i, record := range records {
+		if !record.ReceivedAt.IsZero() {
+			t.Errorf("record %d: want zero receive time, got %v", i, record.ReceivedAt)
+		}
+		if diff := cmp.Diff(updates[i], record.Orderbook, equateDecimals); diff != "" {
+			t.Errorf("record %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestTradesRoundTrip(t *testing.T) {
+	createdAt := time.Date(2022, 10, 1, 0, 0, 0, 5000000, time.UTC)
+	updates := []*dydx.TradesChannelResponse{
+		{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe, Channel: dydx.TradesChannel, ConnectionID: "conn-1", MessageID: 1, Id: "BTC-USD"},
+			Contents: &dydx.TradesChannelResponseContents{Trades: []dydx.Trade{
+				{Side: string(dydx.OrderSideBuy), Size: *mustDecimal(t, "0.01"), Price: *mustDecimal(t, "20000"), CreatedAt: createdAt},
+				{Side: string(dydx.OrderSideSell), Size: *mustDecimal(t, "0.00001"), Price: *mustDecimal(t, "19999.5"), CreatedAt: createdAt.Add(-time.Second)},
+			}},
+		},
+		{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelBatchData, Channel: dydx.TradesChannel, ConnectionID: "conn-1", MessageID: 2, Id: "BTC-USD"},
+			BatchContents: []*dydx.TradesChannelResponseContents{
+				{Trades: []dydx.Trade{{Side: "OTHER", Size: *mustDecimal(t, "1"), Price: *mustDecimal(t, "20001")}}},
+				{Trades: []dydx.Trade{}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	encoder, err := feedcodec.NewEncoder(&buf, newHeader(t, dydx.TradesChannel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range updates {
+		if err := encoder.EncodeTrades(createdAt, v); err != nil {
+			t.Fatalf("failed to encode update %d: %v", i, err)
+		}
+	}
+
+	_, records := decodeAll(t, buf.Bytes())
+	if len(records) != len(updates) {
+		t.Fatalf("want %d records, got %d", len(updates), len(records))
+	}
+	for i, record := range records {
+		if diff := cmp.Diff(updates[i], record.Trades, equateDecimals); diff != "" {
+			t.Errorf("record %d mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	if _, err := feedcodec.NewDecoder(strings.NewReader(`[{"type":"subscribed"}]`)); !errors.Is(err, feedcodec.ErrInvalidMagic) {
+		t.Errorf("want ErrInvalidMagic, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	encoder, err := feedcodec.NewEncoder(&buf, newHeader(t, dydx.OrderbookChannel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := buf.Len()
+	err = encoder.EncodeOrderbook(time.Now(), &dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelData, Channel: dydx.OrderbookChannel, Id: "BTC-USD"},
+		Contents:              &dydx.OrderbookResponse{Offset: int64Ptr(1), Bids: []*dydx.OrderbookOrder{newLevel(t, "20000", "1", nil)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := feedcodec.NewDecoder(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoder.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("want io.ErrUnexpectedEOF for truncated record, got %v", err)
+	}
+
+	decoder, err = feedcodec.NewDecoder(bytes.NewReader(buf.Bytes()[:headerSize]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoder.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("want io.EOF for empty stream, got %v", err)
+	}
+
+	if _, err := feedcodec.NewEncoder(io.Discard, &feedcodec.Header{Channel: dydx.MarketsChannel, TickSize: mustDecimal(t, "1"), StepSize: mustDecimal(t, "1")}); err == nil {
+		t.Errorf("markets channel is accepted")
+	}
+	if _, err := feedcodec.NewEncoder(io.Discard, &feedcodec.Header{Channel: dydx.TradesChannel, TickSize: mustDecimal(t, "0"), StepSize: mustDecimal(t, "1")}); err == nil {
+		t.Errorf("zero tick size is accepted")
+	}
+}
+
+func TestJsonConversion(t *testing.T) {
+	receivedAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	recording := strings.Join([]string{
+		`{"received_at":"2022-10-01T00:00:00Z","frame":{"type":"connected","connection_id":"conn-1","message_id":0}}`,
+		`{"received_at":"2022-10-01T00:00:00Z","frame":{"type":"subscribed","connection_id":"conn-1","message_id":1,"channel":"v3_orderbook","id":"BTC-USD","contents":{"bids":[{"price":"20000","size":"1.5","offset":"10"}],"asks":[{"price":"20001","size":"2","offset":"11"}]}}}`,
+		`{"received_at":"2022-10-01T00:00:00.001Z","frame":{"type":"subscribed","connection_id":"conn-1","message_id":2,"channel":"v3_orderbook","id":"ETH-USD","contents":{"bids":[],"asks":[]}}}`,
+		`{"received_at":"2022-10-01T00:00:00.002Z","frame":{"type":"channel_batch_data","connection_id":"conn-1","message_id":3,"channel":"v3_orderbook","id":"BTC-USD","contents":[{"offset":"12","bids":[["20000","0"]],"asks":[]},{"offset":"13","bids":[],"asks":[["20002","1"]]}]}}`,
+		`{"received_at":"2022-10-01T00:00:00.003Z","synthetic":true,"frame":{"type":"reconnected","channel":"v3_orderbook","id":"BTC-USD"}}`,
+		`{"received_at":"2022-10-01T00:00:00.004Z","synthetic":true,"frame":{"type":"stale","channel":"v3_orderbook","id":"BTC-USD"}}`,
+	}, "\n")
+
+	var binaryData bytes.Buffer
+	n, err := feedcodec.FromJson(&binaryData, strings.NewReader(recording), newHeader(t, dydx.OrderbookChannel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("want 4 responses converted, got %d", n)
+	}
+	if !feedcodec.IsBinaryFeed(bufio.NewReader(bytes.NewReader(binaryData.Bytes()))) {
+		t.Errorf("converted data is not detected as binary feed")
+	}
+
+	var jsonData bytes.Buffer
+	n, err = feedcodec.ToJson(&jsonData, bytes.NewReader(binaryData.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Fatalf("want 4 responses converted back, got %d", n)
+	}
+
+	reader := dydx.NewRecordedFrameReader(bytes.NewReader(jsonData.Bytes()))
+	var frames []*dydx.RecordedFrame
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("want 4 frames, got %d", len(frames))
+	}
+	for i, offset := range []time.Duration{0, 2 * time.Millisecond, 3 * time.Millisecond, 4 * time.Millisecond} {
+		if !frames[i].ReceivedAt.Equal(receivedAt.Add(offset)) {
+			t.Errorf("frame %d: wrong receive time %v", i, frames[i].ReceivedAt)
+		}
+	}
+	if !frames[2].Synthetic || !frames[3].Synthetic {
+		t.Errorf("reconnected and stale frames are not synthetic")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outputChan := make(chan *dydx.OrderbookChannelResponse, 10)
+	if err := dydx.ReplayRecording(ctx, bytes.NewReader(jsonData.Bytes()), dydx.OrderbookChannel, "BTC-USD", outputChan); err != nil {
+		t.Fatal(err)
+	}
+	close(outputChan)
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true)
+	var types []string
+	for resp := range outputChan {
+		types = append(types, resp.Type)
+		if resp.Type != dydx.ChannelResponseTypeReconnected && resp.Type != dydx.ChannelResponseTypeStale {
+			ob.Process(resp)
+		}
+	}
+	if diff := cmp.Diff([]string{dydx.ChannelResponseTypeSubscribe, dydx.ChannelResponseTypeChannelBatchData, dydx.ChannelResponseTypeReconnected, dydx.ChannelResponseTypeStale}, types); diff != "" {
+		t.Errorf("replayed types mismatch (-want +got):\n%s", diff)
+	}
+	if ob.Bids.Len() != 0 || ob.Asks.Len() != 2 {
+		t.Errorf("wrong book after replay: bids %s asks %s", ob.Bids.PrintBook(), ob.Asks.PrintBook())
+	}
+}
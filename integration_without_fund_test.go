@@ -33,13 +33,13 @@ func ExampleClient_CreateUser() {
 	signer := dydx.NewEcdsaPrivateKeySigner(privateKey)
 
 	// stark key
-	starkKey, err := dydx.DeriveStarkKey(signer, createUserIsMainnet)
+	starkKey, err := dydx.DeriveStarkKey(signer, createUserIsMainnet, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		panic(err)
 	}
 
 	// api key
-	apiKey, err := dydx.RecoverDefaultApiKeyCredentials(signer, false)
+	apiKey, err := dydx.RecoverDefaultApiKeyCredentials(signer, false, dydx.SignatureTypeNoPrepend)
 	if err != nil {
 		panic(err)
 	}
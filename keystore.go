@@ -0,0 +1,247 @@
+package dydx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// KeyStore holds the stark key, api key and ethereum address together.
+// It is saved to disk encrypted, see EncryptKeyStore.
+type KeyStore struct {
+	EthAddress string    `json:"ethAddress,omitempty"`
+	StarkKey   *StarkKey `json:"starkKey,omitempty"`
+	ApiKey     *ApiKey   `json:"apiKey,omitempty"`
+}
+
+const (
+	keyStoreVersion = 1
+	keyStoreCipher  = "aes-256-gcm"
+	keyStoreKdf     = "scrypt"
+
+	keyStoreScryptR     = 8
+	keyStoreScryptDKLen = 32
+
+	// limits of the scrypt parameters read from a keystore, scrypt takes 128*r*n bytes of memory.
+	keyStoreMaxScryptN      = 1 << 20
+	keyStoreMaxScryptMemory = 1 << 30
+)
+
+// scrypt parameters, same as go-ethereum's keystore.
+const (
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	LightScryptN    = 1 << 12
+	LightScryptP    = 6
+)
+
+// KeyStorePassphraseEnv is the environment variable to read the passphrase of the encrypted keystore from.
+const KeyStorePassphraseEnv = "GODYDX_KEYSTORE_PASSPHRASE"
+
+// encryptedKeyStore is the format of the encrypted keystore on disk, modeled after ethereum's keystore v3.
+// Instead of aes-128-ctr and a keccak mac, aes-256-gcm is used, which authenticates the cipher text.
+type encryptedKeyStore struct {
+	Version    int    `json:"version"`
+	EthAddress string `json:"ethAddress,omitempty"`
+	Crypto     struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			Nonce string `json:"nonce"`
+		} `json:"cipherparams"`
+		Kdf       string `json:"kdf"`
+		KdfParams struct {
+			N     int    `json:"n"`
+			R     int    `json:"r"`
+			P     int    `json:"p"`
+			DKLen int    `json:"dklen"`
+			Salt  string `json:"salt"`
+		} `json:"kdfparams"`
+	} `json:"crypto"`
+}
+
+func newKeyStoreAead(passphrase string, salt []byte, n, r, p, dkLen int) (cipher.AEAD, error) {
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, n, r, p, dkLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkScryptParams rejects the scrypt parameters of a crafted keystore that would exhaust the memory.
+func checkScryptParams(n, r, p, dkLen int) error {
+	if dkLen != keyStoreScryptDKLen {
+		return fmt.Errorf("unsupported scrypt dklen: %d", dkLen)
+	}
+	if n <= 1 || n&(n-1) != 0 || n > keyStoreMaxScryptN {
+		return fmt.Errorf("scrypt n must be a power of 2 no larger than %d: %d", keyStoreMaxScryptN, n)
+	}
+	if r <= 0 || p <= 0 || r*p >= 1<<30 {
+		return fmt.Errorf("invalid scrypt r and p: %d, %d", r, p)
+	}
+	if r > keyStoreMaxScryptMemory/128/n {
+		return fmt.Errorf("scrypt n and r take more than %d bytes of memory: %d, %d", keyStoreMaxScryptMemory, n, r)
+	}
+	return nil
+}
+
+// EncryptKeyStore encrypts the keystore with the passphrase.
+// Use StandardScryptN/StandardScryptP, or LightScryptN/LightScryptP for less memory and cpu.
+func EncryptKeyStore(ks *KeyStore, passphrase string, scryptN, scryptP int) ([]byte, error) {
+	plaintext, err := json.Marshal(ks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keystore: %w", err)
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := newKeyStoreAead(passphrase, salt, scryptN, keyStoreScryptR, scryptP, keyStoreScryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	r := &encryptedKeyStore{Version: keyStoreVersion, EthAddress: ks.EthAddress}
+	r.Crypto.Cipher = keyStoreCipher
+	r.Crypto.CipherText = hex.EncodeToString(aead.Seal(nil, nonce, plaintext, nil))
+	r.Crypto.CipherParams.Nonce = hex.EncodeToString(nonce)
+	r.Crypto.Kdf = keyStoreKdf
+	r.Crypto.KdfParams.N = scryptN
+	r.Crypto.KdfParams.R = keyStoreScryptR
+	r.Crypto.KdfParams.P = scryptP
+	r.Crypto.KdfParams.DKLen = keyStoreScryptDKLen
+	r.Crypto.KdfParams.Salt = hex.EncodeToString(salt)
+
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DecryptKeyStore decrypts the keystore encrypted by EncryptKeyStore.
+func DecryptKeyStore(data []byte, passphrase string) (*KeyStore, error) {
+	var r encryptedKeyStore
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("cannot parse json: %w", err)
+	}
+	if r.Version != keyStoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version: %d", r.Version)
+	}
+	if r.Crypto.Cipher != keyStoreCipher {
+		return nil, fmt.Errorf("unsupported cipher: %s", r.Crypto.Cipher)
+	}
+	if r.Crypto.Kdf != keyStoreKdf {
+		return nil, fmt.Errorf("unsupported kdf: %s", r.Crypto.Kdf)
+	}
+
+	kdf := r.Crypto.KdfParams
+	if err := checkScryptParams(kdf.N, kdf.R, kdf.P, kdf.DKLen); err != nil {
+		return nil, err
+	}
+
+	salt, err := hex.DecodeString(kdf.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	nonce, err := hex.DecodeString(r.Crypto.CipherParams.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := hex.DecodeString(r.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cipher text: %w", err)
+	}
+
+	aead, err := newKeyStoreAead(passphrase, salt, kdf.N, kdf.R, kdf.P, kdf.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size: %d", len(nonce))
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt keystore with given passphrase")
+	}
+
+	ks := new(KeyStore)
+	if err := json.Unmarshal(plaintext, ks); err != nil {
+		return nil, fmt.Errorf("cannot parse decrypted keystore: %w", err)
+	}
+
+	return ks, nil
+}
+
+// IsEncryptedKeyStore checks if the data is in the format of the encrypted keystore.
+func IsEncryptedKeyStore(data []byte) bool {
+	var r encryptedKeyStore
+	if err := json.Unmarshal(data, &r); err != nil {
+		return false
+	}
+	return r.Version != 0 && r.Crypto.Kdf != "" && r.Crypto.CipherText != ""
+}
+
+// LoadKeyStore reads and decrypts the keystore file.
+func LoadKeyStore(filename, passphrase string) (*KeyStore, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKeyStore(data, passphrase)
+}
+
+// SaveKeyStore encrypts the keystore with standard scrypt parameters and saves it to the file, which is only readable by the user.
+func SaveKeyStore(filename string, ks *KeyStore, passphrase string) error {
+	data, err := EncryptKeyStore(ks, passphrase, StandardScryptN, StandardScryptP)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o600)
+}
+
+// GetKeyStorePassphrase reads the passphrase from the environment variable KeyStorePassphraseEnv,
+// or prompts for it on the terminal if the environment variable is not set.
+func GetKeyStorePassphrase(prompt string) (string, error) {
+	if v, ok := os.LookupEnv(KeyStorePassphraseEnv); ok {
+		return v, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%s is not set and stdin is not a terminal", KeyStorePassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+	passphrase, err := term.ReadPassword(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	return string(passphrase), nil
+}
+
+// DecryptKeyStoreWithPrompt decrypts the keystore with the passphrase from GetKeyStorePassphrase.
+func DecryptKeyStoreWithPrompt(filename string, data []byte) (*KeyStore, error) {
+	passphrase, err := GetKeyStorePassphrase(fmt.Sprintf("passphrase for %s: ", filename))
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKeyStore(data, passphrase)
+}
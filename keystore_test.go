@@ -0,0 +1,95 @@
+package dydx_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+func TestKeyStore(t *testing.T) {
+	ks := &dydx.KeyStore{
+		EthAddress: "0x1234567890123456789012345678901234567890",
+		StarkKey:   dydx.NewStarkKey(mockStarkPublicKey, "", mockStarkPrivateKey),
+		ApiKey:     dydx.NewApiKey("9fee0aab-870e-fea8-d724-29d1016e951e", "vydswDsZ8GjD9ARqfz02", "8k1btcHszt_6ShxTzSt1FRq5NwxaiIxhi9TTQclx"),
+	}
+
+	data, err := dydx.EncryptKeyStore(ks, "passphrase", dydx.LightScryptN, dydx.LightScryptP)
+	if err != nil {
+		t.Fatalf("failed to encrypt keystore: %v", err)
+	}
+	if !dydx.IsEncryptedKeyStore(data) {
+		t.Fatalf("encrypted data is not recognized as a keystore: %s", data)
+	}
+
+	if _, err := dydx.DecryptKeyStore(data, "wrong passphrase"); err == nil {
+		t.Fatalf("expecting error for wrong passphrase")
+	}
+
+	decrypted, err := dydx.DecryptKeyStore(data, "passphrase")
+	if err != nil {
+		t.Fatalf("failed to decrypt keystore: %v", err)
+	}
+	if !cmp.Equal(ks, decrypted) {
+		t.Fatalf("expecting %s, got %s", spewConfig.Sdump(ks), spewConfig.Sdump(decrypted))
+	}
+
+	filename := filepath.Join(t.TempDir(), "keystore.json")
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatalf("failed to write keystore: %v", err)
+	}
+	t.Setenv(dydx.KeyStorePassphraseEnv, "passphrase")
+	var starkKey dydx.StarkKey
+	if err := starkKey.Set(filename); err != nil {
+		t.Fatalf("failed to read stark key from keystore: %v", err)
+	}
+	if !cmp.Equal(ks.StarkKey, &starkKey) {
+		t.Fatalf("expecting %s, got %s", spewConfig.Sdump(ks.StarkKey), spewConfig.Sdump(starkKey))
+	}
+	var apiKey dydx.ApiKey
+	if err := apiKey.Set(filename); err != nil {
+		t.Fatalf("failed to read api key from keystore: %v", err)
+	}
+	if !cmp.Equal(ks.ApiKey, &apiKey) {
+		t.Fatalf("expecting %s, got %s", spewConfig.Sdump(ks.ApiKey), spewConfig.Sdump(apiKey))
+	}
+}
+
+func TestKeyStoreScryptParams(t *testing.T) {
+	data, err := dydx.EncryptKeyStore(&dydx.KeyStore{EthAddress: "0x1234567890123456789012345678901234567890"}, "passphrase", dydx.LightScryptN, dydx.LightScryptP)
+	if err != nil {
+		t.Fatalf("failed to encrypt keystore: %v", err)
+	}
+
+	for _, params := range []map[string]int{
+		{"dklen": 64},
+		{"dklen": 0},
+		{"n": 1 << 21},
+		{"n": 1<<12 + 1},
+		{"n": 0},
+		{"r": 0},
+		{"p": -1},
+		{"r": 1 << 15, "p": 1 << 15},
+		{"n": 1 << 20, "r": 16},
+	} {
+		var m map[string]any
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		kdfParams := m["crypto"].(map[string]any)["kdfparams"].(map[string]any)
+		for k, v := range params {
+			kdfParams[k] = v
+		}
+		crafted, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dydx.DecryptKeyStore(crafted, "passphrase"); err == nil {
+			t.Errorf("expecting error for scrypt parameters %v", params)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package dydx
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	// ErrWsReadTimeout is returned when nothing (including pong) is received on the connection within the read timeout.
+	// The connection is likely half-open.
+	ErrWsReadTimeout = errors.New("websocket read timed out")
+	// ErrSubscriptionStale is returned when no message is received for the subscription within the stale timeout,
+	// even after the subscription is renewed. See SetSubscriptionStaleTimeout.
+	ErrSubscriptionStale = errors.New("websocket subscription is stale")
+)
+
+// ChannelResponseTypeStale is not sent by the server. It is sent to the output channel when no message is received for the
+// subscription within the stale timeout, see SetSubscriptionStaleTimeout.
+const ChannelResponseTypeStale = "stale"
+
+// Default keep alive of the websocket connection: a ping is sent every 15 seconds, and the connection is considered lost
+// if nothing is received in 45 seconds.
+const (
+	DefaultWsPingInterval = 15 * time.Second
+	DefaultWsReadTimeout  = 45 * time.Second
+)
+
+type wsConnectionOption func(w *WsConnection)
+
+// SetWsKeepAlive sets the interval of the pings and the read timeout of the connection.
+// Each message or pong received extends the read deadline by readTimeout. 0 disables the ping or the read timeout.
+func SetWsKeepAlive(pingInterval, readTimeout time.Duration) wsConnectionOption {
+	return func(w *WsConnection) {
+		w.pingInterval = pingInterval
+		w.readTimeout = readTimeout
+	}
+}
+
+// SetClientWsConnectionOptions sets the options for the websocket connection shared by the subscriptions of the client.
+func SetClientWsConnectionOptions(options ...wsConnectionOption) clientOption {
+	return func(c *Client) {
+		c.wsConnectionOptions = options
+	}
+}
+
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
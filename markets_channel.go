@@ -19,6 +19,14 @@ type (
 	MarketsChannelResponse         = ChannelResponse[MarketsChannelResponseContents]
 )
 
-func (c *Client) SubscribeMarkets(ctx context.Context, outputChan chan<- *MarketsChannelResponse) error {
-	return subscribeForType(ctx, c.wsUrl, newMarketsChannelRequest(), newUnsubscribeRequest(MarketsChannel, ""), outputChan)
+func (c *Client) SubscribeMarkets(ctx context.Context, outputChan chan<- *MarketsChannelResponse, options ...SubscriptionOption) error {
+	return c.getWsConnection().SubscribeMarkets(ctx, outputChan, options...)
+}
+
+// SubscribeMarketsWithHandler starts the markets subscription in the background and sends the updates to the handler.
+// It returns after the subscription is acknowledged. See StartSubscription.
+func (c *Client) SubscribeMarketsWithHandler(ctx context.Context, handler SubscriptionHandler[MarketsChannelResponseContents], options ...SubscriptionOption) (*Subscription, error) {
+	return StartSubscription(ctx, func(ctx context.Context, outputChan chan<- *MarketsChannelResponse) error {
+		return c.SubscribeMarkets(ctx, outputChan, options...)
+	}, handler)
 }
@@ -0,0 +1,273 @@
+package dydx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/fardream/decimal"
+)
+
+var (
+	// ErrEmptyOrderbook is returned when the side(s) of the book needed for the calculation is empty.
+	ErrEmptyOrderbook = errors.New("order book is empty")
+	// ErrInsufficientDepth is returned by EstimateFill when the book cannot fill the whole size.
+	ErrInsufficientDepth = errors.New("insufficient depth in order book")
+)
+
+var (
+	decimalTwo = decimal.NewFromInt(2)
+	bpsPerOne  = decimal.NewFromInt(10000)
+)
+
+// OrderbookLevels is an order book whose price levels can be iterated from the best price to the worst price.
+// It is implemented by OrderbookProcessor and OrderbookResponse.
+type OrderbookLevels interface {
+	IterateBids(f func(*OrderbookOrder) bool)
+	IterateAsks(f func(*OrderbookOrder) bool)
+}
+
+var (
+	_ OrderbookLevels = (*OrderbookProcessor)(nil)
+	_ OrderbookLevels = (*OrderbookResponse)(nil)
+)
+
+// IterateBids calls f on the bids from the highest price to the lowest price until f returns false.
+func (ob *OrderbookProcessor) IterateBids(f func(*OrderbookOrder) bool) {
+	ob.Bids.Iterate(f)
+}
+
+// IterateAsks calls f on the asks from the lowest price to the highest price until f returns false.
+func (ob *OrderbookProcessor) IterateAsks(f func(*OrderbookOrder) bool) {
+	ob.Asks.Iterate(f)
+}
+
+// IterateBids calls f on the bids from the highest price to the lowest price until f returns false.
+// Levels with zero size are skipped.
+func (r *OrderbookResponse) IterateBids(f func(*OrderbookOrder) bool) {
+	iterateLevels(r.Bids, decimalGreater, f)
+}
+
+// IterateAsks calls f on the asks from the lowest price to the highest price until f returns false.
+// Levels with zero size are skipped.
+func (r *OrderbookResponse) IterateAsks(f func(*OrderbookOrder) bool) {
+	iterateLevels(r.Asks, decimalLess, f)
+}
+
+// iterateLevels iterates the levels sorted by less. The rest api returns the levels sorted,
+// and a sorted copy is only made when they are not.
+func iterateLevels(levels []*OrderbookOrder, less func(a, b *Decimal) bool, f func(*OrderbookOrder) bool) {
+	var valid []*OrderbookOrder
+	for _, v := range levels {
+		if v != nil && v.Price != nil && v.Size != nil && !v.Size.IsZero() {
+			valid = append(valid, v)
+		}
+	}
+	isLess := func(i, j int) bool { return less(valid[i].Price, valid[j].Price) }
+	if !sort.SliceIsSorted(valid, isLess) {
+		sort.SliceStable(valid, isLess)
+	}
+	for _, v := range valid {
+		if !f(v) {
+			return
+		}
+	}
+}
+
+// iterateTakerSide iterates the levels taken by an order of the side: asks for buy orders, and bids for sell orders.
+func iterateTakerSide(book OrderbookLevels, side OrderSide, f func(*OrderbookOrder) bool) error {
+	switch side {
+	case OrderSideBuy:
+		book.IterateAsks(f)
+	case OrderSideSell:
+		book.IterateBids(f)
+	default:
+		return fmt.Errorf("unknown order side: %s", side)
+	}
+	return nil
+}
+
+// bookTop returns the best bid and ask, nil if the side is empty.
+func bookTop(book OrderbookLevels) (bid *OrderbookOrder, ask *OrderbookOrder) {
+	book.IterateBids(func(v *OrderbookOrder) bool {
+		bid = v
+		return false
+	})
+	book.IterateAsks(func(v *OrderbookOrder) bool {
+		ask = v
+		return false
+	})
+	return bid, ask
+}
+
+// OrderbookMid returns the mid price (best bid + best ask) / 2.
+func OrderbookMid(book OrderbookLevels) (*Decimal, error) {
+	bid, ask := bookTop(book)
+	if bid == nil || ask == nil {
+		return nil, ErrEmptyOrderbook
+	}
+	return divDecimal(bid.Price.Add(ask.Price), decimalTwo), nil
+}
+
+// OrderbookMicroprice returns the mid price weighted by the sizes at the top of the book,
+// (bid price * ask size + ask price * bid size) / (bid size + ask size), which leans towards the side with less size.
+func OrderbookMicroprice(book OrderbookLevels) (*Decimal, error) {
+	bid, ask := bookTop(book)
+	if bid == nil || ask == nil {
+		return nil, ErrEmptyOrderbook
+	}
+	weighted := bid.Price.Mul(ask.Size).Add(ask.Price.Mul(bid.Size))
+	return divDecimal(weighted, bid.Size.Add(ask.Size)), nil
+}
+
+// OrderbookSpreadBps returns the spread (best ask - best bid) in basis points of the mid price.
+func OrderbookSpreadBps(book OrderbookLevels) (*Decimal, error) {
+	bid, ask := bookTop(book)
+	if bid == nil || ask == nil {
+		return nil, ErrEmptyOrderbook
+	}
+	mid := divDecimal(bid.Price.Add(ask.Price), decimalTwo)
+	return divDecimal(ask.Price.Sub(bid.Price).Mul(bpsPerOne), mid), nil
+}
+
+// FillEstimate is the result of sweeping the book with an order.
+type FillEstimate struct {
+	// Size is the filled size, which is less than the requested size when the depth is insufficient.
+	Size *Decimal
+	// Notional is the sum of price * size of the fills.
+	Notional *Decimal
+	// Vwap is the volume weighted average price of the fills.
+	Vwap *Decimal
+	// BestPrice is the price of the first level.
+	BestPrice *Decimal
+	// WorstPrice is the price of the last level taken.
+	WorstPrice *Decimal
+	// Levels is the number of the price levels taken.
+	Levels int
+	// SlippageBps is the distance between Vwap and BestPrice in basis points of BestPrice. It is never negative.
+	SlippageBps *Decimal
+	// ImpactBps is the distance between WorstPrice and BestPrice in basis points of BestPrice. It is never negative.
+	ImpactBps *Decimal
+}
+
+// EstimateFill estimates the fills of a market order of the side and size by sweeping the book.
+// When the book cannot fill the whole size, the estimate of the partial fill is returned with ErrInsufficientDepth.
+func EstimateFill(book OrderbookLevels, side OrderSide, size *Decimal) (*FillEstimate, error) {
+	if size == nil || size.Sign() <= 0 {
+		return nil, fmt.Errorf("size must be positive: %v", size)
+	}
+
+	filled := decimal.NewFromInt(0)
+	notional := decimal.NewFromInt(0)
+	result := &FillEstimate{}
+	err := iterateTakerSide(book, side, func(v *OrderbookOrder) bool {
+		if result.BestPrice == nil {
+			result.BestPrice = v.Price
+		}
+		take := size.Sub(filled)
+		if decimalLess(v.Size, take) {
+			take = v.Size
+		}
+		filled = filled.Add(take)
+		notional = notional.Add(take.Mul(v.Price))
+		result.WorstPrice = v.Price
+		result.Levels++
+		return decimalLess(filled, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Levels == 0 {
+		return nil, ErrEmptyOrderbook
+	}
+
+	result.Size = filled
+	result.Notional = notional
+	result.Vwap = divDecimal(notional, filled)
+	// |notional - best price * filled| / (best price * filled) avoids the rounded vwap.
+	result.SlippageBps = distanceBps(notional, result.BestPrice.Mul(filled), result.BestPrice.Mul(filled))
+	result.ImpactBps = distanceBps(result.WorstPrice, result.BestPrice, result.BestPrice)
+
+	if decimalLess(filled, size) {
+		return result, ErrInsufficientDepth
+	}
+	return result, nil
+}
+
+// distanceBps returns |a - b| in basis points of reference. The division is the last operation,
+// since the multiplications of the decimal package panic when the result is rounded.
+func distanceBps(a, b, reference *Decimal) *Decimal {
+	diff := a.Sub(b)
+	if diff.Sign() < 0 {
+		diff = b.Sub(a)
+	}
+	return divDecimal(diff.Mul(bpsPerOne), reference)
+}
+
+// SizeWithinBps returns the size available to an order of the side at prices within bps basis points of the mid price:
+// the asks at or below mid * (1 + bps / 10000) for buy orders, and the bids at or above mid * (1 - bps / 10000) for sell orders.
+func SizeWithinBps(book OrderbookLevels, side OrderSide, bps *Decimal) (*Decimal, error) {
+	bid, ask := bookTop(book)
+	if bid == nil || ask == nil {
+		return nil, ErrEmptyOrderbook
+	}
+
+	// compare price * 2 * 10000 with (bid + ask) * (10000 +/- bps) to avoid rounding the limit.
+	sum := bid.Price.Add(ask.Price)
+	scale := decimalTwo.Mul(bpsPerOne)
+	var within func(price *Decimal) bool
+	switch side {
+	case OrderSideBuy:
+		limit := sum.Mul(bpsPerOne.Add(bps))
+		within = func(price *Decimal) bool { return !decimalGreater(price.Mul(scale), limit) }
+	case OrderSideSell:
+		limit := sum.Mul(bpsPerOne.Sub(bps))
+		within = func(price *Decimal) bool { return !decimalLess(price.Mul(scale), limit) }
+	}
+
+	total := decimal.NewFromInt(0)
+	err := iterateTakerSide(book, side, func(v *OrderbookOrder) bool {
+		if !within(v.Price) {
+			return false
+		}
+		total = total.Add(v.Size)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return total, nil
+}
+
+// DepthLevel is a point on the cumulative depth curve.
+type DepthLevel struct {
+	Price *Decimal
+	Size  *Decimal
+	// CumulativeSize is the total size from the best price to this price.
+	CumulativeSize *Decimal
+	// CumulativeNotional is the total price * size from the best price to this price.
+	CumulativeNotional *Decimal
+}
+
+// CumulativeDepth returns the cumulative depth of the best n levels available to an order of the side
+// (the asks for buy orders, and the bids for sell orders). All the levels are included if n is negative.
+func CumulativeDepth(book OrderbookLevels, side OrderSide, n int) ([]*DepthLevel, error) {
+	var result []*DepthLevel
+	size := decimal.NewFromInt(0)
+	notional := decimal.NewFromInt(0)
+	err := iterateTakerSide(book, side, func(v *OrderbookOrder) bool {
+		if n >= 0 && len(result) >= n {
+			return false
+		}
+		size = size.Add(v.Size)
+		notional = notional.Add(v.Size.Mul(v.Price))
+		result = append(result, &DepthLevel{Price: v.Price, Size: v.Size, CumulativeSize: size, CumulativeNotional: notional})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
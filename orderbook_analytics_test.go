@@ -0,0 +1,92 @@
+package dydx_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fardream/go-dydx"
+)
+
+func newTestOrderbook(t *testing.T) *dydx.OrderbookResponse {
+	offset := int64(1)
+	return &dydx.OrderbookResponse{
+		Offset: &offset,
+		Bids: []*dydx.OrderbookOrder{
+			{Price: mustDecimal(t, "99"), Size: mustDecimal(t, "1"), PriceString: "99"},
+			{Price: mustDecimal(t, "98"), Size: mustDecimal(t, "2"), PriceString: "98"},
+		},
+		// not sorted on purpose.
+		Asks: []*dydx.OrderbookOrder{
+			{Price: mustDecimal(t, "102"), Size: mustDecimal(t, "2"), PriceString: "102"},
+			{Price: mustDecimal(t, "101"), Size: mustDecimal(t, "3"), PriceString: "101"},
+			{Price: mustDecimal(t, "103"), Size: mustDecimal(t, "0"), PriceString: "103"},
+		},
+	}
+}
+
+func TestOrderbookAnalytics(t *testing.T) {
+	snapshot := newTestOrderbook(t)
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true)
+	ob.Process(&dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents:              newTestOrderbook(t),
+	})
+
+	for name, book := range map[string]dydx.OrderbookLevels{"response": snapshot, "processor": ob} {
+		t.Run(name, func(t *testing.T) {
+			expectDecimal := func(got *dydx.Decimal, err error, expected string) {
+				t.Helper()
+				if err != nil || got.String() != expected {
+					t.Fatalf("expecting %s, got %v: %v", expected, got, err)
+				}
+			}
+
+			mid, err := dydx.OrderbookMid(book)
+			expectDecimal(mid, err, "100")
+			// (99 * 3 + 101 * 1) / 4
+			microprice, err := dydx.OrderbookMicroprice(book)
+			expectDecimal(microprice, err, "99.5")
+			spread, err := dydx.OrderbookSpreadBps(book)
+			expectDecimal(spread, err, "200")
+
+			fill, err := dydx.EstimateFill(book, dydx.OrderSideBuy, mustDecimal(t, "4"))
+			if err != nil || fill.Levels != 2 {
+				t.Fatalf("unexpected fill %#v: %v", fill, err)
+			}
+			expectDecimal(fill.Vwap, nil, "101.25")
+			expectDecimal(fill.WorstPrice, nil, "102")
+			expectDecimal(fill.ImpactBps, nil, "99.00990099009900990099009900990099")
+
+			fill, err = dydx.EstimateFill(book, dydx.OrderSideSell, mustDecimal(t, "5"))
+			if !errors.Is(err, dydx.ErrInsufficientDepth) {
+				t.Fatalf("expecting insufficient depth, got %v", err)
+			}
+			expectDecimal(fill.Size, nil, "3")
+			expectDecimal(fill.Notional, nil, "295")
+
+			size, err := dydx.SizeWithinBps(book, dydx.OrderSideBuy, mustDecimal(t, "100"))
+			expectDecimal(size, err, "3")
+			size, err = dydx.SizeWithinBps(book, dydx.OrderSideSell, mustDecimal(t, "200"))
+			expectDecimal(size, err, "3")
+
+			depth, err := dydx.CumulativeDepth(book, dydx.OrderSideBuy, -1)
+			if err != nil || len(depth) != 2 {
+				t.Fatalf("unexpected depth %#v: %v", depth, err)
+			}
+			expectDecimal(depth[1].CumulativeSize, nil, "5")
+			expectDecimal(depth[1].CumulativeNotional, nil, "507")
+		})
+	}
+
+	if _, err := dydx.OrderbookMid(&dydx.OrderbookResponse{}); !errors.Is(err, dydx.ErrEmptyOrderbook) {
+		t.Fatalf("expecting empty order book, got %v", err)
+	}
+}
+
+func mustDecimal(t *testing.T, s string) *dydx.Decimal {
+	d, err := dydx.NewDecimalFromString(s)
+	if err != nil {
+		t.Fatalf("failed to parse decimal %s: %v", s, err)
+	}
+	return d
+}
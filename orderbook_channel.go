@@ -1,6 +1,10 @@
 package dydx
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
 type orderbookChannelRequest struct {
 	Type    string `json:"type"`
@@ -8,13 +12,20 @@ type orderbookChannelRequest struct {
 
 	ID             string `json:"id"`
 	IncludeOffsets *bool  `json:"includeOffsets,omitempty"`
+	Batched        *bool  `json:"batched,omitempty"`
 }
 
-func newOrderbookChannelRequest(market string) *orderbookChannelRequest {
+func newOrderbookChannelRequest(market string, cfg *subscriptionConfig) *orderbookChannelRequest {
 	r := &orderbookChannelRequest{Type: subscribeChannelRequestType, Channel: OrderbookChannel}
 	r.ID = market
 	b := true
 	r.IncludeOffsets = &b
+	if cfg.includeOffsets != nil {
+		r.IncludeOffsets = cfg.includeOffsets
+	}
+	if cfg.batched {
+		r.Batched = &b
+	}
 	return r
 }
 
@@ -23,6 +34,204 @@ type (
 	OrderbookChannelResponse         = ChannelResponse[OrderbookChannelResponseContents]
 )
 
-func (c *Client) SubscribeOrderbook(ctx context.Context, market string, outputChan chan<- *OrderbookChannelResponse) error {
-	return subscribeForType(ctx, c.wsUrl, newOrderbookChannelRequest(market), newUnsubscribeRequest(OrderbookChannel, market), outputChan)
+// SubscribeOrderbook subscribes to the orderbook of the market.
+//
+// When a gap in the message ids is detected, the orderbook is fetched from the rest api, and sent to the output channel
+// as a message of type ChannelResponseTypeResync. The updates received during the fetch are buffered, and only the ones with
+// offsets newer than the snapshot are sent after it. The rest api snapshot has no offset, and it takes the offset of the last
+// update before the gap, see orderbookSnapshotWithOffset. If the fetch fails, the connection is reconnected if it has a reconnect policy.
+// Use SetSubscriptionOrderbookResync to turn this off.
+func (c *Client) SubscribeOrderbook(ctx context.Context, market string, outputChan chan<- *OrderbookChannelResponse, options ...SubscriptionOption) error {
+	cfg := newSubscriptionConfig(options)
+	conn := c.getWsConnection()
+	if cfg.noResync {
+		return conn.SubscribeOrderbook(ctx, market, outputChan, options...)
+	}
+
+	// wait for the subscription to finish after it is cancelled.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	inner_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	inner := make(chan *OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(inner)
+		errChan <- conn.SubscribeOrderbook(inner_ctx, market, inner, options...)
+	}()
+
+	type snapshotResult struct {
+		snapshot *OrderbookResponse
+		err      error
+	}
+
+	send := func(resp *OrderbookChannelResponse) bool {
+		select {
+		case <-inner_ctx.Done():
+			return false
+		case outputChan <- resp:
+			return true
+		}
+	}
+
+	// snapshotChan is not nil when a resync is in progress.
+	var snapshotChan chan snapshotResult
+	var buffered []*OrderbookChannelResponse
+	// lastOffset is the offset of the last update sent, and cutoff is the last offset before the resync.
+	var lastOffset, cutoff *int64
+
+	for {
+		select {
+		case <-inner_ctx.Done():
+			return nil
+
+		case resp, ok := <-inner:
+			if !ok {
+				return <-errChan
+			}
+			switch {
+			case resp.Type == ChannelResponseTypeGap:
+				if snapshotChan == nil {
+					snapshotChan = make(chan snapshotResult, 1)
+					buffered = nil
+					cutoff = lastOffset
+					go func(result chan<- snapshotResult) {
+						snapshot, err := c.GetOrderbook(inner_ctx, market)
+						result <- snapshotResult{snapshot: snapshot, err: err}
+					}(snapshotChan)
+				}
+			case resp.Type == ChannelResponseTypeReconnected || resp.Type == ChannelResponseTypeSubscribe:
+				// the subscribed message contains a new snapshot.
+				snapshotChan = nil
+				buffered = nil
+				lastOffset = nil
+			case snapshotChan != nil:
+				buffered = append(buffered, resp)
+				continue
+			}
+			if offset := orderbookResponseOffset(resp); offset != nil {
+				lastOffset = offset
+			}
+			if !send(resp) {
+				return nil
+			}
+
+		case result := <-snapshotChan:
+			snapshotChan = nil
+			if result.err != nil {
+				log.Warnf("failed to get orderbook snapshot of %s for resync: %v", market, result.err)
+				buffered = nil
+				if !conn.forceReconnect(fmt.Errorf("failed to resync orderbook of %s: %w", market, result.err)) {
+					return fmt.Errorf("failed to resync orderbook of %s: %w", market, result.err)
+				}
+				continue
+			}
+
+			snapshot := orderbookSnapshotWithOffset(result.snapshot, cutoff)
+			resync := &OrderbookChannelResponse{
+				ChannelResponseHeader: ChannelResponseHeader{
+					Type:    ChannelResponseTypeResync,
+					Channel: OrderbookChannel,
+					Id:      market,
+				},
+				Contents: snapshot,
+			}
+			if !send(resync) {
+				return nil
+			}
+			lastOffset = snapshot.Offset
+			for _, resp := range buffered {
+				resp = filterOrderbookUpdateNewer(resp, snapshot)
+				if resp == nil {
+					continue
+				}
+				if offset := orderbookResponseOffset(resp); offset != nil {
+					lastOffset = offset
+				}
+				if !send(resp) {
+					return nil
+				}
+			}
+			buffered = nil
+		}
+	}
+}
+
+// SubscribeOrderbookWithHandler starts the orderbook subscription in the background and sends the updates to the handler.
+// It returns after the subscription is acknowledged. See StartSubscription.
+func (c *Client) SubscribeOrderbookWithHandler(ctx context.Context, market string, handler SubscriptionHandler[OrderbookChannelResponseContents], options ...SubscriptionOption) (*Subscription, error) {
+	return StartSubscription(ctx, func(ctx context.Context, outputChan chan<- *OrderbookChannelResponse) error {
+		return c.SubscribeOrderbook(ctx, market, outputChan, options...)
+	}, handler)
+}
+
+// orderbookSnapshotWithOffset returns the snapshot with the offset if the snapshot has no offset, like the ones from the rest api.
+//
+// The snapshot fetched after the update at the offset includes that update and the ones before it. The sizes in the updates
+// are absolute, so the updates after the offset can be applied in order over the snapshot, even if some of them are already
+// included in it. The snapshot is not modified.
+func orderbookSnapshotWithOffset(snapshot *OrderbookResponse, offset *int64) *OrderbookResponse {
+	if snapshot == nil || snapshot.Offset != nil || offset == nil {
+		return snapshot
+	}
+	result := *snapshot
+	result.Offset = offset
+	return &result
+}
+
+// orderbookResponseOffset returns the offset of the last update in the response, nil if there is none.
+func orderbookResponseOffset(resp *OrderbookChannelResponse) *int64 {
+	if resp.Type == ChannelResponseTypeChannelBatchData {
+		for i := len(resp.BatchContents) - 1; i >= 0; i-- {
+			if contents := resp.BatchContents[i]; contents != nil && contents.Offset != nil {
+				return contents.Offset
+			}
+		}
+		return nil
+	}
+	if resp.Contents == nil {
+		return nil
+	}
+	return resp.Contents.Offset
+}
+
+// isOrderbookUpdateNewer checks if the offset of the update is newer than the snapshot.
+// Updates without offsets, and all the updates if the snapshot has no offset, are considered newer.
+func isOrderbookUpdateNewer(contents *OrderbookResponse, snapshot *OrderbookResponse) bool {
+	if contents == nil || contents.Offset == nil || snapshot.Offset == nil {
+		return true
+	}
+	return *contents.Offset > *snapshot.Offset
+}
+
+// filterOrderbookUpdateNewer returns the response with only the updates newer than the snapshot,
+// or nil if none of the updates is newer. For batched responses, the updates are filtered individually.
+func filterOrderbookUpdateNewer(resp *OrderbookChannelResponse, snapshot *OrderbookResponse) *OrderbookChannelResponse {
+	if resp.Type != ChannelResponseTypeChannelBatchData {
+		if !isOrderbookUpdateNewer(resp.Contents, snapshot) {
+			return nil
+		}
+		return resp
+	}
+
+	var batch []*OrderbookResponse
+	for _, contents := range resp.BatchContents {
+		if isOrderbookUpdateNewer(contents, snapshot) {
+			batch = append(batch, contents)
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if len(batch) == len(resp.BatchContents) {
+		return resp
+	}
+
+	filtered := *resp
+	filtered.BatchContents = batch
+	return &filtered
 }
@@ -0,0 +1,97 @@
+package dydx
+
+// CrossedBookEvent is reported when the best bid is at or above the best ask after an update.
+//
+// The crossing levels are dropped from the side whose level has the older offset, until the book is no longer crossed.
+// A level without offset is older than a level with offset, and the ask is dropped when the offsets are the same.
+type CrossedBookEvent struct {
+	Market string
+	// Offset is the offset of the update after which the book is crossed, nil if the update has no offset.
+	Offset *int64
+	// Bid and Ask are the best bid and ask when the book is found crossed.
+	Bid *OrderbookOrder
+	Ask *OrderbookOrder
+	// Locked is true when the best bid and ask have the same price.
+	Locked bool
+
+	DroppedBids []*OrderbookOrder
+	DroppedAsks []*OrderbookOrder
+
+	// Resynced is true when the book is replaced by a snapshot from the resync function (see SetOrderbookProcessorResync).
+	Resynced bool
+	// ResyncError is the error from the resync function.
+	ResyncError error
+}
+
+// isCrossed checks if the best bid is at or above the best ask.
+func isCrossed(bid, ask *OrderbookOrder) bool {
+	return bid != nil && ask != nil && !decimalLess(bid.Price, ask.Price)
+}
+
+// checkCrossed repairs the book if it is crossed or locked, and reports the event.
+func (ob *OrderbookProcessor) checkCrossed(offset *int64) {
+	bid, ask := ob.BookTop()
+	if !isCrossed(bid, ask) {
+		return
+	}
+
+	event := &CrossedBookEvent{
+		Market: ob.Market,
+		Offset: offset,
+		Bid:    &OrderbookOrder{Price: bid.Price, Size: bid.Size, Offset: bid.Offset, PriceString: bid.PriceString},
+		Ask:    &OrderbookOrder{Price: ask.Price, Size: ask.Size, Offset: ask.Offset, PriceString: ask.PriceString},
+		Locked: bid.Price.Cmp(&ask.Price.Decimal) == 0,
+	}
+
+	for ; isCrossed(bid, ask); bid, ask = ob.BookTop() {
+		if isOlderLevel(bid, ask) {
+			ob.Bids.levels.Delete(bid.Price)
+			ob.emitLevelEvent(BookEventLevelRemoved, OrderSideBuy, bid.Price, bid.Size, nil)
+			event.DroppedBids = append(event.DroppedBids, bid)
+		} else {
+			ob.Asks.levels.Delete(ask.Price)
+			ob.emitLevelEvent(BookEventLevelRemoved, OrderSideSell, ask.Price, ask.Size, nil)
+			event.DroppedAsks = append(event.DroppedAsks, ask)
+		}
+	}
+
+	log.Warnf("crossed order book of %s at offset %v: bid %s ask %s, dropped %d bids and %d asks",
+		ob.Market, derefOffset(offset), event.Bid.PriceString, event.Ask.PriceString, len(event.DroppedBids), len(event.DroppedAsks))
+
+	// the snapshot from resync is checked again by ApplySnapshot, but not resynced again.
+	if ob.resync != nil && !ob.resyncing {
+		ob.resyncing = true
+		snapshot, err := ob.resync(ob.Market)
+		if err != nil {
+			log.Warnf("failed to resync crossed order book of %s: %v", ob.Market, err)
+			event.ResyncError = err
+		} else {
+			ob.ApplySnapshot(snapshot)
+			event.Resynced = true
+		}
+		ob.resyncing = false
+	}
+
+	if ob.crossedBookHandler != nil {
+		ob.crossedBookHandler(event)
+	}
+}
+
+// isOlderLevel checks if the offset of a is older than the offset of b. A level without offset is older than a level with offset.
+func isOlderLevel(a, b *OrderbookOrder) bool {
+	switch {
+	case b.Offset == nil:
+		return false
+	case a.Offset == nil:
+		return true
+	default:
+		return *a.Offset < *b.Offset
+	}
+}
+
+func derefOffset(offset *int64) any {
+	if offset == nil {
+		return nil
+	}
+	return *offset
+}
@@ -0,0 +1,121 @@
+package dydx_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fardream/go-dydx"
+)
+
+func newTestLevel(t *testing.T, price, size string, offset int64) *dydx.OrderbookOrder {
+	return &dydx.OrderbookOrder{Price: mustDecimal(t, price), Size: mustDecimal(t, size), Offset: &offset, PriceString: price}
+}
+
+func newTestOrderbookUpdate(offset int64, bids, asks []*dydx.OrderbookOrder) *dydx.OrderbookChannelResponse {
+	return &dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelData},
+		Contents:              &dydx.OrderbookResponse{Offset: &offset, Bids: bids, Asks: asks},
+	}
+}
+
+func TestOrderbookProcessorCrossedBook(t *testing.T) {
+	var events []*dydx.CrossedBookEvent
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true, dydx.SetOrderbookProcessorCrossedBookHandler(func(e *dydx.CrossedBookEvent) {
+		events = append(events, e)
+	}))
+	ob.Process(&dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents: &dydx.OrderbookResponse{
+			Bids: []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 10), newTestLevel(t, "99", "1", 5)},
+			Asks: []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 3), newTestLevel(t, "102", "1", 12)},
+		},
+	})
+	if len(events) != 0 {
+		t.Fatalf("book is not crossed: %#v", events)
+	}
+
+	// the new bid at 101.5 crosses the stale ask at 101.
+	ob.Process(newTestOrderbookUpdate(20, []*dydx.OrderbookOrder{newTestLevel(t, "101.5", "1", 20)}, nil))
+	if len(events) != 1 || len(events[0].DroppedAsks) != 1 || events[0].DroppedAsks[0].PriceString != "101" || len(events[0].DroppedBids) != 0 {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+	if bid, ask := ob.BookTop(); bid.PriceString != "101.5" || ask.PriceString != "102" {
+		t.Fatalf("unexpected top of book: %s %s", bid.PriceString, ask.PriceString)
+	}
+
+	// the new ask at 101.5 is newer than the bid, and locks the book.
+	ob.Process(newTestOrderbookUpdate(21, nil, []*dydx.OrderbookOrder{newTestLevel(t, "101.5", "2", 21)}))
+	if len(events) != 2 || !events[1].Locked || len(events[1].DroppedBids) != 1 || len(events[1].DroppedAsks) != 0 {
+		t.Fatalf("unexpected events: %#v", events[1])
+	}
+	if bid, ask := ob.BookTop(); bid.PriceString != "100" || ask.PriceString != "101.5" {
+		t.Fatalf("unexpected top of book: %s %s", bid.PriceString, ask.PriceString)
+	}
+}
+
+func TestOrderbookProcessorCrossedBookRefreshedLevel(t *testing.T) {
+	var events []*dydx.CrossedBookEvent
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true, dydx.SetOrderbookProcessorCrossedBookHandler(func(e *dydx.CrossedBookEvent) {
+		events = append(events, e)
+	}))
+	ob.Process(&dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents: &dydx.OrderbookResponse{
+			Bids: []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 10)},
+			Asks: []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 3), newTestLevel(t, "102", "1", 12)},
+		},
+	})
+
+	// the ask at 101 is refreshed at offset 20, and takes the offset of the update.
+	ob.Process(newTestOrderbookUpdate(20, nil, []*dydx.OrderbookOrder{newTestLevel(t, "101", "2", 20)}))
+	if ask := ob.Asks.Best(); *ask.Offset != 20 {
+		t.Fatalf("offset of the refreshed level is not updated: %d", *ask.Offset)
+	}
+
+	// the stale bid at 101.5 last changed at offset 15, and is older than the refreshed ask.
+	ob.Process(newTestOrderbookUpdate(21, []*dydx.OrderbookOrder{newTestLevel(t, "101.5", "1", 15)}, nil))
+	if len(events) != 1 || len(events[0].DroppedBids) != 1 || events[0].DroppedBids[0].PriceString != "101.5" || len(events[0].DroppedAsks) != 0 {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+	if bid, ask := ob.BookTop(); bid.PriceString != "100" || ask.PriceString != "101" || ask.Size.String() != "2" {
+		t.Fatalf("unexpected top of book: %s %s", bid.PriceString, ask.PriceString)
+	}
+}
+
+func TestOrderbookProcessorCrossedBookResync(t *testing.T) {
+	var events []*dydx.CrossedBookEvent
+	snapshotOffset := int64(30)
+	resyncErr := errors.New("failed")
+	fail := true
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true,
+		dydx.SetOrderbookProcessorCrossedBookHandler(func(e *dydx.CrossedBookEvent) { events = append(events, e) }),
+		dydx.SetOrderbookProcessorResync(func(market string) (*dydx.OrderbookResponse, error) {
+			if fail {
+				return nil, resyncErr
+			}
+			return &dydx.OrderbookResponse{
+				Offset: &snapshotOffset,
+				Bids:   []*dydx.OrderbookOrder{newTestLevel(t, "99", "5", 30)},
+				Asks:   []*dydx.OrderbookOrder{newTestLevel(t, "100", "5", 30)},
+			}, nil
+		}))
+
+	ob.Process(newTestOrderbookUpdate(10, []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 10)}, []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 10)}))
+	ob.Process(newTestOrderbookUpdate(11, []*dydx.OrderbookOrder{newTestLevel(t, "102", "1", 11)}, nil))
+	if len(events) != 1 || events[0].Resynced || !errors.Is(events[0].ResyncError, resyncErr) {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+
+	fail = false
+	ob.Process(newTestOrderbookUpdate(12, nil, []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 12)}))
+	if len(events) != 2 || !events[1].Resynced {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+
+	// updates not newer than the snapshot are ignored.
+	ob.Process(newTestOrderbookUpdate(25, []*dydx.OrderbookOrder{newTestLevel(t, "99.5", "1", 25)}, nil))
+	ob.Process(newTestOrderbookUpdate(31, []*dydx.OrderbookOrder{newTestLevel(t, "99", "2", 31)}, nil))
+	if bid, ask := ob.BookTop(); ob.Bids.Len() != 1 || bid.Size.String() != "2" || ask.PriceString != "100" {
+		t.Fatalf("unexpected book after resync: bids %s asks %s", ob.Bids.PrintBook(), ob.Asks.PrintBook())
+	}
+}
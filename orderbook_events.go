@@ -0,0 +1,305 @@
+package dydx
+
+import (
+	"sync"
+	"time"
+)
+
+// BookEventType is the type of the events of OrderbookProcessor.
+type BookEventType string
+
+const (
+	// BookEventTopOfBook is emitted when the price or size of the best bid or ask changes.
+	BookEventTopOfBook BookEventType = "top_of_book"
+	// BookEventLevelAdded is emitted when a price level is added.
+	BookEventLevelAdded BookEventType = "level_added"
+	// BookEventLevelRemoved is emitted when a price level is removed.
+	BookEventLevelRemoved BookEventType = "level_removed"
+	// BookEventSizeChanged is emitted when the size of a price level changes.
+	BookEventSizeChanged BookEventType = "size_changed"
+	// BookEventReset is emitted when the book is cleared, after a reconnect or before a snapshot is applied.
+	// The levels of the snapshot are emitted as added afterwards.
+	BookEventReset BookEventType = "reset"
+)
+
+// BookEvent is a change of the order book.
+type BookEvent struct {
+	Type   BookEventType
+	Market string
+	// Offset is the offset of the book after the change.
+	Offset *int64
+
+	// Side, Price, OldSize and NewSize are set for the level events.
+	// Side is OrderSideBuy for bids and OrderSideSell for asks.
+	// OldSize is nil for added levels, and NewSize is nil for removed levels.
+	Side    OrderSide
+	Price   *Decimal
+	OldSize *Decimal
+	NewSize *Decimal
+
+	// OldBid, OldAsk, NewBid and NewAsk are set for the top of book events, nil when the side of the book is empty.
+	OldBid *OrderbookOrder
+	OldAsk *OrderbookOrder
+	NewBid *OrderbookOrder
+	NewAsk *OrderbookOrder
+}
+
+// SetOrderbookProcessorEventHandler sets the handler of the events of the book. The handler is called synchronously in Process.
+// Use BookEventStream to receive the events from a channel.
+func SetOrderbookProcessorEventHandler(handler func(*BookEvent)) orderbookProcessorOption {
+	return func(ob *OrderbookProcessor) {
+		ob.eventHandler = handler
+	}
+}
+
+func (ob *OrderbookProcessor) emitEvent(event *BookEvent) {
+	if ob.eventHandler == nil {
+		return
+	}
+	event.Market = ob.Market
+	event.Offset = ob.offset
+	ob.eventHandler(event)
+}
+
+func (ob *OrderbookProcessor) emitLevelEvent(eventType BookEventType, side OrderSide, price, oldSize, newSize *Decimal) {
+	if eventType == BookEventLevelRemoved {
+		newSize = nil
+	}
+	ob.emitEvent(&BookEvent{Type: eventType, Side: side, Price: price, OldSize: oldSize, NewSize: newSize})
+}
+
+// copyTopLevel copies the level, since the size of the level in the book can be updated later.
+func copyTopLevel(level *OrderbookOrder) *OrderbookOrder {
+	if level == nil {
+		return nil
+	}
+	return &OrderbookOrder{Price: level.Price, Size: level.Size, Offset: level.Offset, PriceString: level.PriceString}
+}
+
+// isSameTopLevel checks if the price and size of the levels are the same.
+func isSameTopLevel(a, b *OrderbookOrder) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Price.Cmp(&b.Price.Decimal) == 0 && a.Size.Cmp(&b.Size.Decimal) == 0
+}
+
+// emitTopOfBookIfChanged emits BookEventTopOfBook if the top of the book is different from the last one emitted.
+func (ob *OrderbookProcessor) emitTopOfBookIfChanged() {
+	if ob.eventHandler == nil {
+		return
+	}
+	bid, ask := ob.BookTop()
+	if isSameTopLevel(bid, ob.topBid) && isSameTopLevel(ask, ob.topAsk) {
+		return
+	}
+	event := &BookEvent{Type: BookEventTopOfBook, OldBid: ob.topBid, OldAsk: ob.topAsk, NewBid: copyTopLevel(bid), NewAsk: copyTopLevel(ask)}
+	ob.topBid, ob.topAsk = event.NewBid, event.NewAsk
+	ob.emitEvent(event)
+}
+
+// bookLevelKey identifies a price level in BookEventStream.
+type bookLevelKey struct {
+	side  OrderSide
+	price string
+}
+
+// BookEventStream delivers the events of a book to a channel.
+//
+// Without coalescing, Handle blocks until the event is received from the channel.
+// With a coalescing window, the events are merged during the window and sent afterwards, so Handle never blocks:
+// the level events of the same price are merged into one, the top of book events into one from the first old top
+// to the last new top, and the level events before a reset are dropped. If the consumer is slow, the events keep merging until they are sent.
+type BookEventStream struct {
+	events chan *BookEvent
+	window time.Duration
+
+	mutex   sync.Mutex
+	pending *coalescedBookEvents
+	closed  bool
+	// sendMutex serializes the sending of the coalesced events.
+	sendMutex sync.Mutex
+
+	done     chan struct{}
+	flushed  chan struct{}
+	closeOne sync.Once
+}
+
+// coalescedBookEvents are the events merged in a window.
+type coalescedBookEvents struct {
+	reset *BookEvent
+	// levels are the first and last events of each level.
+	levels map[bookLevelKey][2]*BookEvent
+	// order is the order of the levels first changed.
+	order []bookLevelKey
+	top   *BookEvent
+}
+
+func newCoalescedBookEvents() *coalescedBookEvents {
+	return &coalescedBookEvents{levels: make(map[bookLevelKey][2]*BookEvent)}
+}
+
+func (c *coalescedBookEvents) isEmpty() bool {
+	return c.reset == nil && len(c.order) == 0 && c.top == nil
+}
+
+func (c *coalescedBookEvents) add(event *BookEvent) {
+	switch event.Type {
+	case BookEventReset:
+		c.reset = event
+		c.levels = make(map[bookLevelKey][2]*BookEvent)
+		c.order = nil
+	case BookEventTopOfBook:
+		if c.top == nil {
+			c.top = event
+			return
+		}
+		merged := *event
+		merged.OldBid, merged.OldAsk = c.top.OldBid, c.top.OldAsk
+		c.top = &merged
+	default:
+		key := bookLevelKey{side: event.Side, price: event.Price.String()}
+		events, ok := c.levels[key]
+		if !ok {
+			c.order = append(c.order, key)
+			events[0] = event
+		}
+		events[1] = event
+		c.levels[key] = events
+	}
+}
+
+// mergeLevelEvents merges the first and last events of a level, nil if the level is the same before and after.
+func mergeLevelEvents(first, last *BookEvent) *BookEvent {
+	existedBefore := first.Type != BookEventLevelAdded
+	existsAfter := last.Type != BookEventLevelRemoved
+
+	merged := *last
+	merged.OldSize = first.OldSize
+	switch {
+	case !existedBefore && !existsAfter:
+		return nil
+	case !existedBefore:
+		merged.Type = BookEventLevelAdded
+	case !existsAfter:
+		merged.Type = BookEventLevelRemoved
+	default:
+		merged.Type = BookEventSizeChanged
+		if merged.OldSize.Cmp(&merged.NewSize.Decimal) == 0 {
+			return nil
+		}
+	}
+	return &merged
+}
+
+// list returns the events in the order of reset, level events, and top of book.
+func (c *coalescedBookEvents) list() []*BookEvent {
+	var result []*BookEvent
+	if c.reset != nil {
+		result = append(result, c.reset)
+	}
+	for _, key := range c.order {
+		events := c.levels[key]
+		if event := mergeLevelEvents(events[0], events[1]); event != nil {
+			result = append(result, event)
+		}
+	}
+	if c.top != nil && !(isSameTopLevel(c.top.OldBid, c.top.NewBid) && isSameTopLevel(c.top.OldAsk, c.top.NewAsk)) {
+		result = append(result, c.top)
+	}
+	return result
+}
+
+// NewBookEventStream creates a stream with the buffer size of the channel. The events are not coalesced if window is 0.
+// Pass Handle to SetOrderbookProcessorEventHandler.
+func NewBookEventStream(bufferSize int, window time.Duration) *BookEventStream {
+	s := &BookEventStream{
+		events:  make(chan *BookEvent, bufferSize),
+		window:  window,
+		pending: newCoalescedBookEvents(),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+	if window > 0 {
+		go s.flushLoop()
+	} else {
+		close(s.flushed)
+	}
+	return s
+}
+
+// Events returns the channel of the events, which is closed after Close.
+func (s *BookEventStream) Events() <-chan *BookEvent {
+	return s.events
+}
+
+// Handle receives an event from the book.
+func (s *BookEventStream) Handle(event *BookEvent) {
+	if s.window <= 0 {
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.pending.add(event)
+	}
+}
+
+// flushLoop sends the coalesced events after each window.
+func (s *BookEventStream) flushLoop() {
+	defer close(s.flushed)
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+// Flush sends the coalesced events now instead of waiting for the end of the window.
+// It blocks until the events are received from the channel or the stream is closed.
+func (s *BookEventStream) Flush() {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = newCoalescedBookEvents()
+	s.mutex.Unlock()
+
+	if pending.isEmpty() {
+		return
+	}
+	for _, event := range pending.list() {
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close stops the stream and closes the channel. The events not sent yet are dropped.
+// Handle must not be called concurrently with or after Close when the events are not coalesced.
+func (s *BookEventStream) Close() {
+	s.closeOne.Do(func() {
+		s.mutex.Lock()
+		s.closed = true
+		s.mutex.Unlock()
+		close(s.done)
+		<-s.flushed
+		// wait for the ongoing Flush.
+		s.sendMutex.Lock()
+		defer s.sendMutex.Unlock()
+		close(s.events)
+	})
+}
@@ -0,0 +1,114 @@
+package dydx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+func TestOrderbookProcessorEvents(t *testing.T) {
+	var events []*dydx.BookEvent
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true, dydx.SetOrderbookProcessorEventHandler(func(e *dydx.BookEvent) {
+		events = append(events, e)
+	}))
+	ob.Process(&dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents: &dydx.OrderbookResponse{
+			Bids: []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 1)},
+			Asks: []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 1)},
+		},
+	})
+	ob.Process(newTestOrderbookUpdate(2, []*dydx.OrderbookOrder{newTestLevel(t, "100", "2", 2), newTestLevel(t, "99", "1", 2)}, nil))
+	ob.Process(newTestOrderbookUpdate(3, nil, []*dydx.OrderbookOrder{newTestLevel(t, "101", "0", 3)}))
+	ob.Process(&dydx.OrderbookChannelResponse{ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeReconnected}})
+
+	var types []dydx.BookEventType
+	for _, v := range events {
+		types = append(types, v.Type)
+	}
+	expected := []dydx.BookEventType{
+		dydx.BookEventLevelAdded, dydx.BookEventLevelAdded, dydx.BookEventTopOfBook,
+		dydx.BookEventSizeChanged, dydx.BookEventLevelAdded, dydx.BookEventTopOfBook,
+		dydx.BookEventLevelRemoved, dydx.BookEventTopOfBook,
+		dydx.BookEventReset, dydx.BookEventTopOfBook,
+	}
+	if diff := cmp.Diff(expected, types); diff != "" {
+		t.Fatalf("unexpected events: %s", diff)
+	}
+
+	if e := events[3]; e.Price.String() != "100" || e.OldSize.String() != "1" || e.NewSize.String() != "2" || *e.Offset != 2 {
+		t.Fatalf("unexpected size change: %#v", e)
+	}
+	if e := events[5]; e.OldBid.Size.String() != "1" || e.NewBid.Size.String() != "2" || e.NewAsk.PriceString != "101" {
+		t.Fatalf("unexpected top of book: %#v", e)
+	}
+	if e := events[7]; e.OldAsk.PriceString != "101" || e.NewAsk != nil || e.NewBid.PriceString != "100" {
+		t.Fatalf("unexpected top of book: %#v", e)
+	}
+	if e := events[9]; e.NewBid != nil || e.NewAsk != nil {
+		t.Fatalf("unexpected top of book after reset: %#v", e)
+	}
+}
+
+func TestBookEventStreamCoalesce(t *testing.T) {
+	// the window is long, and the events are flushed explicitly.
+	stream := dydx.NewBookEventStream(100, time.Hour)
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true, dydx.SetOrderbookProcessorEventHandler(stream.Handle))
+	ob.Process(&dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents: &dydx.OrderbookResponse{
+			Bids: []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 1)},
+			Asks: []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 1)},
+		},
+	})
+
+	receive := func() []*dydx.BookEvent {
+		t.Helper()
+		stream.Flush()
+		var result []*dydx.BookEvent
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-stream.Events():
+				result = append(result, e)
+				if e.Type == dydx.BookEventTopOfBook {
+					return result
+				}
+			case <-timeout:
+				t.Fatalf("timed out, got %#v", result)
+			}
+		}
+	}
+	if events := receive(); len(events) != 3 {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+
+	// the size of 100 goes back to 1, and 102 is added and removed. Only the size of 99 and the ask are changed.
+	for i, size := range []string{"2", "3", "1"} {
+		ob.Process(newTestOrderbookUpdate(int64(2+i), []*dydx.OrderbookOrder{newTestLevel(t, "100", size, int64(2+i))}, nil))
+	}
+	ob.Process(newTestOrderbookUpdate(5, []*dydx.OrderbookOrder{newTestLevel(t, "99", "1", 5)}, []*dydx.OrderbookOrder{newTestLevel(t, "102", "1", 5)}))
+	ob.Process(newTestOrderbookUpdate(6, []*dydx.OrderbookOrder{newTestLevel(t, "99", "4", 6)}, []*dydx.OrderbookOrder{newTestLevel(t, "102", "0", 6), newTestLevel(t, "101", "5", 6)}))
+
+	events := receive()
+	if len(events) != 3 {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+	if e := events[0]; e.Type != dydx.BookEventLevelAdded || e.Price.String() != "99" || e.NewSize.String() != "4" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e := events[1]; e.Type != dydx.BookEventSizeChanged || e.Price.String() != "101" || e.OldSize.String() != "1" || e.NewSize.String() != "5" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e := events[2]; e.OldBid.Size.String() != "1" || e.NewBid.Size.String() != "1" || e.OldAsk.Size.String() != "1" || e.NewAsk.Size.String() != "5" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+
+	stream.Close()
+	if _, ok := <-stream.Events(); ok {
+		t.Fatalf("channel is not closed")
+	}
+}
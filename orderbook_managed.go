@@ -0,0 +1,387 @@
+package dydx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fardream/go-dydx/skiplist"
+)
+
+// ManagedOrderbook maintains the order book of a market from the rest api snapshot and the websocket updates.
+//
+// After the subscription is acknowledged (or reconnected), the updates are buffered while the snapshot is fetched from the rest api.
+// The book is then set to the snapshot with ApplySnapshot, and only the buffered and later updates newer than the snapshot are applied.
+// The rest api snapshot has no offset, and it takes the offset of the subscribed message, which is the last offset before the fetch.
+//
+// Optionally, the book is checked against a fresh snapshot periodically, see SetManagedOrderbookCheck.
+type ManagedOrderbook struct {
+	api    MarketDataApi
+	market string
+	book   *OrderbookProcessor
+
+	processorOptions    []orderbookProcessorOption
+	subscriptionOptions []SubscriptionOption
+	updateHandler       func(*OrderbookProcessor)
+	resetHandler        func()
+	retryInterval       time.Duration
+	checkInterval       time.Duration
+	checkHandler        func(*OrderbookCheckResult)
+}
+
+type managedOrderbookOption func(m *ManagedOrderbook)
+
+// SetManagedOrderbookProcessorOptions sets the options of the OrderbookProcessor of the book.
+func SetManagedOrderbookProcessorOptions(options ...orderbookProcessorOption) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.processorOptions = options
+	}
+}
+
+// SetManagedOrderbookSubscriptionOptions sets the options of the orderbook subscription.
+func SetManagedOrderbookSubscriptionOptions(options ...SubscriptionOption) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.subscriptionOptions = options
+	}
+}
+
+// SetManagedOrderbookUpdateHandler sets the handler called after the snapshot or an update is applied to the book.
+// The handler is called in the goroutine of Run, and the book must not be used outside of the handler.
+func SetManagedOrderbookUpdateHandler(handler func(*OrderbookProcessor)) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.updateHandler = handler
+	}
+}
+
+// SetManagedOrderbookResetHandler sets the handler called after the book is cleared on a subscribe or reconnect,
+// when the book is empty until the snapshot is fetched. The handler is called in the goroutine of Run.
+func SetManagedOrderbookResetHandler(handler func()) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.resetHandler = handler
+	}
+}
+
+// SetManagedOrderbookRetryInterval sets the wait before fetching the snapshot again after a failure. Default is 1 second.
+func SetManagedOrderbookRetryInterval(interval time.Duration) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.retryInterval = interval
+	}
+}
+
+// SetManagedOrderbookCheck compares the book against a fresh snapshot from the rest api every interval, and reports the result to the handler.
+// The check is disabled if the interval is not positive or the handler is nil.
+func SetManagedOrderbookCheck(interval time.Duration, handler func(*OrderbookCheckResult)) managedOrderbookOption {
+	return func(m *ManagedOrderbook) {
+		m.checkInterval = interval
+		m.checkHandler = handler
+	}
+}
+
+// NewManagedOrderbook creates the managed order book of the market. Call Run to start it.
+func NewManagedOrderbook(api MarketDataApi, market string, options ...managedOrderbookOption) *ManagedOrderbook {
+	m := &ManagedOrderbook{
+		api:           api,
+		market:        market,
+		retryInterval: time.Second,
+	}
+	for _, option := range options {
+		option(m)
+	}
+	m.book = NewOrderbookProcessor(market, true, m.processorOptions...)
+	return m
+}
+
+// OrderbookLevelMismatch is a price level different between the book and the snapshot.
+type OrderbookLevelMismatch struct {
+	// Side is OrderSideBuy for bids, and OrderSideSell for asks.
+	Side  OrderSide
+	Price *Decimal
+	// BookSize is nil if the level is not in the book.
+	BookSize *Decimal
+	// SnapshotSize is nil if the level is not in the snapshot.
+	SnapshotSize *Decimal
+}
+
+// OrderbookCheckResult is the result of comparing the book against a snapshot.
+type OrderbookCheckResult struct {
+	Market string
+	// Offset is the offset of the book when it is compared.
+	Offset *int64
+	// SnapshotOffset is the offset of the snapshot. For a snapshot without offset, it is the offset of the book when the snapshot is requested.
+	SnapshotOffset *int64
+	Mismatches     []*OrderbookLevelMismatch
+	// Err is the error to get the snapshot.
+	Err error
+}
+
+// CompareOrderbook compares the book against the snapshot.
+//
+// The levels of the book with offsets newer than the snapshot are skipped. However, the levels removed from the book
+// after the snapshot cannot be told apart from the missing levels. ManagedOrderbook tracks the updates during the check to skip those as well.
+// All the levels are compared if the snapshot has no offset.
+func CompareOrderbook(ob *OrderbookProcessor, snapshot *OrderbookResponse) []*OrderbookLevelMismatch {
+	return compareOrderbook(ob, snapshot, nil)
+}
+
+// priceOffsets contains the latest offsets of the updated prices of both sides.
+type priceOffsets struct {
+	bids *skiplist.SkipList[*Decimal, *int64]
+	asks *skiplist.SkipList[*Decimal, *int64]
+}
+
+func newPriceOffsets() *priceOffsets {
+	return &priceOffsets{
+		bids: skiplist.New[*Decimal, *int64](decimalLess),
+		asks: skiplist.New[*Decimal, *int64](decimalLess),
+	}
+}
+
+func (p *priceOffsets) add(contents *OrderbookResponse) {
+	for _, v := range contents.Bids {
+		if v != nil {
+			p.bids.Set(v.Price, contents.Offset)
+		}
+	}
+	for _, v := range contents.Asks {
+		if v != nil {
+			p.asks.Set(v.Price, contents.Offset)
+		}
+	}
+}
+
+func compareOrderbook(ob *OrderbookProcessor, snapshot *OrderbookResponse, updated *priceOffsets) []*OrderbookLevelMismatch {
+	var updatedBids, updatedAsks *skiplist.SkipList[*Decimal, *int64]
+	if updated != nil {
+		updatedBids, updatedAsks = updated.bids, updated.asks
+	}
+
+	snapshotBook := NewOrderbookProcessor(ob.Market, true)
+	snapshotBook.updateBook(snapshot.Bids, &snapshotBook.Bids.bookSide)
+	snapshotBook.updateBook(snapshot.Asks, &snapshotBook.Asks.bookSide)
+
+	result := compareBookSide(OrderSideBuy, &ob.Bids.bookSide, &snapshotBook.Bids.bookSide, snapshot.Offset, updatedBids)
+	return append(result, compareBookSide(OrderSideSell, &ob.Asks.bookSide, &snapshotBook.Asks.bookSide, snapshot.Offset, updatedAsks)...)
+}
+
+func compareBookSide(side OrderSide, book *bookSide, snapshot *bookSide, snapshotOffset *int64, updated *skiplist.SkipList[*Decimal, *int64]) []*OrderbookLevelMismatch {
+	isNewer := func(offset *int64) bool {
+		return offset == nil || *offset > *snapshotOffset
+	}
+	// without the offset of the snapshot, only the levels updated after the snapshot is requested are skipped.
+	skip := func(level *OrderbookOrder) bool {
+		if snapshotOffset != nil && level.Offset != nil && isNewer(level.Offset) {
+			return true
+		}
+		if updated == nil {
+			return false
+		}
+		offset, ok := updated.Get(level.Price)
+		return ok && (snapshotOffset == nil || isNewer(offset))
+	}
+
+	var result []*OrderbookLevelMismatch
+	snapshot.Iterate(func(v *OrderbookOrder) bool {
+		level, ok := book.Get(v.Price)
+		switch {
+		case ok && skip(level), !ok && skip(v):
+			// the level is updated after the snapshot.
+		case !ok:
+			result = append(result, &OrderbookLevelMismatch{Side: side, Price: v.Price, SnapshotSize: v.Size})
+		case level.Size.Cmp(&v.Size.Decimal) != 0:
+			result = append(result, &OrderbookLevelMismatch{Side: side, Price: v.Price, BookSize: level.Size, SnapshotSize: v.Size})
+		}
+		return true
+	})
+	book.Iterate(func(v *OrderbookOrder) bool {
+		if _, ok := snapshot.Get(v.Price); !ok && !skip(v) {
+			result = append(result, &OrderbookLevelMismatch{Side: side, Price: v.Price, BookSize: v.Size})
+		}
+		return true
+	})
+
+	return result
+}
+
+type managedSnapshotResult struct {
+	snapshot *OrderbookResponse
+	err      error
+}
+
+// fetchSnapshot gets the snapshot from the rest api in the background, and retries after failures if retry is set.
+func (m *ManagedOrderbook) fetchSnapshot(ctx context.Context, retry bool) chan managedSnapshotResult {
+	result := make(chan managedSnapshotResult, 1)
+	go func() {
+		for {
+			snapshot, err := m.api.GetOrderbook(ctx, m.market)
+			if err == nil || !retry || ctx.Err() != nil {
+				result <- managedSnapshotResult{snapshot: snapshot, err: err}
+				return
+			}
+			log.Warnf("failed to get orderbook snapshot of %s, retry in %v: %v", m.market, m.retryInterval, err)
+			select {
+			case <-ctx.Done():
+				result <- managedSnapshotResult{err: ctx.Err()}
+				return
+			case <-time.After(m.retryInterval):
+			}
+		}
+	}()
+	return result
+}
+
+// Run subscribes to the orderbook and maintains the book until the context is cancelled or the subscription fails.
+func (m *ManagedOrderbook) Run(ctx context.Context) error {
+	// wait for the subscription to finish after it is cancelled.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	updates := make(chan *OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(updates)
+		errChan <- m.api.SubscribeOrderbook(ctx, m.market, updates, m.subscriptionOptions...)
+	}()
+
+	var checkTicker <-chan time.Time
+	if m.checkInterval > 0 && m.checkHandler != nil {
+		ticker := time.NewTicker(m.checkInterval)
+		defer ticker.Stop()
+		checkTicker = ticker.C
+	}
+
+	// snapshotChan is not nil while the snapshot is fetched, and the updates are buffered.
+	// snapshotOffset is the offset of the subscribed message, which is included in the snapshot.
+	var snapshotChan chan managedSnapshotResult
+	var snapshotOffset *int64
+	var buffered []*OrderbookChannelResponse
+
+	// checkChan is not nil while the snapshot for the check is fetched,
+	// and checkSnapshot is the snapshot waiting for the book to catch up with its offset.
+	// checkOffset is the offset of the book when the check started, and updated tracks the updates since then.
+	var checkChan chan managedSnapshotResult
+	var checkSnapshot *OrderbookResponse
+	var checkOffset *int64
+	var updated *priceOffsets
+	stopCheck := func() {
+		checkChan = nil
+		checkSnapshot = nil
+		checkOffset = nil
+		updated = nil
+	}
+
+	notify := func() {
+		if m.updateHandler != nil {
+			m.updateHandler(m.book)
+		}
+	}
+
+	// tryCompare compares the book against the check snapshot once the book has caught up with it.
+	tryCompare := func() {
+		if checkSnapshot == nil {
+			return
+		}
+		offset := m.book.Offset()
+		if checkSnapshot.Offset != nil && (offset == nil || *offset < *checkSnapshot.Offset) {
+			return
+		}
+		m.checkHandler(&OrderbookCheckResult{
+			Market:         m.market,
+			Offset:         offset,
+			SnapshotOffset: checkSnapshot.Offset,
+			Mismatches:     compareOrderbook(m.book, checkSnapshot, updated),
+		})
+		stopCheck()
+	}
+
+	apply := func(resp *OrderbookChannelResponse) {
+		m.book.Process(resp)
+		if updated != nil {
+			if resp.Type == ChannelResponseTypeChannelBatchData {
+				for _, contents := range resp.BatchContents {
+					updated.add(contents)
+				}
+			} else if resp.Contents != nil {
+				updated.add(resp.Contents)
+			}
+		}
+		notify()
+		tryCompare()
+	}
+
+	applySnapshot := func(snapshot *OrderbookResponse) {
+		m.book.ApplySnapshot(snapshot)
+		notify()
+		for _, resp := range buffered {
+			apply(resp)
+		}
+		buffered = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case resp, ok := <-updates:
+			if !ok {
+				return <-errChan
+			}
+			switch resp.Type {
+			case ChannelResponseTypeSubscribe, ChannelResponseTypeReconnected:
+				// the book is rebuilt from the rest api snapshot.
+				m.book.Reset()
+				buffered = nil
+				snapshotOffset = nil
+				if resp.Contents != nil {
+					snapshotOffset = resp.Contents.Offset
+				}
+				stopCheck()
+				if m.resetHandler != nil {
+					m.resetHandler()
+				}
+				snapshotChan = m.fetchSnapshot(ctx, true)
+			case ChannelResponseTypeResync:
+				// the contents is a snapshot from the rest api fetched by the subscription.
+				snapshotChan = nil
+				stopCheck()
+				applySnapshot(resp.Contents)
+			default:
+				if snapshotChan != nil {
+					buffered = append(buffered, resp)
+				} else {
+					apply(resp)
+				}
+			}
+
+		case result := <-snapshotChan:
+			snapshotChan = nil
+			if result.err != nil {
+				// the snapshot is retried until the context is cancelled.
+				return nil
+			}
+			applySnapshot(orderbookSnapshotWithOffset(result.snapshot, snapshotOffset))
+
+		case <-checkTicker:
+			if snapshotChan == nil && checkChan == nil && checkSnapshot == nil {
+				checkChan = m.fetchSnapshot(ctx, false)
+				checkOffset = m.book.Offset()
+				updated = newPriceOffsets()
+			}
+
+		case result := <-checkChan:
+			checkChan = nil
+			if result.err != nil {
+				m.checkHandler(&OrderbookCheckResult{Market: m.market, Offset: m.book.Offset(), Err: result.err})
+				stopCheck()
+				continue
+			}
+			checkSnapshot = orderbookSnapshotWithOffset(result.snapshot, checkOffset)
+			tryCompare()
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package dydx_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/dydxtest"
+)
+
+func TestManagedOrderbook(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fake := &dydxtest.FakeExchange{}
+	feed := make(chan *dydx.OrderbookChannelResponse)
+	fake.SubscribeOrderbookCalls.Stub(func(args dydxtest.SubscribeOrderbookArgs) (struct{}, error) {
+		for {
+			select {
+			case <-args.Ctx.Done():
+				return struct{}{}, nil
+			case v := <-feed:
+				select {
+				case <-args.Ctx.Done():
+					return struct{}{}, nil
+				case args.OutputChan <- v:
+				}
+			}
+		}
+	})
+	snapshots := make(chan *dydx.OrderbookResponse)
+	fake.GetOrderbookCalls.Stub(func(args dydxtest.GetOrderbookArgs) (*dydx.OrderbookResponse, error) {
+		select {
+		case <-args.Ctx.Done():
+			return nil, args.Ctx.Err()
+		case v := <-snapshots:
+			return v, nil
+		}
+	})
+
+	books := make(chan string, 100)
+	checks := make(chan *dydx.OrderbookCheckResult, 10)
+	m := dydx.NewManagedOrderbook(fake, "BTC-USD",
+		dydx.SetManagedOrderbookUpdateHandler(func(ob *dydx.OrderbookProcessor) {
+			books <- fmt.Sprintf("%d:%s|%s", *ob.Offset(), ob.Bids.PrintBook(), ob.Asks.PrintBook())
+		}),
+		dydx.SetManagedOrderbookCheck(10*time.Millisecond, func(result *dydx.OrderbookCheckResult) {
+			checks <- result
+		}))
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	// the websocket snapshot is ignored, and the updates are buffered until the rest api snapshot is applied.
+	// The rest api snapshot has no offset, and it is taken after the update at offset 9.
+	subscribedOffset := int64(8)
+	feed <- &dydx.OrderbookChannelResponse{
+		ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+		Contents:              &dydx.OrderbookResponse{Offset: &subscribedOffset, Bids: []*dydx.OrderbookOrder{newTestLevel(t, "50", "1", 1)}},
+	}
+	feed <- newTestOrderbookUpdate(9, []*dydx.OrderbookOrder{newTestLevel(t, "100", "5", 9)}, nil)
+	feed <- newTestOrderbookUpdate(11, []*dydx.OrderbookOrder{newTestLevel(t, "99", "1", 11)}, nil)
+	snapshots <- &dydx.OrderbookResponse{
+		Bids: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "100"), Size: mustDecimal(t, "5"), PriceString: "100"}},
+		Asks: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "101"), Size: mustDecimal(t, "1"), PriceString: "101"}},
+	}
+
+	expected := "11:0 : 100 @ $5\n1 : 99 @ $1\n|0 : 101 @ $1\n"
+	for book := ""; book != expected; {
+		select {
+		case book = <-books:
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %q, last book %q", expected, book)
+		}
+	}
+
+	// the check snapshot is requested at offset 11, and the level at 102 added after that is not in the snapshot.
+	for fake.GetOrderbookCalls.CallCount() < 2 {
+		if ctx.Err() != nil {
+			t.Fatalf("timed out waiting for the check")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	feed <- newTestOrderbookUpdate(13, nil, []*dydx.OrderbookOrder{newTestLevel(t, "102", "1", 13)})
+	for book := ""; !strings.HasPrefix(book, "13:"); {
+		select {
+		case book = <-books:
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for the update at offset 13")
+		}
+	}
+	snapshots <- &dydx.OrderbookResponse{
+		Bids: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "100"), Size: mustDecimal(t, "2"), PriceString: "100"}},
+		Asks: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "101"), Size: mustDecimal(t, "1"), PriceString: "101"}},
+	}
+
+	select {
+	case result := <-checks:
+		if result.Err != nil || *result.Offset != 13 || *result.SnapshotOffset != 11 || len(result.Mismatches) != 2 {
+			t.Fatalf("unexpected check result: %#v", result)
+		}
+		for _, v := range result.Mismatches {
+			switch v.Price.String() {
+			case "100":
+				if v.BookSize.String() != "5" || v.SnapshotSize.String() != "2" {
+					t.Fatalf("unexpected mismatch: %#v", v)
+				}
+			case "99":
+				if v.SnapshotSize != nil {
+					t.Fatalf("unexpected mismatch: %#v", v)
+				}
+			default:
+				t.Fatalf("unexpected mismatch: %#v", v)
+			}
+		}
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for the check")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestManagedOrderbookNilCheckHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fake := &dydxtest.FakeExchange{}
+	fake.SubscribeOrderbookCalls.Stub(func(args dydxtest.SubscribeOrderbookArgs) (struct{}, error) {
+		offset := int64(1)
+		select {
+		case <-args.Ctx.Done():
+			return struct{}{}, nil
+		case args.OutputChan <- &dydx.OrderbookChannelResponse{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeSubscribe},
+			Contents:              &dydx.OrderbookResponse{Offset: &offset},
+		}:
+		}
+		<-args.Ctx.Done()
+		return struct{}{}, nil
+	})
+	fake.GetOrderbookCalls.Stub(func(args dydxtest.GetOrderbookArgs) (*dydx.OrderbookResponse, error) {
+		return &dydx.OrderbookResponse{
+			Bids: []*dydx.OrderbookOrder{{Price: mustDecimal(t, "100"), Size: mustDecimal(t, "5"), PriceString: "100"}},
+		}, nil
+	})
+
+	books := make(chan struct{}, 100)
+	m := dydx.NewManagedOrderbook(fake, "BTC-USD",
+		dydx.SetManagedOrderbookUpdateHandler(func(*dydx.OrderbookProcessor) {
+			books <- struct{}{}
+		}),
+		dydx.SetManagedOrderbookCheck(time.Millisecond, nil))
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	select {
+	case <-books:
+	case <-ctx.Done():
+		t.Fatalf("timed out waiting for the snapshot")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := fake.GetOrderbookCalls.CallCount(); n != 1 {
+		t.Errorf("expecting only the snapshot to be fetched without a check handler, got %d calls", n)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
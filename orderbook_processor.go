@@ -1,192 +1,351 @@
 package dydx
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/fardream/go-dydx/heap"
+	"github.com/fardream/go-dydx/skiplist"
 )
 
 // OrderbookProcessor maintains the state of the order book
 //
-// For now the bids and asks are maintained as a heap and
-// it is easy to return top of the book. There doesn't look to be a
-// difficult way to implement this as list as always sorted.
+// The bids and asks are maintained as skip lists sorted from the best price to the worst price,
+// so updating a price level is O(log n), and the top levels of the book can be read without sorting.
 type OrderbookProcessor struct {
 	Market string
 
 	Bids
 	Asks
 
-	dropData bool
+	// sink receives the updates passed to Process.
+	sink UpdateSink[*OrderbookChannelResponse]
 
-	Data []*OrderbookChannelResponse
+	// crossedBookHandler is called when a crossed or locked book is detected.
+	crossedBookHandler func(*CrossedBookEvent)
+	// resync fetches a snapshot after a crossed or locked book is detected.
+	resync func(market string) (*OrderbookResponse, error)
+	// resyncing is set while the resync function is called.
+	resyncing bool
+	// snapshot is the last snapshot applied by ApplySnapshot, updates not newer than it are ignored.
+	snapshot *OrderbookResponse
+	// offset is the offset of the last applied update or snapshot.
+	offset *int64
+
+	// eventHandler receives the events of the book.
+	eventHandler func(*BookEvent)
+	// topBid and topAsk are the top of the book in the last event.
+	topBid *OrderbookOrder
+	topAsk *OrderbookOrder
+}
+
+type orderbookProcessorOption func(ob *OrderbookProcessor)
+
+// SetOrderbookProcessorCrossedBookHandler sets the handler called after a crossed or locked book is detected and repaired.
+func SetOrderbookProcessorCrossedBookHandler(handler func(*CrossedBookEvent)) orderbookProcessorOption {
+	return func(ob *OrderbookProcessor) {
+		ob.crossedBookHandler = handler
+	}
+}
+
+// SetOrderbookProcessorResync sets the function to fetch a snapshot of the book (for example from Client.GetOrderbook)
+// after a crossed or locked book is detected. The book is replaced by the snapshot, and the updates not newer than the snapshot are ignored.
+// The function is called synchronously in Process.
+func SetOrderbookProcessorResync(resync func(market string) (*OrderbookResponse, error)) orderbookProcessorOption {
+	return func(ob *OrderbookProcessor) {
+		ob.resync = resync
+	}
+}
+
+// DefaultOrderbookDataRetention is the number of the updates kept by OrderbookProcessor when `dropData` is false and no sink is set.
+const DefaultOrderbookDataRetention = 10000
+
+// SetOrderbookProcessorSink sets the sink of the updates passed to Process, which overrides `dropData` of NewOrderbookProcessor.
+// For example, use NewJsonLinesSink to write the updates to a file as they arrive.
+func SetOrderbookProcessorSink(sink UpdateSink[*OrderbookChannelResponse]) orderbookProcessorOption {
+	return func(ob *OrderbookProcessor) {
+		ob.sink = sink
+	}
 }
 
 // NewOrderbookProcessor creates a orderbook processor.
-// - set `dropData` to true to drop the updates.
-func NewOrderbookProcessor(market string, dropData bool) *OrderbookProcessor {
-	return &OrderbookProcessor{
-		Market:   market,
-		dropData: dropData,
-		Bids:     Bids{mappedBook: mappedBook{locations: make(map[string]int)}},
-		Asks:     Asks{mappedBook: mappedBook{locations: make(map[string]int)}},
+//   - set `dropData` to true to drop the updates. Otherwise the last DefaultOrderbookDataRetention updates are kept, see Data.
+//   - use SetOrderbookProcessorSink to keep the updates differently.
+func NewOrderbookProcessor(market string, dropData bool, options ...orderbookProcessorOption) *OrderbookProcessor {
+	ob := &OrderbookProcessor{
+		Market: market,
+		Bids:   newBids(),
+		Asks:   newAsks(),
+	}
+	if dropData {
+		ob.sink = DiscardSink[*OrderbookChannelResponse]{}
+	} else {
+		ob.sink = NewRingBufferSink[*OrderbookChannelResponse](DefaultOrderbookDataRetention)
+	}
+	for _, option := range options {
+		option(ob)
 	}
+	return ob
+}
+
+// Data returns the updates kept when the sink is a RingBufferSink (the default when `dropData` is false), from the oldest to the newest.
+// nil for the other sinks.
+func (ob *OrderbookProcessor) Data() []*OrderbookChannelResponse {
+	if r, ok := ob.sink.(*RingBufferSink[*OrderbookChannelResponse]); ok {
+		return r.Updates()
+	}
+	return nil
 }
 
 // Process a update from the orderbook
+// The book is reset when the subscription is reconnected, and the subscribed message afterwards contains the new snapshot.
+// The book is also replaced by the contents of a resync message with ApplySnapshot.
+// The updates of a batched message are applied in order.
 func (ob *OrderbookProcessor) Process(resp *OrderbookChannelResponse) {
-	if !ob.dropData {
-		ob.Data = append(ob.Data, resp)
+	if ob.sink != nil {
+		ob.sink.Add(resp)
 	}
 
-	contents := resp.Contents
+	switch resp.Type {
+	case ChannelResponseTypeReconnected:
+		ob.Reset()
+		return
+	case ChannelResponseTypeResync:
+		ob.ApplySnapshot(resp.Contents)
+		return
+	}
+
+	if resp.Type == ChannelResponseTypeChannelBatchData {
+		for _, contents := range resp.BatchContents {
+			ob.processContents(contents)
+		}
+		return
+	}
+
+	ob.processContents(resp.Contents)
+}
+
+// processContents applies one update (or snapshot) to the book, and repairs the book if it becomes crossed.
+func (ob *OrderbookProcessor) processContents(contents *OrderbookResponse) {
 	if contents == nil {
 		return
 	}
+	if ob.snapshot != nil && !isOrderbookUpdateNewer(contents, ob.snapshot) {
+		return
+	}
 
 	if contents.Offset != nil {
 		ob.Bids.updateOffset(contents.Offset)
 		ob.Asks.updateOffset(contents.Offset)
+		ob.offset = contents.Offset
+	}
+
+	ob.updateBook(contents.Bids, &ob.Bids.bookSide)
+	ob.updateBook(contents.Asks, &ob.Asks.bookSide)
+
+	ob.checkCrossed(contents.Offset)
+	ob.emitTopOfBookIfChanged()
+}
+
+// Reset clears both sides of the book.
+func (ob *OrderbookProcessor) Reset() {
+	ob.reset()
+	ob.emitTopOfBookIfChanged()
+}
+
+// reset clears both sides of the book without emitting the top of book event.
+func (ob *OrderbookProcessor) reset() {
+	ob.Bids = newBids()
+	ob.Asks = newAsks()
+	ob.snapshot = nil
+	ob.offset = nil
+	ob.emitEvent(&BookEvent{Type: BookEventReset})
+}
+
+// ApplySnapshot replaces the book with the snapshot, for example from Client.GetOrderbook.
+//
+// The levels without offsets take the offset of the snapshot, and the updates not newer than the snapshot
+// are ignored afterwards. The levels are copied, so the snapshot is not modified by the later updates.
+// The snapshot from the rest api has no offset, and all the updates are applied unless the offset is set,
+// for example to the offset of the last update before the snapshot is requested.
+func (ob *OrderbookProcessor) ApplySnapshot(snapshot *OrderbookResponse) {
+	ob.reset()
+	if snapshot == nil {
+		ob.emitTopOfBookIfChanged()
+		return
 	}
 
-	ob.updateBook(contents.Bids, &ob.Bids)
-	ob.updateBook(contents.Asks, &ob.Asks)
+	copyLevels := func(levels []*OrderbookOrder) []*OrderbookOrder {
+		result := make([]*OrderbookOrder, 0, len(levels))
+		for _, v := range levels {
+			if v == nil {
+				continue
+			}
+			level := *v
+			if level.Offset == nil {
+				level.Offset = snapshot.Offset
+			}
+			result = append(result, &level)
+		}
+		return result
+	}
+
+	ob.updateBook(copyLevels(snapshot.Bids), &ob.Bids.bookSide)
+	ob.updateBook(copyLevels(snapshot.Asks), &ob.Asks.bookSide)
+	ob.snapshot = snapshot
+	ob.offset = snapshot.Offset
+
+	ob.checkCrossed(snapshot.Offset)
+	ob.emitTopOfBookIfChanged()
+}
+
+// Offset returns the offset of the last applied update or snapshot, nil if none of them has an offset.
+func (ob *OrderbookProcessor) Offset() *int64 {
+	return ob.offset
 }
 
 // updateBook updates one side of the book (bids or asks)
-func (ob *OrderbookProcessor) updateBook(updates []*OrderbookOrder, book singleSideOrderbook) {
+func (ob *OrderbookProcessor) updateBook(updates []*OrderbookOrder, book *bookSide) {
 	for _, order := range updates {
 		if order == nil {
 			continue
 		}
-		updatePriceLevel(book, order)
+		eventType, oldSize := updatePriceLevel(book, order)
+		if eventType != "" {
+			ob.emitLevelEvent(eventType, book.side, order.Price, oldSize, order.Size)
+		}
 	}
 }
 
-// updatePriceLevel update one price level
-func updatePriceLevel[T singleSideOrderbook](ob T, order *OrderbookOrder) {
-	index, orig_order, ok := ob.getPriceLevelIndex(order.PriceString)
+// updatePriceLevel update one price level, and returns the type of the change (empty if the level is not changed) and the size before the change.
+func updatePriceLevel(ob *bookSide, order *OrderbookOrder) (BookEventType, *Decimal) {
+	orig_order, ok := ob.Get(order.Price)
 	if ok && !orig_order.IsOtherNewerOffset(order) {
-		return
+		return "", nil
 	}
 
 	switch {
 	case order.Size.IsZero() && ok:
-		heap.Remove[T, *OrderbookOrder](ob, index)
+		ob.levels.Delete(order.Price)
+		return BookEventLevelRemoved, orig_order.Size
 	case !order.Size.IsZero() && ok:
-		ob.updatePriceLevelSize(order.PriceString, order.Size)
+		oldSize := orig_order.Size
+		orig_order.Size = order.Size
+		if order.Offset != nil {
+			orig_order.Offset = order.Offset
+		}
+		return BookEventSizeChanged, oldSize
 	case !order.Size.IsZero() && !ok:
-		heap.Push(ob, order)
+		ob.levels.Set(order.Price, order)
+		if order.Offset == nil {
+			ob.missingOffset = true
+		}
+		return BookEventLevelAdded, nil
 	}
+
+	return "", nil
 }
 
 // BookTop returns the best bid and ask of the book. nil if the side of the book is empty.
 func (ob *OrderbookProcessor) BookTop() (*OrderbookOrder, *OrderbookOrder) {
-	var bid *OrderbookOrder
-	if len(ob.Bids.Orders) > 0 {
-		bid = ob.Bids.Orders[0]
-	}
-	var ask *OrderbookOrder
-	if len(ob.Asks.Orders) > 0 {
-		ask = ob.Asks.Orders[0]
-	}
-	return bid, ask
+	return ob.Bids.Best(), ob.Asks.Best()
 }
 
-// singleSideOrderbook describe bids or asks side.
-// An interface is used to remove the check of the direction in the `Less` function.
-type singleSideOrderbook interface {
-	// allow heap operations on this type
-	heap.Interface[*OrderbookOrder]
-	getPriceLevelIndex(priceStr string) (int, *OrderbookOrder, bool)
-	updatePriceLevelSize(priceStr string, newSize *Decimal)
-}
-
-var (
-	_ singleSideOrderbook = (*Bids)(nil)
-	_ singleSideOrderbook = (*Asks)(nil)
-)
-
-// Bids side of the book.
+// Bids side of the book, sorted from the highest price to the lowest price.
 type Bids struct {
-	mappedBook
+	bookSide
 }
 
-func (b *Bids) Less(i, j int) bool {
-	return b.Orders[i].Price.GreaterThan(b.Orders[j].Price)
+func newBids() Bids {
+	return Bids{bookSide: bookSide{side: OrderSideBuy, levels: skiplist.New[*Decimal, *OrderbookOrder](decimalGreater)}}
 }
 
-// Asks side of the book.
+// Asks side of the book, sorted from the lowest price to the highest price.
 type Asks struct {
-	mappedBook
+	bookSide
 }
 
-func (a *Asks) Less(i, j int) bool {
-	return a.Orders[i].Price.LessThan(a.Orders[j].Price)
+func newAsks() Asks {
+	return Asks{bookSide: bookSide{side: OrderSideSell, levels: skiplist.New[*Decimal, *OrderbookOrder](decimalLess)}}
 }
 
-// mappedBook contains all the supporting functions for singleSideOrderbook without the less function.
-type mappedBook struct {
-	Orders    []*OrderbookOrder
-	locations map[string]int
+// bookSide contains the price levels of one side of the book, sorted from the best price to the worst price.
+type bookSide struct {
+	// side is OrderSideBuy for bids, and OrderSideSell for asks.
+	side   OrderSide
+	levels *skiplist.SkipList[*Decimal, *OrderbookOrder]
+	// missingOffset is set when a level without offset is added, and cleared when the offset is filled by updateOffset.
+	missingOffset bool
 }
 
-func (m *mappedBook) updateOffset(offset *int64) {
-	for _, v := range m.Orders {
+// updateOffset sets the offset of the levels without offset.
+func (m *bookSide) updateOffset(offset *int64) {
+	if !m.missingOffset {
+		return
+	}
+	m.missingOffset = false
+	m.levels.Ascend(func(_ *Decimal, v *OrderbookOrder) bool {
 		if v.Offset == nil {
 			v.Offset = offset
 		}
-	}
+		return true
+	})
 }
 
-func (m *mappedBook) Len() int {
-	return len(m.Orders)
+// Len returns the number of the price levels.
+func (m *bookSide) Len() int {
+	return m.levels.Len()
 }
 
-func (m *mappedBook) Swap(i, j int) {
-	m.locations[m.Orders[i].PriceString], m.locations[m.Orders[j].PriceString] = j, i
-	m.Orders[i], m.Orders[j] = m.Orders[j], m.Orders[i]
+// Best returns the best price level, nil if the side is empty.
+func (m *bookSide) Best() *OrderbookOrder {
+	_, v, _ := m.levels.First()
+	return v
 }
 
-func (m *mappedBook) Pop() *OrderbookOrder {
-	if len(m.Orders) == 0 {
-		return nil
-	}
-	order := m.Orders[len(m.Orders)-1]
-	m.Orders = m.Orders[0 : len(m.Orders)-1]
-	delete(m.locations, order.PriceString)
-
-	return order
+// Get returns the price level at the price.
+func (m *bookSide) Get(price *Decimal) (*OrderbookOrder, bool) {
+	return m.levels.Get(price)
 }
 
-func (m *mappedBook) Push(order *OrderbookOrder) {
-	m.Orders = append(m.Orders, order)
-	m.locations[order.PriceString] = len(m.Orders) - 1
-}
-
-func (m *mappedBook) getPriceLevelIndex(priceStr string) (int, *OrderbookOrder, bool) {
-	r, ok := m.locations[priceStr]
-	if !ok {
-		return r, nil, false
+// Levels returns the best n price levels from the best price to the worst price.
+// All the levels are returned if n is negative.
+func (m *bookSide) Levels(n int) []*OrderbookOrder {
+	if n < 0 || n > m.Len() {
+		n = m.Len()
 	}
-	if r >= len(m.Orders) {
-		return 0, nil, false
-	}
-	return r, m.Orders[r], true
+	result := make([]*OrderbookOrder, 0, n)
+	m.Iterate(func(v *OrderbookOrder) bool {
+		if len(result) >= n {
+			return false
+		}
+		result = append(result, v)
+		return true
+	})
+	return result
 }
 
-func (m *mappedBook) updatePriceLevelSize(priceStr string, news_size *Decimal) {
-	r, ok := m.locations[priceStr]
-	if ok {
-		m.Orders[r].Size = news_size
-	}
+// Iterate calls f on the price levels from the best price to the worst price until f returns false.
+// The book must not be updated in f.
+func (m *bookSide) Iterate(f func(*OrderbookOrder) bool) {
+	m.levels.Ascend(func(_ *Decimal, v *OrderbookOrder) bool {
+		return f(v)
+	})
 }
 
-func (m *mappedBook) PrintBook() string {
+// PrintBook prints the price levels from the best price to the worst price.
+func (m *bookSide) PrintBook() string {
 	var b strings.Builder
-	for index, v := range m.Orders {
+	index := 0
+	m.Iterate(func(v *OrderbookOrder) bool {
 		fmt.Fprintf(&b, "%d : %s @ $%s\n", index, v.Price.String(), v.Size.String())
-	}
+		index++
+		return true
+	})
 	return b.String()
 }
+
+// MarshalJSON outputs the price levels from the best price to the worst price.
+func (m bookSide) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Levels(-1))
+}
@@ -0,0 +1,56 @@
+package dydx
+
+import (
+	"time"
+)
+
+// ReconnectPolicy controls how a websocket subscription redials and resubscribes after the connection is lost.
+//
+// After a successful reconnect, a synthetic response with type ChannelResponseTypeReconnected is sent to the output channel
+// right before the new subscribed message, so the consumers know to reset their states.
+// Errors returned by the server for the subscription request are not retried.
+type ReconnectPolicy struct {
+	// InitialBackoff is the wait before the first redial.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between redials.
+	MaxBackoff time.Duration
+	// Multiplier is applied to the wait after each failed attempt.
+	Multiplier float64
+	// MaxAttempts is the number of consecutive failed attempts before giving up. 0 means retrying forever.
+	MaxAttempts int
+}
+
+// NewDefaultReconnectPolicy creates a policy starting with 500ms backoff, doubling up to 30s, and retrying forever.
+func NewDefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+// getBackoff returns the wait before the attempt, which starts from 1.
+func (p *ReconnectPolicy) getBackoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < float64(p.MaxBackoff)); i++ {
+		if p.Multiplier > 1 {
+			backoff *= p.Multiplier
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	return time.Duration(backoff)
+}
+
+// isExhausted checks if the attempt exceeds the max attempts.
+func (p *ReconnectPolicy) isExhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt > p.MaxAttempts
+}
+
+// SetClientReconnectPolicy sets the reconnect policy for the websocket subscriptions. nil (the default) disables reconnect.
+func SetClientReconnectPolicy(policy *ReconnectPolicy) clientOption {
+	return func(c *Client) {
+		c.reconnectPolicy = policy
+	}
+}
@@ -0,0 +1,141 @@
+package dydx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RecordedFrame is one line of the recording written by SetSubscriptionRecorder.
+type RecordedFrame struct {
+	// ReceivedAt is the time the frame is read from the websocket.
+	ReceivedAt time.Time `json:"received_at"`
+	// Synthetic is true for the messages generated by the library (reconnected and gap), whose Frame only contains the header.
+	Synthetic bool `json:"synthetic,omitempty"`
+	// Frame is the bytes of the message as received, except the line breaks (only possible as whitespace between the tokens
+	// of the message) are replaced by spaces to keep the frame in one line.
+	Frame json.RawMessage `json:"frame"`
+}
+
+// recordWsEvent writes the event as one line of json. The line is built by hand so that the frame is written
+// as received, json.Marshal would compact it and escape the html characters.
+func recordWsEvent(w io.Writer, event *wsEvent) error {
+	frame := event.data
+	synthetic := frame == nil
+	if synthetic {
+		header, err := json.Marshal(&event.header)
+		if err != nil {
+			return err
+		}
+		frame = header
+	}
+	receivedAt, err := json.Marshal(event.receivedAt)
+	if err != nil {
+		return err
+	}
+
+	line := make([]byte, 0, len(frame)+len(receivedAt)+48)
+	line = append(line, `{"received_at":`...)
+	line = append(line, receivedAt...)
+	if synthetic {
+		line = append(line, `,"synthetic":true`...)
+	}
+	line = append(line, `,"frame":`...)
+	for _, c := range frame {
+		if c == '\n' || c == '\r' {
+			c = ' '
+		}
+		line = append(line, c)
+	}
+	line = append(line, "}\n"...)
+
+	_, err = w.Write(line)
+	return err
+}
+
+// RecordedFrameReader reads the frames written by SetSubscriptionRecorder.
+type RecordedFrameReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+// NewRecordedFrameReader creates a reader for the recording.
+func NewRecordedFrameReader(r io.Reader) *RecordedFrameReader {
+	return &RecordedFrameReader{reader: bufio.NewReader(r)}
+}
+
+// Next returns the next frame in the recording, or io.EOF at the end. Empty lines are skipped.
+func (r *RecordedFrameReader) Next() (*RecordedFrame, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		r.line++
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\n') {
+			continue
+		}
+
+		frame := new(RecordedFrame)
+		if err := json.Unmarshal(line, frame); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of recording: %w", r.line, err)
+		}
+		return frame, nil
+	}
+}
+
+// toWsEvent converts the frame back to the event delivered to the subscription.
+func (f *RecordedFrame) toWsEvent() (*wsEvent, error) {
+	event := &wsEvent{receivedAt: f.ReceivedAt}
+	if err := json.Unmarshal(f.Frame, &event.header); err != nil {
+		return nil, err
+	}
+	if !f.Synthetic {
+		event.data = f.Frame
+	}
+	return event, nil
+}
+
+// ReplayRecording reads the frames written by SetSubscriptionRecorder, and sends the ones for the channel and id to the output channel.
+// Empty channel or id matches all. The frames are parsed the same way as a live subscription, and the replay stops
+// with a ChannelError for an error message. It returns nil at the end of the recording, or when the context is cancelled.
+func ReplayRecording[TContents any](ctx context.Context, r io.Reader, channel, id string, outputChan chan<- *ChannelResponse[TContents]) error {
+	reader := NewRecordedFrameReader(r)
+	for {
+		frame, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		event, err := frame.toWsEvent()
+		if err != nil {
+			log.Warnf("failed to parse data: %v", err)
+			continue
+		}
+		if (channel != "" && event.header.Channel != channel) || (id != "" && event.header.Id != id) {
+			continue
+		}
+
+		resp, err := parseWsEvent[TContents](event)
+		if err != nil {
+			log.Warnf("failed to parse data: %v", err)
+			continue
+		}
+		if resp.Type == ChannelResponseTypeError {
+			return &ChannelError{ChannelResponseHeader: resp.ChannelResponseHeader}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case outputChan <- resp:
+		}
+	}
+}
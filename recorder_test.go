@@ -0,0 +1,216 @@
+package dydx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+func TestSubscriptionRecorder(t *testing.T) {
+	server := newScriptedWsServer(t, [][]string{
+		{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"10","bids":[{"price":"100","size":"1"}],"asks":[{"price":"101","size":"1"}]}}`,
+			`{"type":"channel_data","channel":"v3_orderbook","id":"BTC-USD","message_id":2,"contents":{"offset":"11","bids":[["99","2"]],"asks":[]}}`,
+		},
+		{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"20","bids":[{"price":"98","size":"3"}],"asks":[{"price":"102","size":"1"}]}}`,
+		},
+	})
+	defer server.Close()
+
+	policy := &dydx.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2, MaxAttempts: 3}
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)), dydx.SetClientReconnectPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var recording bytes.Buffer
+	outputs := make(chan *dydx.OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(outputs)
+		errChan <- client.SubscribeOrderbook(ctx, "BTC-USD", outputs, dydx.SetSubscriptionRecorder(&recording))
+	}()
+
+	var live []*dydx.OrderbookChannelResponse
+	for v := range outputs {
+		live = append(live, v)
+		if len(live) == 4 {
+			cancel()
+		}
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+
+	reader := dydx.NewRecordedFrameReader(bytes.NewReader(recording.Bytes()))
+	frame, err := reader.Next()
+	if err != nil || frame.Synthetic || frame.ReceivedAt.IsZero() {
+		t.Fatalf("unexpected first frame %#v: %v", frame, err)
+	}
+
+	replayed := make(chan *dydx.OrderbookChannelResponse, len(live)+1)
+	if err := dydx.ReplayRecording(context.Background(), bytes.NewReader(recording.Bytes()), dydx.OrderbookChannel, "BTC-USD", replayed); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	close(replayed)
+
+	var replayedData []*dydx.OrderbookChannelResponse
+	for v := range replayed {
+		replayedData = append(replayedData, v)
+	}
+
+	liveJson, _ := json.Marshal(live)
+	replayedJson, _ := json.Marshal(replayedData)
+	if !bytes.Equal(liveJson, replayedJson) {
+		t.Fatalf("replayed data is different from live: %s", cmp.Diff(string(liveJson), string(replayedJson)))
+	}
+}
+
+func TestSubscriptionRecorderExactFrame(t *testing.T) {
+	frames := []string{
+		`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","message_id":1,"contents":{"trades":[]}}`,
+		`{ "type" : "channel_data", "channel":"v3_trades","id":"BTC-USD","message_id":2,"contents":{"trades":[],"note":"a & b <c>"} }`,
+	}
+	server := newScriptedWsServer(t, [][]string{frames})
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var recording bytes.Buffer
+	outputs := make(chan *dydx.TradesChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- conn.SubscribeTrades(ctx, "BTC-USD", outputs, dydx.SetSubscriptionRecorder(&recording))
+	}()
+	for range frames {
+		<-outputs
+	}
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+
+	reader := dydx.NewRecordedFrameReader(bytes.NewReader(recording.Bytes()))
+	for _, expected := range frames {
+		frame, err := reader.Next()
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if string(frame.Frame) != expected {
+			t.Fatalf("expecting frame %s, got %s", expected, frame.Frame)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestSubscriptionRecorderOverflow(t *testing.T) {
+	const updates = 400
+	script := []string{`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","contents":{"trades":[]}}`}
+	for i := 0; i < updates; i++ {
+		script = append(script, fmt.Sprintf(`{"type":"channel_data","channel":"v3_trades","id":"BTC-USD","contents":{"trades":[],"index":%d}}`, i))
+	}
+	server := newScriptedWsServer(t, [][]string{script})
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// nobody reads the output, so the queue overflows.
+	var recording syncBuffer
+	go conn.SubscribeTrades(ctx, "BTC-USD", make(chan *dydx.TradesChannelResponse), dydx.SetSubscriptionRecorder(&recording))
+
+	for {
+		if bytes.Count(recording.Bytes(), []byte("\n")) >= len(script) {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("timed out waiting for the recording")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	reader := dydx.NewRecordedFrameReader(bytes.NewReader(recording.Bytes()))
+	for _, expected := range script {
+		frame, err := reader.Next()
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if frame.Synthetic || string(frame.Frame) != expected {
+			t.Fatalf("expecting frame %s, got %#v", expected, frame)
+		}
+	}
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := dydx.NewRotatingFileWriter(dir, "test", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	lines := []string{"0123456\n", "789\n", "abcdefghijklmn\n", "o\n"}
+	for _, line := range lines {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if _, err := w.Write([]byte("p\n")); err == nil {
+		t.Fatalf("write after close should fail")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+	var contents []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		contents = append(contents, string(data))
+	}
+
+	expected := []string{"0123456\n", "789\n", "abcdefghijklmn\n", "o\n"}
+	if !cmp.Equal(contents, expected) {
+		t.Fatalf("unexpected files: %s", cmp.Diff(expected, contents))
+	}
+}
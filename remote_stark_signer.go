@@ -0,0 +1,198 @@
+package dydx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol of the remote stark signer:
+//
+// - GET <endpoint>/public-key returns RemoteStarkPublicKeyResponse.
+//
+// - POST <endpoint>/sign with RemoteStarkSignRequest returns RemoteStarkSignResponse.
+//
+// All numbers are hex encoded with 0x prefix.
+const (
+	remoteStarkSignerPublicKeyPath = "public-key"
+	remoteStarkSignerSignPath      = "sign"
+)
+
+type RemoteStarkSignRequest struct {
+	Hash string `json:"hash"`
+}
+
+type RemoteStarkSignResponse struct {
+	R string `json:"r"`
+	S string `json:"s"`
+}
+
+type RemoteStarkPublicKeyResponse struct {
+	PublicKey            string `json:"publicKey"`
+	PublicKeyYCoordinate string `json:"publicKeyYCoordinate"`
+}
+
+// RemoteStarkSigner is a StarkSigner that sends the message hashes to a remote signer over http or unix socket,
+// so the trading process never sees the private key.
+// The remote side can be served by NewStarkSignerHandler.
+type RemoteStarkSigner struct {
+	baseUrl    string
+	httpClient *http.Client
+
+	publicKey            string
+	publicKeyYCoordinate string
+}
+
+var _ StarkSigner = (*RemoteStarkSigner)(nil)
+
+// NewRemoteStarkSigner connects to the remote signer at endpoint and retrieves the public key.
+// endpoint can be http(s)://host:port/path or unix:///path/to/socket.
+func NewRemoteStarkSigner(ctx context.Context, endpoint string) (*RemoteStarkSigner, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint %s: %w", endpoint, err)
+	}
+
+	r := &RemoteStarkSigner{baseUrl: endpoint, httpClient: &http.Client{Timeout: 15 * time.Second}}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "unix":
+		socketPath := u.Path
+		r.baseUrl = "http://unix"
+		r.httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %s for remote stark signer", u.Scheme)
+	}
+
+	pubkey, err := doRemoteStarkSignerRequest[RemoteStarkPublicKeyResponse](ctx, r, http.MethodGet, remoteStarkSignerPublicKeyPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from remote signer: %w", err)
+	}
+	r.publicKey = stripLeadingZeros(strings.TrimPrefix(pubkey.PublicKey, "0x"))
+	r.publicKeyYCoordinate = stripLeadingZeros(strings.TrimPrefix(pubkey.PublicKeyYCoordinate, "0x"))
+
+	return r, nil
+}
+
+// SignStarkHash sends the hash to the remote signer.
+func (r *RemoteStarkSigner) SignStarkHash(ctx context.Context, msgHash *big.Int) (*big.Int, *big.Int, error) {
+	if msgHash == nil {
+		return nil, nil, fmt.Errorf("message hash is nil")
+	}
+	body, err := json.Marshal(&RemoteStarkSignRequest{Hash: "0x" + msgHash.Text(16)})
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := doRemoteStarkSignerRequest[RemoteStarkSignResponse](ctx, r, http.MethodPost, remoteStarkSignerSignPath, body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote signer failed to sign: %w", err)
+	}
+	sigR, ok := new(big.Int).SetString(resp.R, 0)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid r from remote signer: %s", resp.R)
+	}
+	sigS, ok := new(big.Int).SetString(resp.S, 0)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid s from remote signer: %s", resp.S)
+	}
+	return sigR, sigS, nil
+}
+
+// StarkPublicKey returns the public key retrieved when the signer is created.
+func (r *RemoteStarkSigner) StarkPublicKey() (string, string) {
+	return r.publicKey, r.publicKeyYCoordinate
+}
+
+func doRemoteStarkSignerRequest[TResponse any](ctx context.Context, r *RemoteStarkSigner, httpMethod, path string, body []byte) (*TResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, urlJoin(r.baseUrl, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	msg, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, &DydxError{HttpStatusCode: resp.StatusCode, Message: resp.Status, Body: msg}
+	}
+
+	result := new(TResponse)
+	if err := json.Unmarshal(msg, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+
+	return result, nil
+}
+
+// NewStarkSignerHandler serves the signer with the remote stark signer protocol.
+// This can be used to build a signing service holding the private key.
+// The handler doesn't authenticate the requests - the listener should be properly protected (for example a unix socket with restricted permissions).
+func NewStarkSignerHandler(signer StarkSigner) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+remoteStarkSignerPublicKeyPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pubkey, pubkeyY := signer.StarkPublicKey()
+		writeJsonResponse(w, &RemoteStarkPublicKeyResponse{PublicKey: "0x" + pubkey, PublicKeyYCoordinate: "0x" + pubkeyY})
+	})
+	mux.HandleFunc("/"+remoteStarkSignerSignPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var signReq RemoteStarkSignRequest
+		if err := json.NewDecoder(req.Body).Decode(&signReq); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse request: %v", err), http.StatusBadRequest)
+			return
+		}
+		msgHash, ok := new(big.Int).SetString(signReq.Hash, 0)
+		if !ok {
+			http.Error(w, fmt.Sprintf("invalid hash: %s", signReq.Hash), http.StatusBadRequest)
+			return
+		}
+		r, s, err := signer.SignStarkHash(req.Context(), msgHash)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to sign: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJsonResponse(w, &RemoteStarkSignResponse{R: "0x" + r.Text(16), S: "0x" + s.Text(16)})
+	})
+	return mux
+}
+
+func writeJsonResponse(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
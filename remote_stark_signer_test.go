@@ -0,0 +1,81 @@
+package dydx_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-dydx"
+	"github.com/fardream/go-dydx/starkex"
+)
+
+const (
+	mockStarkPublicKey  = "3b865a18323b8d147a12c556bfb1d502516c325b1477a23ba6c77af31f020fd"
+	mockStarkPrivateKey = "58c7d5a90b1776bde86ebac077e053ed85b0f7164f53b080304a531947f46e3"
+)
+
+func checkRemoteStarkSigner(t *testing.T, signer *dydx.RemoteStarkSigner) {
+	if pubkey, _ := signer.StarkPublicKey(); pubkey != mockStarkPublicKey {
+		t.Fatalf("expecting public key %s, got %s", mockStarkPublicKey, pubkey)
+	}
+
+	client, err := dydx.NewClient(nil, nil, "", false, dydx.SetClientStarkSigner(signer))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	param := starkex.WithdrawSignParam{
+		PositionId:  12345,
+		HumanAmount: "49.478023",
+		ClientId:    "This is an ID that the client came up with to describe this withdrawal",
+		Expiration:  "2020-09-17T04:15:55.028Z",
+	}
+	sign, err := client.SignWithdrawal(context.Background(), param)
+	if err != nil {
+		t.Fatalf("failed to sign withdrawal: %v", err)
+	}
+	correct_sign := "05e48c33f8205a5359c95f1bd7385c1c1f587e338a514298c07634c0b6c952ba0687d6980502a5d7fa84ef6fdc00104db22c43c7fb83e88ca84f19faa9ee3de1"
+	if sign != correct_sign {
+		t.Fatalf("Expecting: %s\n, got: %s", correct_sign, sign)
+	}
+}
+
+func TestRemoteStarkSignerHttp(t *testing.T) {
+	server := httptest.NewServer(dydx.NewStarkSignerHandler(dydx.NewStarkKey(mockStarkPublicKey, "", mockStarkPrivateKey)))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signer, err := dydx.NewRemoteStarkSigner(ctx, server.URL)
+	if err != nil {
+		t.Fatalf("failed to create remote signer: %v", err)
+	}
+
+	checkRemoteStarkSigner(t, signer)
+}
+
+func TestRemoteStarkSignerUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix socket is not supported: %v", err)
+	}
+	server := &http.Server{Handler: dydx.NewStarkSignerHandler(dydx.NewStarkKey(mockStarkPublicKey, "", mockStarkPrivateKey))}
+	go server.Serve(listener)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signer, err := dydx.NewRemoteStarkSigner(ctx, "unix://"+socketPath)
+	if err != nil {
+		t.Fatalf("failed to create remote signer: %v", err)
+	}
+
+	checkRemoteStarkSigner(t, signer)
+}
@@ -0,0 +1,124 @@
+package dydx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RotatingFileWriter writes into a series of files in a directory, and starts a new file when the current one
+// exceeds the max size or is older than the max age. Each call to Write goes into one file, so records written by
+// SetSubscriptionRecorder are never split across files. It is safe for concurrent use.
+//
+// The files are named <prefix>-<utc time of creation>.jsonl.
+type RotatingFileWriter struct {
+	dir    string
+	prefix string
+	// maxSize in bytes. 0 means no limit.
+	maxSize int64
+	// maxAge of a file. 0 means no limit.
+	maxAge time.Duration
+
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+}
+
+var _ io.WriteCloser = (*RotatingFileWriter)(nil)
+
+// NewRotatingFileWriter creates the directory if necessary, and opens the first file.
+func NewRotatingFileWriter(dir, prefix string, maxSize int64, maxAge time.Duration) (*RotatingFileWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	w := &RotatingFileWriter{
+		dir:     dir,
+		prefix:  prefix,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+	if err := w.rotate(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// rotate closes the current file and opens a new one. mutex must be held.
+func (w *RotatingFileWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+
+	now := time.Now()
+	name := filepath.Join(w.dir, fmt.Sprintf("%s-%s.jsonl", w.prefix, now.UTC().Format("20060102T150405.000000000Z")))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = now
+	return nil
+}
+
+// Write writes the data into the current file, after rotating the file if necessary.
+func (w *RotatingFileWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	// file is nil if the last rotation failed.
+	if w.file == nil || w.size > 0 && ((w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize) || (w.maxAge > 0 && time.Since(w.openedAt) >= w.maxAge)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// FileName returns the name of the current file.
+func (w *RotatingFileWriter) FileName() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return ""
+	}
+	return w.file.Name()
+}
+
+// Close closes the current file.
+func (w *RotatingFileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
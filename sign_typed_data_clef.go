@@ -0,0 +1,53 @@
+package dydx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const clefSignTypedDataMethod = "account_signTypedData"
+
+// ClefSigner implements the SignTypedData interface with an external signer speaking the json-rpc api of clef:
+// https://geth.ethereum.org/docs/tools/clef/apis#accountsigntypeddata
+type ClefSigner struct {
+	client  *rpc.Client
+	address common.MixedcaseAddress
+	timeout time.Duration
+}
+
+var _ SignTypedData = (*ClefSigner)(nil)
+
+// NewClefSigner connects to the external signer at endpoint (http, websocket, or ipc path) to sign for the address.
+// Signing requests may need manual approval on the signer, timeout should be set accordingly.
+func NewClefSigner(ctx context.Context, endpoint string, address common.Address, timeout time.Duration) (*ClefSigner, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external signer %s: %w", endpoint, err)
+	}
+
+	return &ClefSigner{client: client, address: common.NewMixedcaseAddress(address), timeout: timeout}, nil
+}
+
+// EthSignTypedData calls account_signTypedData on the external signer.
+func (s *ClefSigner) EthSignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	if err := s.client.CallContext(ctx, &sig, clefSignTypedDataMethod, s.address, typedData); err != nil {
+		return nil, fmt.Errorf("external signer failed to sign typed data: %w", err)
+	}
+
+	return toLegacySignature(sig)
+}
+
+// Close closes the connection to the external signer.
+func (s *ClefSigner) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,122 @@
+package dydx_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+// clefStandIn serves account_signTypedData like clef, with the test private key.
+type clefStandIn struct{}
+
+func (clefStandIn) SignTypedData(_ context.Context, addr common.MixedcaseAddress, typedData apitypes.TypedData) (hexutil.Bytes, error) {
+	return dydx.NewEcdsaPrivateKeySigner(privateKey).EthSignTypedData(typedData)
+}
+
+// SignData serves account_signData like clef, only text/plain is supported.
+func (clefStandIn) SignData(_ context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+	sig, err := crypto.Sign(accounts.TextHash(data), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+func checkSignTypedData(t *testing.T, signer dydx.SignTypedData) {
+	for _, signatureType := range []dydx.SignatureType{dydx.SignatureTypeNoPrepend, dydx.SignatureTypeDecimal} {
+		expected, err := dydx.DeriveStarkKey(dydx.NewEcdsaPrivateKeySigner(privateKey), false, signatureType)
+		if err != nil {
+			t.Fatalf("failed to derive stark key: %v", err)
+		}
+		got, err := dydx.DeriveStarkKey(signer, false, signatureType)
+		if err != nil {
+			t.Fatalf("failed to derive stark key with %s: %v", signatureType, err)
+		}
+		if !cmp.Equal(expected, got) {
+			t.Fatalf("%s: expecting %s, got %s", signatureType, spewConfig.Sdump(expected), spewConfig.Sdump(got))
+		}
+	}
+}
+
+func TestKeyStoreFileSigner(t *testing.T) {
+	key := &keystore.Key{
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}
+	data, err := keystore.EncryptKey(key, "passphrase", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("failed to encrypt key: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(filename, data, 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+
+	if _, err := dydx.NewKeyStoreFileSigner(filename, "wrong passphrase"); err == nil {
+		t.Fatalf("expecting error for wrong passphrase")
+	}
+
+	signer, err := dydx.NewKeyStoreFileSigner(filename, "passphrase")
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	checkSignTypedData(t, signer)
+}
+
+func TestWalletSigner(t *testing.T) {
+	ks := keystore.NewKeyStore(t.TempDir(), keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(privateKey, "passphrase")
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	if err := ks.Unlock(account, "passphrase"); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	wallets := ks.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("expecting 1 wallet, got %d", len(wallets))
+	}
+
+	checkSignTypedData(t, dydx.NewWalletSigner(wallets[0], account))
+}
+
+func TestClefSigner(t *testing.T) {
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("account", clefStandIn{}); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	signer, err := dydx.NewClefSigner(ctx, httpServer.URL, crypto.PubkeyToAddress(privateKey.PublicKey), 10*time.Second)
+	if err != nil {
+		t.Fatalf("failed to connect to signer: %v", err)
+	}
+	defer signer.Close()
+
+	checkSignTypedData(t, signer)
+}
@@ -0,0 +1,63 @@
+package dydx
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// walletSigner implements the SignTypedData interface for accounts.Wallet.
+type walletSigner struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+// NewWalletSigner converts an account in accounts.Wallet (keystore, usb hardware wallets etc) into a signer to EthSignTypedData.
+// The wallet must be opened, and the account unlocked if necessary.
+func NewWalletSigner(wallet accounts.Wallet, account accounts.Account) *walletSigner {
+	return &walletSigner{wallet: wallet, account: account}
+}
+
+// EthSignTypedData sends the raw bytes of the typed data (see prepareTypedDataForSign) to Wallet.SignData with mime type of typed data.
+func (w *walletSigner) EthSignTypedData(typedData apitypes.TypedData) ([]byte, error) {
+	rawData, err := prepareTypedDataForSign(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert typed data into raw bytes: %w", err)
+	}
+	sig, err := w.wallet.SignData(w.account, accounts.MimetypeTypedData, rawData)
+	if err != nil {
+		return nil, fmt.Errorf("wallet failed to sign the raw bytes for typed data: %w", err)
+	}
+
+	return toLegacySignature(sig)
+}
+
+// NewKeyStoreFileSigner decrypts the key file of go-ethereum's keystore (accounts/keystore) with the passphrase,
+// and returns a signer to EthSignTypedData.
+func NewKeyStoreFileSigner(filename string, passphrase string) (*ecdsaPrivateKeySigner, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key file %s: %w", filename, err)
+	}
+
+	return NewEcdsaPrivateKeySigner(key.PrivateKey), nil
+}
+
+// toLegacySignature makes sure the recovery id (v) of the signature is 27 or 28 (Legacy Signing).
+func toLegacySignature(sig []byte) ([]byte, error) {
+	if len(sig) != 65 {
+		return nil, fmt.Errorf("invalid signature length: %d", len(sig))
+	}
+	if sig[64] < 27 {
+		sig[64] += 27
+	}
+
+	return sig, nil
+}
@@ -0,0 +1,261 @@
+package dydx
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// SignatureType is appended to the ethereum signatures used by dydx, and indicates how the hash of the typed data is signed.
+// Wallets onboarded with different signature types derive different stark keys and api keys.
+//
+// See https://github.com/dydxprotocol/dydx-v3-python/blob/914fc66e542d82080702e03f6ad078ca2901bb46/dydx3/constants.py
+type SignatureType byte
+
+const (
+	// SignatureTypeNoPrepend signs the EIP-712 hash of the typed data directly (eth_signTypedData).
+	SignatureTypeNoPrepend SignatureType = 0
+	// SignatureTypeDecimal signs the hash prefixed with "\x19Ethereum Signed Message:\n32", which is the same as personal_sign of the hash.
+	SignatureTypeDecimal SignatureType = 1
+	// SignatureTypeHexadecimal signs the hash prefixed with "\x19Ethereum Signed Message:\n\x20".
+	SignatureTypeHexadecimal SignatureType = 2
+	// SignatureTypePersonal signs a human readable json text of the typed data with personal_sign, instead of the hash.
+	// This is how the dydx web frontend onboards wallets that don't support eth_signTypedData.
+	SignatureTypePersonal SignatureType = 3
+)
+
+const (
+	prependDecimal     = "\x19Ethereum Signed Message:\n32"
+	prependHexadecimal = "\x19Ethereum Signed Message:\n\x20"
+)
+
+func (t SignatureType) String() string {
+	switch t {
+	case SignatureTypeNoPrepend:
+		return "no-prepend"
+	case SignatureTypeDecimal:
+		return "decimal"
+	case SignatureTypeHexadecimal:
+		return "hexadecimal"
+	case SignatureTypePersonal:
+		return "personal"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// SignEthHash signs a 32 byte hash directly. Signers must implement this for SignatureTypeHexadecimal.
+type SignEthHash interface {
+	EthSignHash(hash []byte) ([]byte, error)
+}
+
+// SignPersonalMessage signs a message with the ethereum personal message prefix (personal_sign).
+// Signers implementing this can be used for SignatureTypePersonal, and (as SignEthHash) for SignatureTypeDecimal.
+type SignPersonalMessage interface {
+	EthSignPersonalMessage(message []byte) ([]byte, error)
+}
+
+// getTypedDataHash returns the EIP-712 hash of the typed data.
+func getTypedDataHash(typedData apitypes.TypedData) ([]byte, error) {
+	rawData, err := prepareTypedDataForSign(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert typed data into raw bytes: %w", err)
+	}
+	return crypto.Keccak256(rawData), nil
+}
+
+// getPersonalSignMessage returns the text signed for SignatureTypePersonal: the message and the domain of the typed data
+// in json with sorted keys and indented by 2 spaces.
+//
+// See getPersonalSignMessage in https://github.com/dydxprotocol/v3-client/blob/master/src/eth-signing/sign-off-chain-action.ts
+func getPersonalSignMessage(typedData apitypes.TypedData) ([]byte, error) {
+	values := make(map[string]any, len(typedData.Message)+3)
+	for k, v := range typedData.Message {
+		values[k] = v
+	}
+	values["name"] = typedData.Domain.Name
+	values["version"] = typedData.Domain.Version
+	if typedData.Domain.ChainId != nil {
+		values["chainId"] = (*big.Int)(typedData.Domain.ChainId)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(values); err != nil {
+		return nil, fmt.Errorf("failed to encode personal sign message: %w", err)
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// getPrependedHash returns the hash that is actually signed for the signature type.
+func getPrependedHash(typedDataHash []byte, signatureType SignatureType) ([]byte, error) {
+	switch signatureType {
+	case SignatureTypeNoPrepend:
+		return typedDataHash, nil
+	case SignatureTypeDecimal:
+		return crypto.Keccak256([]byte(prependDecimal), typedDataHash), nil
+	case SignatureTypeHexadecimal:
+		return crypto.Keccak256([]byte(prependHexadecimal), typedDataHash), nil
+	case SignatureTypePersonal:
+		return nil, fmt.Errorf("signature type %s doesn't sign the typed data hash", signatureType)
+	default:
+		return nil, fmt.Errorf("unknown signature type: %d", byte(signatureType))
+	}
+}
+
+// SignTypedDataWithType signs the typed data with the signature type, and appends the type to the signature.
+// SignatureTypeHexadecimal requires the signer to implement SignEthHash, SignatureTypeDecimal requires SignEthHash or SignPersonalMessage,
+// and SignatureTypePersonal requires SignPersonalMessage.
+func SignTypedDataWithType(signer SignTypedData, typedData apitypes.TypedData, signatureType SignatureType) ([]byte, error) {
+	var sig []byte
+	var err error
+
+	switch signatureType {
+	case SignatureTypeNoPrepend:
+		sig, err = signer.EthSignTypedData(typedData)
+	case SignatureTypeDecimal, SignatureTypeHexadecimal:
+		typedDataHash, hashErr := getTypedDataHash(typedData)
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		if hashSigner, ok := signer.(SignEthHash); ok {
+			prependedHash, _ := getPrependedHash(typedDataHash, signatureType)
+			sig, err = hashSigner.EthSignHash(prependedHash)
+		} else if personalSigner, ok := signer.(SignPersonalMessage); ok && signatureType == SignatureTypeDecimal {
+			sig, err = personalSigner.EthSignPersonalMessage(typedDataHash)
+		} else {
+			return nil, fmt.Errorf("signer doesn't support signature type %s", signatureType)
+		}
+	case SignatureTypePersonal:
+		personalSigner, ok := signer.(SignPersonalMessage)
+		if !ok {
+			return nil, fmt.Errorf("signer doesn't support signature type %s", signatureType)
+		}
+		message, msgErr := getPersonalSignMessage(typedData)
+		if msgErr != nil {
+			return nil, msgErr
+		}
+		sig, err = personalSigner.EthSignPersonalMessage(message)
+	default:
+		return nil, fmt.Errorf("unknown signature type: %d", byte(signatureType))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign typed data %#v: %w", typedData, err)
+	}
+
+	return append(sig, byte(signatureType)), nil
+}
+
+// EcRecoverTypedSignature recovers the ethereum address from the typed data hash and the signature with the signature type appended.
+// This is the reverse of the signing process for onboarding and key derivation.
+// SignatureTypePersonal doesn't sign the hash, use EcRecoverTypedDataSignature for it.
+func EcRecoverTypedSignature(typedDataHash []byte, typedSignature []byte) (common.Address, error) {
+	if len(typedSignature) != 66 {
+		return common.Address{}, fmt.Errorf("invalid typed signature length: %d", len(typedSignature))
+	}
+	hash, err := getPrependedHash(typedDataHash, SignatureType(typedSignature[65]))
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return ecRecover(hash, typedSignature)
+}
+
+// EcRecoverTypedDataSignature recovers the ethereum address from the typed data and the signature with the signature type appended.
+// Unlike EcRecoverTypedSignature, this supports all the signature types.
+func EcRecoverTypedDataSignature(typedData apitypes.TypedData, typedSignature []byte) (common.Address, error) {
+	if len(typedSignature) != 66 {
+		return common.Address{}, fmt.Errorf("invalid typed signature length: %d", len(typedSignature))
+	}
+	if SignatureType(typedSignature[65]) == SignatureTypePersonal {
+		message, err := getPersonalSignMessage(typedData)
+		if err != nil {
+			return common.Address{}, err
+		}
+		return ecRecover(accounts.TextHash(message), typedSignature)
+	}
+
+	typedDataHash, err := getTypedDataHash(typedData)
+	if err != nil {
+		return common.Address{}, err
+	}
+
+	return EcRecoverTypedSignature(typedDataHash, typedSignature)
+}
+
+// ecRecover recovers the address from the hash and the first 65 bytes of the signature.
+func ecRecover(hash []byte, typedSignature []byte) (common.Address, error) {
+	sig := make([]byte, 65)
+	copy(sig, typedSignature[:65])
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to recover public key: %w", err)
+	}
+
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// EthSignHash signs the hash directly with the private key.
+func (key *ecdsaPrivateKeySigner) EthSignHash(hash []byte) ([]byte, error) {
+	sig, err := crypto.Sign(hash, (*ecdsa.PrivateKey)(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign hash: %w", err)
+	}
+	// Legacy Signing
+	sig[64] += 27
+
+	return sig, nil
+}
+
+// EthSignPersonalMessage signs the message with the ethereum personal message prefix.
+func (key *ecdsaPrivateKeySigner) EthSignPersonalMessage(message []byte) ([]byte, error) {
+	return key.EthSignHash(accounts.TextHash(message))
+}
+
+// EthSignPersonalMessage signs the message with Wallet.SignText.
+func (w *walletSigner) EthSignPersonalMessage(message []byte) ([]byte, error) {
+	sig, err := w.wallet.SignText(w.account, message)
+	if err != nil {
+		return nil, fmt.Errorf("wallet failed to sign text: %w", err)
+	}
+
+	return toLegacySignature(sig)
+}
+
+const clefSignDataMethod = "account_signData"
+
+// EthSignPersonalMessage calls account_signData with text/plain on the external signer.
+func (s *ClefSigner) EthSignPersonalMessage(message []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	if err := s.client.CallContext(ctx, &sig, clefSignDataMethod, accounts.MimetypeTextPlain, s.address, hexutil.Encode(message)); err != nil {
+		return nil, fmt.Errorf("external signer failed to sign data: %w", err)
+	}
+
+	return toLegacySignature(sig)
+}
+
+var (
+	_ SignEthHash         = (*ecdsaPrivateKeySigner)(nil)
+	_ SignPersonalMessage = (*ecdsaPrivateKeySigner)(nil)
+	_ SignPersonalMessage = (*walletSigner)(nil)
+	_ SignPersonalMessage = (*ClefSigner)(nil)
+)
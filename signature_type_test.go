@@ -0,0 +1,208 @@
+package dydx_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+// The ganache account and the expected keys are from the tests of dydx-v3-python:
+// https://github.com/dydxprotocol/dydx-v3-python/blob/914fc66e542d82080702e03f6ad078ca2901bb46/tests/test_onboarding.py
+// The python client only has vectors for no-prepend. The keys of decimal and hexadecimal are pinned after checking
+// their signatures against signWithPrefix, which hashes with the prefixes of the dydx clients independently of the
+// library.
+const (
+	ganacheAddress       = "0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1"
+	ganachePrivateKeyHex = "4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d"
+)
+
+func TestDeriveKeysPythonVectors(t *testing.T) {
+	key, err := crypto.HexToECDSA(ganachePrivateKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address := crypto.PubkeyToAddress(key.PublicKey); address != common.HexToAddress(ganacheAddress) {
+		t.Fatalf("expecting address %s, got %s", ganacheAddress, address)
+	}
+	signer := dydx.NewEcdsaPrivateKeySigner(key)
+
+	// the stark key is derived from the signature of the prefixed hash of the key derivation typed data.
+	keyDerivation := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": []apitypes.Type{
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"dYdX": []apitypes.Type{{Name: "action", Type: "string"}, {Name: "onlySignOn", Type: "string"}},
+		},
+		PrimaryType: "dYdX",
+		Domain:      apitypes.TypedDataDomain{Name: "dYdX", Version: "1.0", ChainId: math.NewHexOrDecimal256(1)},
+		Message:     apitypes.TypedDataMessage{"action": "dYdX STARK Key", "onlySignOn": "https://trade.dydx.exchange"},
+	}
+	keyDerivationHash, _, err := apitypes.TypedDataAndHash(keyDerivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		signatureType dydx.SignatureType
+		prefix        string
+		starkKey      *dydx.StarkKey
+		apiKey        *dydx.ApiKey
+	}{
+		{
+			signatureType: dydx.SignatureTypeNoPrepend,
+			starkKey: dydx.NewStarkKey(
+				"39d88860b99b1809a63add01f7dfa59676ae006bbcdf38ff30b6a69dcf55ed3",
+				"2bdd58a2c2acb241070bc5d55659a85bba65211890a8c47019a33902aba8400",
+				"170d807cafe3d8b5758f3f698331d292bf5aeb71f6fd282f0831dee094ee891",
+			),
+			apiKey: dydx.NewApiKey("50fdcaa0-62b8-e827-02e8-a9520d46cb9f", "12_1LuuJMZUxcj3kGBWc", "rdHdKDAOCa0B_Mq-Q9kh8Fz6rK3ocZNOhKB4QsR9"),
+		},
+		{
+			signatureType: dydx.SignatureTypeDecimal,
+			prefix:        "\x19Ethereum Signed Message:\n32",
+			starkKey: dydx.NewStarkKey(
+				"5f05b71ca3a07351a7958d9a7eaf2b27e73a150d8f6ff1d8c5f531b54b03ff9",
+				"eb531f998e35daff82beec599e4d035855ba3ab69a9517972fb790cf0e3be1",
+				"24a8f3cbd1b565a1e9eb4278ab456e88c89f0a901b8c4d00dca82a75f97df95",
+			),
+			apiKey: dydx.NewApiKey("958080b0-000a-01aa-4012-6bbfebf173ee", "Y6uac-42KTvgVy3238GP", "hEIsyT920WaI6LyKBEZCVwhObQk1q7GTIhCD1H2D"),
+		},
+		{
+			signatureType: dydx.SignatureTypeHexadecimal,
+			prefix:        "\x19Ethereum Signed Message:\n\x20",
+			starkKey: dydx.NewStarkKey(
+				"5a89a1b413397ae5795ec46094d872af84490645088f8c39dda6e14effb102a",
+				"5de2c6eb86210f26aadece191fd4ea03cb79a236041ef8086755696b21a815e",
+				"4b0d244eb7f2f722ebbe279a137ca677eb344744022f86ea678b3c8e6f6e642",
+			),
+			apiKey: dydx.NewApiKey("e34f95a4-3545-5d84-e5a3-9f76268eea04", "g4R9lMG9nCLKtE0bSiYk", "p5d8Bw2LKwofPt4Pbw5MEkCLSMPHs2J_ZRcTPgaA"),
+		},
+	} {
+		starkKey, err := dydx.DeriveStarkKey(signer, true, v.signatureType)
+		if err != nil {
+			t.Fatalf("failed to derive stark key with %s: %v", v.signatureType, err)
+		}
+		sig := signWithPrefix(t, key, v.prefix, keyDerivationHash, v.signatureType)
+		if privateKey := new(big.Int).Rsh(new(big.Int).SetBytes(crypto.Keccak256(sig)), 5); starkKey.PrivateKey != privateKey.Text(16) {
+			t.Errorf("%s: stark private key %s is not derived from the signature %x", v.signatureType, starkKey.PrivateKey, sig)
+		}
+		if !cmp.Equal(v.starkKey, starkKey) {
+			t.Errorf("%s: expecting %s, got %s", v.signatureType, spewConfig.Sdump(v.starkKey), spewConfig.Sdump(starkKey))
+		}
+
+		apiKey, err := dydx.RecoverDefaultApiKeyCredentials(signer, true, v.signatureType)
+		if err != nil {
+			t.Fatalf("failed to recover api key with %s: %v", v.signatureType, err)
+		}
+		if !cmp.Equal(v.apiKey, apiKey) {
+			t.Errorf("%s: expecting %s, got %s", v.signatureType, spewConfig.Sdump(v.apiKey), spewConfig.Sdump(apiKey))
+		}
+	}
+}
+
+// signWithPrefix signs keccak(prefix || hash) with the key, and appends the signature type.
+// The hash is signed directly if the prefix is empty.
+func signWithPrefix(t *testing.T, key *ecdsa.PrivateKey, prefix string, hash []byte, signatureType dydx.SignatureType) []byte {
+	t.Helper()
+	if prefix != "" {
+		hash = crypto.Keccak256(append([]byte(prefix), hash...))
+	}
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return append(sig, byte(signatureType))
+}
+
+func TestSignTypedDataWithType(t *testing.T) {
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": []apitypes.Type{
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"dYdX": []apitypes.Type{{Name: "action", Type: "string"}},
+		},
+		PrimaryType: "dYdX",
+		Domain:      apitypes.TypedDataDomain{Name: "dYdX", Version: "1.0", ChainId: math.NewHexOrDecimal256(3)},
+		Message:     apitypes.TypedDataMessage{"action": "test"},
+	}
+	typedDataHash, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		t.Fatalf("failed to hash typed data: %v", err)
+	}
+
+	// the prefixes of the signed hash, from the dydx clients.
+	prefixes := map[dydx.SignatureType]string{
+		dydx.SignatureTypeNoPrepend:   "",
+		dydx.SignatureTypeDecimal:     "\x19Ethereum Signed Message:\n32",
+		dydx.SignatureTypeHexadecimal: "\x19Ethereum Signed Message:\n\x20",
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	signer := dydx.NewEcdsaPrivateKeySigner(privateKey)
+	for _, signatureType := range []dydx.SignatureType{dydx.SignatureTypeNoPrepend, dydx.SignatureTypeDecimal, dydx.SignatureTypeHexadecimal, dydx.SignatureTypePersonal} {
+		sig, err := dydx.SignTypedDataWithType(signer, typedData, signatureType)
+		if err != nil {
+			t.Fatalf("failed to sign with %s: %v", signatureType, err)
+		}
+		if len(sig) != 66 || sig[65] != byte(signatureType) {
+			t.Fatalf("%s: signature type is not appended: %x", signatureType, sig)
+		}
+		if prefix, ok := prefixes[signatureType]; ok {
+			if expected := signWithPrefix(t, privateKey, prefix, typedDataHash, signatureType); !bytes.Equal(expected, sig) {
+				t.Errorf("%s: expecting signature %x, got %x", signatureType, expected, sig)
+			}
+		}
+		recovered, err := dydx.EcRecoverTypedDataSignature(typedData, sig)
+		if err != nil {
+			t.Fatalf("%s: failed to recover: %v", signatureType, err)
+		}
+		if recovered != address {
+			t.Errorf("%s: expecting %s, got %s", signatureType, address, recovered)
+		}
+		if signatureType == dydx.SignatureTypePersonal {
+			continue
+		}
+		recovered, err = dydx.EcRecoverTypedSignature(typedDataHash, sig)
+		if err != nil {
+			t.Fatalf("%s: failed to recover: %v", signatureType, err)
+		}
+		if recovered != address {
+			t.Errorf("%s: expecting %s, got %s", signatureType, address, recovered)
+		}
+	}
+
+	// personal signs the json text of the message and the domain, with sorted keys.
+	personalMessage := "{\n  \"action\": \"test\",\n  \"chainId\": 3,\n  \"name\": \"dYdX\",\n  \"version\": \"1.0\"\n}"
+	expected, err := crypto.Sign(accounts.TextHash([]byte(personalMessage)), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected[64] += 27
+	sig, err := dydx.SignTypedDataWithType(signer, typedData, dydx.SignatureTypePersonal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(expected, byte(dydx.SignatureTypePersonal)), sig) {
+		t.Errorf("personal signature is not of the message %q", personalMessage)
+	}
+
+	if _, err := dydx.SignTypedDataWithType(signer, typedData, dydx.SignatureType(4)); err == nil {
+		t.Errorf("expecting error for unknown signature type")
+	}
+}
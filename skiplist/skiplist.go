@@ -0,0 +1,171 @@
+// Package skiplist provides a sorted map backed by a skip list.
+//
+// The expected complexity of Get, Set and Delete is O(log n), and the elements can be iterated in order.
+// The list is not safe for concurrent use.
+package skiplist
+
+const (
+	maxLevel = 32
+	// a node is promoted to the next level with probability 1/4
+	levelShift = 2
+)
+
+type node[K any, V any] struct {
+	key   K
+	value V
+	next  []*node[K, V]
+}
+
+// SkipList is a map sorted by the less function of the keys.
+// Two keys are the same when neither is less than the other.
+type SkipList[K any, V any] struct {
+	less   func(a, b K) bool
+	head   *node[K, V]
+	level  int
+	length int
+	seed   uint64
+}
+
+// New creates an empty skip list sorted by less.
+func New[K any, V any](less func(a, b K) bool) *SkipList[K, V] {
+	return &SkipList[K, V]{
+		less:  less,
+		head:  &node[K, V]{next: make([]*node[K, V], maxLevel)},
+		level: 1,
+		seed:  0x9E3779B97F4A7C15,
+	}
+}
+
+// Len returns the number of the elements.
+func (l *SkipList[K, V]) Len() int {
+	return l.length
+}
+
+// Clear removes all the elements.
+func (l *SkipList[K, V]) Clear() {
+	for i := range l.head.next {
+		l.head.next[i] = nil
+	}
+	l.level = 1
+	l.length = 0
+}
+
+// randomLevel returns the level of a new node, using xorshift so the list doesn't depend on the global random source.
+func (l *SkipList[K, V]) randomLevel() int {
+	level := 1
+	for level < maxLevel {
+		l.seed ^= l.seed << 13
+		l.seed ^= l.seed >> 7
+		l.seed ^= l.seed << 17
+		if l.seed&(1<<levelShift-1) != 0 {
+			break
+		}
+		level++
+	}
+	return level
+}
+
+// findGreaterOrEqual returns the first node whose key is not less than the key,
+// and fills the last nodes before it on each level into update if update is not nil.
+func (l *SkipList[K, V]) findGreaterOrEqual(key K, update []*node[K, V]) *node[K, V] {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && l.less(x.next[i].key, key) {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+func (l *SkipList[K, V]) isEqual(n *node[K, V], key K) bool {
+	return n != nil && !l.less(key, n.key)
+}
+
+// Get returns the value of the key.
+func (l *SkipList[K, V]) Get(key K) (V, bool) {
+	n := l.findGreaterOrEqual(key, nil)
+	if l.isEqual(n, key) {
+		return n.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set sets the value of the key, and returns true if the key already exists.
+func (l *SkipList[K, V]) Set(key K, value V) bool {
+	var update [maxLevel]*node[K, V]
+	n := l.findGreaterOrEqual(key, update[:])
+	if l.isEqual(n, key) {
+		n.value = value
+		return true
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+		}
+		l.level = level
+	}
+
+	n = &node[K, V]{key: key, value: value, next: make([]*node[K, V], level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	l.length++
+
+	return false
+}
+
+// Delete removes the key, and returns the removed value.
+func (l *SkipList[K, V]) Delete(key K) (V, bool) {
+	var update [maxLevel]*node[K, V]
+	n := l.findGreaterOrEqual(key, update[:])
+	if !l.isEqual(n, key) {
+		var zero V
+		return zero, false
+	}
+
+	for i := 0; i < len(n.next); i++ {
+		update[i].next[i] = n.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+
+	return n.value, true
+}
+
+// First returns the smallest key and its value.
+func (l *SkipList[K, V]) First() (K, V, bool) {
+	n := l.head.next[0]
+	if n == nil {
+		var key K
+		var value V
+		return key, value, false
+	}
+	return n.key, n.value, true
+}
+
+// Ascend calls f on the elements in order until f returns false.
+func (l *SkipList[K, V]) Ascend(f func(key K, value V) bool) {
+	for n := l.head.next[0]; n != nil; n = n.next[0] {
+		if !f(n.key, n.value) {
+			return
+		}
+	}
+}
+
+// AscendFrom calls f on the elements whose keys are not less than the key in order until f returns false.
+func (l *SkipList[K, V]) AscendFrom(key K, f func(key K, value V) bool) {
+	for n := l.findGreaterOrEqual(key, nil); n != nil; n = n.next[0] {
+		if !f(n.key, n.value) {
+			return
+		}
+	}
+}
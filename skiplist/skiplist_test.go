@@ -0,0 +1,65 @@
+package skiplist_test
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/fardream/go-dydx/skiplist"
+)
+
+func TestSkipList(t *testing.T) {
+	l := skiplist.New[int, int](func(a, b int) bool { return a < b })
+	expected := make(map[int]int)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 10000; i++ {
+		key := r.Intn(1000)
+		if r.Intn(3) == 0 {
+			_, ok := l.Delete(key)
+			if _, expectedOk := expected[key]; ok != expectedOk {
+				t.Fatalf("delete %d: got %t, expecting %t", key, ok, expectedOk)
+			}
+			delete(expected, key)
+		} else {
+			l.Set(key, i)
+			expected[key] = i
+		}
+	}
+
+	if l.Len() != len(expected) {
+		t.Fatalf("length %d, expecting %d", l.Len(), len(expected))
+	}
+
+	var keys []int
+	for k, v := range expected {
+		keys = append(keys, k)
+		if got, ok := l.Get(k); !ok || got != v {
+			t.Fatalf("get %d: got %d %t, expecting %d", k, got, ok, v)
+		}
+	}
+	sort.Ints(keys)
+
+	var got []int
+	l.Ascend(func(k, _ int) bool {
+		got = append(got, k)
+		return true
+	})
+	if len(got) != len(keys) {
+		t.Fatalf("iterated %d keys, expecting %d", len(got), len(keys))
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Fatalf("key %d is %d, expecting %d", i, got[i], keys[i])
+		}
+	}
+
+	if k, _, ok := l.First(); !ok || k != keys[0] {
+		t.Fatalf("first key %d, expecting %d", k, keys[0])
+	}
+
+	l.Clear()
+	if _, _, ok := l.First(); ok || l.Len() != 0 {
+		t.Fatalf("list is not empty after clear")
+	}
+}
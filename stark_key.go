@@ -50,12 +50,24 @@ func (c *StarkKey) String() string {
 	return fmt.Sprintf("public key: %s - public key y: %s - private key: (redacted)", c.PublicKey, c.PublicKeyYCoordinate)
 }
 
-// Set reads in the file, for cobra cli
+// Set reads in the file, for cobra cli.
+// The file can be the json from the browser or an encrypted keystore (see EncryptKeyStore).
 func (c *StarkKey) Set(filename string) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
+	if IsEncryptedKeyStore(data) {
+		ks, err := DecryptKeyStoreWithPrompt(filename, data)
+		if err != nil {
+			return err
+		}
+		if ks.StarkKey == nil {
+			return fmt.Errorf("keystore %s doesn't contain stark key", filename)
+		}
+		*c = *ks.StarkKey
+		return nil
+	}
 	m, err := ParseStarkKeyMap(data)
 	if err != nil {
 		return err
@@ -0,0 +1,69 @@
+package dydx
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/fardream/go-dydx/starkex"
+)
+
+// StarkSigner signs the message hashes of orders, withdrawals, and transfers on the Stark L2.
+// The private key doesn't need to live in the trading process: see NewRemoteStarkSigner.
+//
+// *StarkKey is the default in-memory implementation.
+type StarkSigner interface {
+	// SignStarkHash signs the message hash (see starkex.GetOrderHash) and returns the (r, s) pair.
+	SignStarkHash(ctx context.Context, msgHash *big.Int) (*big.Int, *big.Int, error)
+	// StarkPublicKey returns the public key and its y coordinate, both hex encoded.
+	StarkPublicKey() (string, string)
+}
+
+var _ StarkSigner = (*StarkKey)(nil)
+
+// SignStarkHash signs the message hash with the private key.
+func (c *StarkKey) SignStarkHash(_ context.Context, msgHash *big.Int) (*big.Int, *big.Int, error) {
+	if len(c.PrivateKey) == 0 {
+		return nil, nil, fmt.Errorf("stark private key is empty")
+	}
+	return starkex.SignHash(c.PrivateKey, msgHash)
+}
+
+// StarkPublicKey returns the public key and its y coordinate.
+func (c *StarkKey) StarkPublicKey() (string, string) {
+	return c.PublicKey, c.PublicKeyYCoordinate
+}
+
+// signStarkHash signs the hash with the stark signer of the client and serializes the signature.
+func (c *Client) signStarkHash(ctx context.Context, msgHash *big.Int) (string, error) {
+	if c.starkSigner == nil {
+		return "", fmt.Errorf("stark signer is nil")
+	}
+	r, s, err := c.starkSigner.SignStarkHash(ctx, msgHash)
+	if err != nil {
+		return "", err
+	}
+	return starkex.SerializeSignature(r, s), nil
+}
+
+// SignWithdrawal signs the withdrawal with the stark signer of the client.
+// Network id of the parameter is overwritten by the network of the client.
+func (c *Client) SignWithdrawal(ctx context.Context, param starkex.WithdrawSignParam) (string, error) {
+	param.NetworkId = c.networkId
+	msgHash, err := starkex.GetWithdrawHash(param)
+	if err != nil {
+		return "", fmt.Errorf("failed to get withdrawal hash: %w", err)
+	}
+	return c.signStarkHash(ctx, msgHash)
+}
+
+// SignTransfer signs the (conditional) transfer with the stark signer of the client.
+// Network id of the parameter is overwritten by the network of the client.
+func (c *Client) SignTransfer(ctx context.Context, param starkex.TransferSignParam) (string, error) {
+	param.NetworkId = c.networkId
+	msgHash, err := starkex.GetTransferHash(param)
+	if err != nil {
+		return "", fmt.Errorf("failed to get transfer hash: %w", err)
+	}
+	return c.signStarkHash(ctx, msgHash)
+}
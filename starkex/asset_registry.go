@@ -0,0 +1,84 @@
+package starkex
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SyntheticAsset contains the information of a synthetic asset necessary to sign orders.
+type SyntheticAsset struct {
+	// AssetId is the synthetic asset id on starkex.
+	AssetId *big.Int
+	// Resolution is the number of quantums in one unit of the asset.
+	Resolution int64
+}
+
+// AssetRegistry maps markets (like BTC-USD) to their synthetic assets.
+// The registry is populated from the market information of dydx, and the hard-coded tables
+// (SYNTHETIC_ID_MAP and ASSET_RESOLUTION) are used when the market is not in the registry.
+// AssetRegistry is safe for concurrent use.
+type AssetRegistry struct {
+	mu     sync.RWMutex
+	assets map[string]*SyntheticAsset
+}
+
+// DefaultAssetRegistry is used by GetOrderHash, OrderSign, and Signer.SignOrder. dydx.Client doesn't use it, and has its own registry.
+var DefaultAssetRegistry = NewAssetRegistry()
+
+// NewAssetRegistry creates an empty registry, which uses the hard-coded tables until the assets are set.
+func NewAssetRegistry() *AssetRegistry {
+	return &AssetRegistry{assets: make(map[string]*SyntheticAsset)}
+}
+
+// SetAsset adds or updates the synthetic asset of the market.
+// syntheticAssetId is hex encoded with 0x prefix, and resolution is a decimal integer, both are the same as
+// the syntheticAssetId and assetResolution fields of the markets from dydx.
+func (r *AssetRegistry) SetAsset(market, syntheticAssetId, resolution string) error {
+	assetId, ok := new(big.Int).SetString(syntheticAssetId, 0)
+	if !ok {
+		return fmt.Errorf("invalid synthetic asset id for %s: %s", market, syntheticAssetId)
+	}
+	res, err := strconv.ParseInt(resolution, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid asset resolution for %s: %s: %w", market, resolution, err)
+	}
+	if res <= 0 {
+		return fmt.Errorf("asset resolution for %s must be positive: %d", market, res)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assets[market] = &SyntheticAsset{AssetId: assetId, Resolution: res}
+
+	return nil
+}
+
+// GetAsset returns the synthetic asset of the market, falling back to the hard-coded tables.
+func (r *AssetRegistry) GetAsset(market string) (*SyntheticAsset, error) {
+	r.mu.RLock()
+	asset, ok := r.assets[market]
+	r.mu.RUnlock()
+	if ok {
+		return asset, nil
+	}
+
+	currency := strings.Split(market, "-")[0]                                // EOS-USD -> EOS
+	assetIdSyn, ok := big.NewInt(0).SetString(SYNTHETIC_ID_MAP[currency], 0) // with prefix: 0x
+	if !ok {
+		return nil, fmt.Errorf("invalid market: %s", market)
+	}
+	resolution, ok := ASSET_RESOLUTION[currency]
+	if !ok {
+		return nil, fmt.Errorf("no asset resolution for market: %s", market)
+	}
+
+	return &SyntheticAsset{AssetId: assetIdSyn, Resolution: resolution}, nil
+}
+
+// GetOrderHash returns the message hash of the order with the synthetic asset from the registry.
+func (r *AssetRegistry) GetOrderHash(param OrderSignParam) (*big.Int, error) {
+	return GetMessageHash(&OrderSigner{param: param, registry: r})
+}
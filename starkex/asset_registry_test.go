@@ -0,0 +1,39 @@
+package starkex
+
+import "testing"
+
+func TestAssetRegistry(t *testing.T) {
+	param := OrderSignParam{
+		NetworkId:  NETWORK_ID_ROPSTEN,
+		Market:     "ETH-USD",
+		Side:       "BUY",
+		PositionId: 12345,
+		HumanSize:  "145.0005",
+		HumanPrice: "350.00067",
+		LimitFee:   "0.125",
+		ClientId:   "This is an ID that the client came up with to describe this order",
+		Expiration: "2020-09-17T04:15:55.028Z",
+	}
+	expected, err := GetOrderHash(param)
+	if err != nil {
+		t.Fatalf("failed to get order hash: %v", err)
+	}
+
+	registry := NewAssetRegistry()
+	// fallback to the hard-coded tables.
+	if hash, err := registry.GetOrderHash(param); err != nil || hash.Cmp(expected) != 0 {
+		t.Fatalf("expecting hash %s, got %s (error: %v)", expected, hash, err)
+	}
+
+	param.Market = "NEW-USD"
+	if _, err := registry.GetOrderHash(param); err == nil {
+		t.Fatalf("expecting error for unknown market %s", param.Market)
+	}
+
+	if err := registry.SetAsset("NEW-USD", SYNTHETIC_ID_MAP[ASSET_ETH], "1000000000"); err != nil {
+		t.Fatalf("failed to set asset: %v", err)
+	}
+	if hash, err := registry.GetOrderHash(param); err != nil || hash.Cmp(expected) != 0 {
+		t.Fatalf("expecting hash %s, got %s (error: %v)", expected, hash, err)
+	}
+}
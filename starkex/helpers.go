@@ -46,6 +46,23 @@ func SerializeSignature(r, s *big.Int) string {
 	return IntToHex32(r) + IntToHex32(s)
 }
 
+// DeserializeSignature Convert a 64-byte hex string (as generated by SerializeSignature) back to the r, s pair.
+func DeserializeSignature(signature string) (*big.Int, *big.Int, error) {
+	signature = strings.TrimPrefix(signature, "0x")
+	if len(signature) != 128 {
+		return nil, nil, fmt.Errorf("invalid signature length %d: %s", len(signature), signature)
+	}
+	r, ok := new(big.Int).SetString(signature[:64], 16)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid r in signature: %s", signature)
+	}
+	s, ok := new(big.Int).SetString(signature[64:], 16)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid s in signature: %s", signature)
+	}
+	return r, s, nil
+}
+
 // IntToHex32 Normalize to a 32-byte hex string without 0x prefix.
 func IntToHex32(x *big.Int) string {
 	str := x.Text(16)
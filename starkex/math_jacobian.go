@@ -0,0 +1,299 @@
+package starkex
+
+import (
+	"math/big"
+	"sync"
+)
+
+// Curve arithmetic in Jacobian coordinates.
+//
+// A point (X, Y, Z) in Jacobian coordinates represents the affine point (X/Z^2, Y/Z^3),
+// and Z = 0 is the point at infinity. Additions and doublings don't need modular inverses,
+// only the conversion back to the affine form does.
+//
+// Formulas are from https://hyperelliptic.org/EFD/g1p/auto-shortw-jacobian.html
+// (dbl-2007-bl and madd-2007-bl).
+
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+func newInfinityPoint() *jacobianPoint {
+	return &jacobianPoint{x: big.NewInt(1), y: big.NewInt(1), z: big.NewInt(0)}
+}
+
+func newJacobianPoint(point [2]*big.Int) *jacobianPoint {
+	return &jacobianPoint{x: new(big.Int).Set(point[0]), y: new(big.Int).Set(point[1]), z: big.NewInt(1)}
+}
+
+func (pt *jacobianPoint) isInfinity() bool {
+	return pt.z.Sign() == 0
+}
+
+func (pt *jacobianPoint) set(other *jacobianPoint) *jacobianPoint {
+	pt.x.Set(other.x)
+	pt.y.Set(other.y)
+	pt.z.Set(other.z)
+	return pt
+}
+
+// toAffine converts the point into affine form. The point must not be infinity.
+func (pt *jacobianPoint) toAffine(p *big.Int) [2]*big.Int {
+	zInv := new(big.Int).ModInverse(pt.z, p)
+	return pt.toAffineWithInverse(zInv, p)
+}
+
+func (pt *jacobianPoint) toAffineWithInverse(zInv *big.Int, p *big.Int) [2]*big.Int {
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	zInv2.Mod(zInv2, p)
+	x := new(big.Int).Mul(pt.x, zInv2)
+	x.Mod(x, p)
+	y := zInv2.Mul(zInv2, zInv)
+	y.Mod(y, p)
+	y.Mul(y, pt.y)
+	y.Mod(y, p)
+	return [2]*big.Int{x, y}
+}
+
+// double sets pt to 2*pt on the curve y^2 = x^3 + alpha*x + beta mod p.
+func (pt *jacobianPoint) double(alpha *big.Int, p *big.Int) *jacobianPoint {
+	if pt.isInfinity() || pt.y.Sign() == 0 {
+		pt.z.SetInt64(0)
+		return pt
+	}
+	xx := new(big.Int).Mul(pt.x, pt.x)
+	xx.Mod(xx, p)
+	yy := new(big.Int).Mul(pt.y, pt.y)
+	yy.Mod(yy, p)
+	yyyy := new(big.Int).Mul(yy, yy)
+	yyyy.Mod(yyyy, p)
+	zz := new(big.Int).Mul(pt.z, pt.z)
+	zz.Mod(zz, p)
+	// s = 2*((x+yy)^2-xx-yyyy)
+	s := new(big.Int).Add(pt.x, yy)
+	s.Mul(s, s)
+	s.Sub(s, xx)
+	s.Sub(s, yyyy)
+	s.Lsh(s, 1)
+	s.Mod(s, p)
+	// m = 3*xx+alpha*zz^2
+	m := new(big.Int).Mul(zz, zz)
+	m.Mul(m, alpha)
+	m.Add(m, xx)
+	m.Add(m, xx)
+	m.Add(m, xx)
+	m.Mod(m, p)
+	// z3 = (y+z)^2-yy-zz
+	pt.z.Add(pt.y, pt.z)
+	pt.z.Mul(pt.z, pt.z)
+	pt.z.Sub(pt.z, yy)
+	pt.z.Sub(pt.z, zz)
+	pt.z.Mod(pt.z, p)
+	// x3 = m^2-2*s
+	pt.x.Mul(m, m)
+	pt.x.Sub(pt.x, s)
+	pt.x.Sub(pt.x, s)
+	pt.x.Mod(pt.x, p)
+	// y3 = m*(s-x3)-8*yyyy
+	pt.y.Sub(s, pt.x)
+	pt.y.Mul(pt.y, m)
+	pt.y.Sub(pt.y, yyyy.Lsh(yyyy, 3))
+	pt.y.Mod(pt.y, p)
+	return pt
+}
+
+// addAffine sets pt to pt + other, where other is in affine form.
+func (pt *jacobianPoint) addAffine(other [2]*big.Int, alpha *big.Int, p *big.Int) *jacobianPoint {
+	if pt.isInfinity() {
+		pt.x.Set(other[0])
+		pt.y.Set(other[1])
+		pt.z.SetInt64(1)
+		return pt
+	}
+	z1z1 := new(big.Int).Mul(pt.z, pt.z)
+	z1z1.Mod(z1z1, p)
+	// u2 = x2*z1z1
+	u2 := new(big.Int).Mul(other[0], z1z1)
+	u2.Mod(u2, p)
+	// s2 = y2*z1*z1z1
+	s2 := new(big.Int).Mul(pt.z, z1z1)
+	s2.Mod(s2, p)
+	s2.Mul(s2, other[1])
+	s2.Mod(s2, p)
+	// h = u2-x1
+	h := u2.Sub(u2, pt.x)
+	h.Mod(h, p)
+	// r = 2*(s2-y1)
+	r := s2.Sub(s2, pt.y)
+	r.Lsh(r, 1)
+	r.Mod(r, p)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return pt.double(alpha, p)
+		}
+		pt.z.SetInt64(0)
+		return pt
+	}
+	hh := new(big.Int).Mul(h, h)
+	hh.Mod(hh, p)
+	// i = 4*hh, j = h*i, v = x1*i
+	i := new(big.Int).Lsh(hh, 2)
+	i.Mod(i, p)
+	j := new(big.Int).Mul(h, i)
+	j.Mod(j, p)
+	v := i.Mul(pt.x, i)
+	v.Mod(v, p)
+	// z3 = (z1+h)^2-z1z1-hh
+	pt.z.Add(pt.z, h)
+	pt.z.Mul(pt.z, pt.z)
+	pt.z.Sub(pt.z, z1z1)
+	pt.z.Sub(pt.z, hh)
+	pt.z.Mod(pt.z, p)
+	// y1*j is needed for y3, compute before x3 overwrite
+	y1j := new(big.Int).Mul(pt.y, j)
+	y1j.Lsh(y1j, 1)
+	// x3 = r^2-j-2*v
+	pt.x.Mul(r, r)
+	pt.x.Sub(pt.x, j)
+	pt.x.Sub(pt.x, v)
+	pt.x.Sub(pt.x, v)
+	pt.x.Mod(pt.x, p)
+	// y3 = r*(v-x3)-2*y1*j
+	pt.y.Sub(v, pt.x)
+	pt.y.Mul(pt.y, r)
+	pt.y.Sub(pt.y, y1j)
+	pt.y.Mod(pt.y, p)
+	return pt
+}
+
+// batchToAffine converts the points to affine form with a single modular inverse (Montgomery's trick).
+// None of the points can be infinity.
+func batchToAffine(points []*jacobianPoint, p *big.Int) [][2]*big.Int {
+	n := len(points)
+	result := make([][2]*big.Int, n)
+	if n == 0 {
+		return result
+	}
+	prefix := make([]*big.Int, n)
+	acc := big.NewInt(1)
+	for i, pt := range points {
+		prefix[i] = new(big.Int).Set(acc)
+		acc.Mul(acc, pt.z)
+		acc.Mod(acc, p)
+	}
+	inv := new(big.Int).ModInverse(acc, p)
+	for i := n - 1; i >= 0; i-- {
+		zInv := new(big.Int).Mul(inv, prefix[i])
+		zInv.Mod(zInv, p)
+		result[i] = points[i].toAffineWithInverse(zInv, p)
+		inv.Mul(inv, points[i].z)
+		inv.Mod(inv, p)
+	}
+	return result
+}
+
+// fixedBaseWindowBits is the window size of the precomputed tables.
+const fixedBaseWindowBits = 4
+
+// fixedBaseTable contains the precomputed multiples for a fixed set of points.
+// entries[w][m-1] is sum of the points selected by the bits of m in window w.
+type fixedBaseTable struct {
+	entries [][][2]*big.Int
+}
+
+// newFixedBaseTable creates a table for the points, where points[i] is the base of bit i of the scalar.
+// The number of points must be a multiple of fixedBaseWindowBits.
+func newFixedBaseTable(points [][2]*big.Int, alpha *big.Int, p *big.Int) *fixedBaseTable {
+	windowSize := 1 << fixedBaseWindowBits
+	nWindows := len(points) / fixedBaseWindowBits
+	all := make([]*jacobianPoint, 0, nWindows*(windowSize-1))
+	for w := 0; w < nWindows; w++ {
+		window := make([]*jacobianPoint, windowSize)
+		window[0] = newInfinityPoint()
+		for m := 1; m < windowSize; m++ {
+			// lowest bit of m
+			b := 0
+			for (m>>b)&1 == 0 {
+				b++
+			}
+			window[m] = newInfinityPoint().set(window[m&(m-1)]).addAffine(points[w*fixedBaseWindowBits+b], alpha, p)
+		}
+		all = append(all, window[1:]...)
+	}
+	affine := batchToAffine(all, p)
+	t := &fixedBaseTable{entries: make([][][2]*big.Int, nWindows)}
+	for w := 0; w < nWindows; w++ {
+		t.entries[w] = affine[w*(windowSize-1) : (w+1)*(windowSize-1)]
+	}
+	return t
+}
+
+// addMult adds scalar multiple of the base to acc. Bits of the scalar beyond the table are ignored.
+func (t *fixedBaseTable) addMult(acc *jacobianPoint, scalar *big.Int, alpha *big.Int, p *big.Int) *jacobianPoint {
+	words := scalar.Bits()
+	bitLen := scalar.BitLen()
+	for w := range t.entries {
+		start := w * fixedBaseWindowBits
+		if start >= bitLen {
+			break
+		}
+		m := 0
+		for b := 0; b < fixedBaseWindowBits; b++ {
+			bit := start + b
+			word := bit / bitsPerWord
+			if word < len(words) && (uint(words[word])>>(uint(bit)%bitsPerWord))&1 == 1 {
+				m |= 1 << b
+			}
+		}
+		if m != 0 {
+			acc.addAffine(t.entries[w][m-1], alpha, p)
+		}
+	}
+	return acc
+}
+
+const bitsPerWord = 32 << (^uint(0) >> 63)
+
+var (
+	generatorTableOnce sync.Once
+	generatorTable     *fixedBaseTable
+
+	pedersenTablesOnce sync.Once
+	pedersenTables     []*fixedBaseTable
+)
+
+// getGeneratorTable returns the precomputed table of the generator, 2^i * generator for i in [0, EC_ORDER.BitLen())
+func getGeneratorTable() *fixedBaseTable {
+	generatorTableOnce.Do(func() {
+		alpha := big.NewInt(int64(pedersenCfg.ALPHA))
+		nBits := EC_ORDER.BitLen()
+		nBits += (fixedBaseWindowBits - nBits%fixedBaseWindowBits) % fixedBaseWindowBits
+		points := make([]*jacobianPoint, nBits)
+		current := newJacobianPoint(pedersenCfg.ConstantPoints[1])
+		for i := 0; i < nBits; i++ {
+			points[i] = newInfinityPoint().set(current)
+			current.double(alpha, FIELD_PRIME)
+		}
+		generatorTable = newFixedBaseTable(batchToAffine(points, FIELD_PRIME), alpha, FIELD_PRIME)
+	})
+	return generatorTable
+}
+
+// getPedersenTables returns the precomputed tables of the constant points for each input element of the pedersen hash.
+func getPedersenTables() []*fixedBaseTable {
+	pedersenTablesOnce.Do(func() {
+		alpha := big.NewInt(int64(pedersenCfg.ALPHA))
+		nBits := FIELD_PRIME.BitLen()
+		for start := 2; start+nBits <= len(pedersenCfg.ConstantPoints); start += nBits {
+			pedersenTables = append(pedersenTables, newFixedBaseTable(pedersenCfg.ConstantPoints[start:start+nBits], alpha, FIELD_PRIME))
+		}
+	})
+	return pedersenTables
+}
+
+// ecMultGenerator multiplies the generator (ConstantPoints[1]) by m with the precomputed table.
+// Assumes 0 < m < EC_ORDER.
+func ecMultGenerator(m *big.Int) [2]*big.Int {
+	alpha := big.NewInt(int64(pedersenCfg.ALPHA))
+	return getGeneratorTable().addMult(newInfinityPoint(), m, alpha, FIELD_PRIME).toAffine(FIELD_PRIME)
+}
@@ -35,20 +35,15 @@ func init() {
 	FIELD_PRIME = pedersenCfg.FieldPrime
 }
 
+// PedersenHash computes the pedersen hash of the decimal encoded big ints.
+// Precomputed tables of the constant points are used, see getPedersenTables.
 func PedersenHash(str ...string) string {
-	NElementBitsHash := FIELD_PRIME.BitLen()
-	point := pedersenCfg.ConstantPoints[0]
+	tables := getPedersenTables()
+	alpha := big.NewInt(int64(pedersenCfg.ALPHA))
+	point := newJacobianPoint(pedersenCfg.ConstantPoints[0])
 	for i, s := range str {
 		x, _ := big.NewInt(0).SetString(s, 10)
-		pointList := pedersenCfg.ConstantPoints[2+i*NElementBitsHash : 2+(i+1)*NElementBitsHash]
-		n := big.NewInt(0)
-		for _, pt := range pointList {
-			n.And(x, big.NewInt(1))
-			if n.Cmp(big.NewInt(0)) > 0 {
-				point = eccAdd(point, pt, FIELD_PRIME)
-			}
-			x = x.Rsh(x, 1)
-		}
+		tables[i].addMult(point, x, alpha, FIELD_PRIME)
 	}
-	return point[0].String()
+	return point.toAffine(FIELD_PRIME)[0].String()
 }
@@ -0,0 +1,134 @@
+package starkex
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+// ecMultAffine is the recursive double-and-add on affine coordinates, kept as the reference implementation.
+func ecMultAffine(m *big.Int, point [2]*big.Int, alpha int, p *big.Int) [2]*big.Int {
+	if m.Cmp(one) == 0 {
+		return point
+	}
+	if big.NewInt(0).Mod(m, two).Cmp(zero) == 0 {
+		return ecMultAffine(big.NewInt(0).Quo(m, two), ecDouble(point, alpha, p), alpha, p)
+	}
+	return eccAdd(ecMultAffine(big.NewInt(0).Sub(m, one), point, alpha, p), point, p)
+}
+
+// pedersenHashAffine walks the constant points with affine additions, kept as the reference implementation.
+func pedersenHashAffine(str ...string) string {
+	NElementBitsHash := FIELD_PRIME.BitLen()
+	point := pedersenCfg.ConstantPoints[0]
+	for i, s := range str {
+		x, _ := big.NewInt(0).SetString(s, 10)
+		pointList := pedersenCfg.ConstantPoints[2+i*NElementBitsHash : 2+(i+1)*NElementBitsHash]
+		n := big.NewInt(0)
+		for _, pt := range pointList {
+			n.And(x, big.NewInt(1))
+			if n.Cmp(big.NewInt(0)) > 0 {
+				point = eccAdd(point, pt, FIELD_PRIME)
+			}
+			x = x.Rsh(x, 1)
+		}
+	}
+	return point[0].String()
+}
+
+func randomScalar(t testing.TB, max *big.Int) *big.Int {
+	k, err := rand.Int(rand.Reader, new(big.Int).Sub(max, one))
+	if err != nil {
+		t.Fatalf("failed to generate random number: %v", err)
+	}
+	return k.Add(k, one)
+}
+
+func TestEcMult(t *testing.T) {
+	gen := pedersenCfg.ConstantPoints[1]
+	for i := 0; i < 16; i++ {
+		k := randomScalar(t, EC_ORDER)
+		expected := ecMultAffine(k, gen, pedersenCfg.ALPHA, FIELD_PRIME)
+		for name, got := range map[string][2]*big.Int{
+			"ecMult":          ecMult(k, gen, pedersenCfg.ALPHA, FIELD_PRIME),
+			"ecMultGenerator": ecMultGenerator(k),
+		} {
+			if got[0].Cmp(expected[0]) != 0 || got[1].Cmp(expected[1]) != 0 {
+				t.Fatalf("%s(%s): expecting (%s, %s), got (%s, %s)", name, k, expected[0], expected[1], got[0], got[1])
+			}
+		}
+	}
+}
+
+func TestPedersenHash(t *testing.T) {
+	for i := 0; i < 16; i++ {
+		a := randomScalar(t, FIELD_PRIME).String()
+		b := randomScalar(t, FIELD_PRIME).String()
+		expected := pedersenHashAffine(a, b)
+		if got := PedersenHash(a, b); got != expected {
+			t.Fatalf("PedersenHash(%s, %s): expecting %s, got %s", a, b, expected, got)
+		}
+	}
+}
+
+func BenchmarkEcMultGenerator(b *testing.B) {
+	k := randomScalar(b, EC_ORDER)
+	ecMultGenerator(k)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ecMultGenerator(k)
+	}
+}
+
+func BenchmarkEcMultJacobian(b *testing.B) {
+	k := randomScalar(b, EC_ORDER)
+	for i := 0; i < b.N; i++ {
+		ecMult(k, pedersenCfg.ConstantPoints[1], pedersenCfg.ALPHA, FIELD_PRIME)
+	}
+}
+
+func BenchmarkEcMultAffine(b *testing.B) {
+	k := randomScalar(b, EC_ORDER)
+	for i := 0; i < b.N; i++ {
+		ecMultAffine(k, pedersenCfg.ConstantPoints[1], pedersenCfg.ALPHA, FIELD_PRIME)
+	}
+}
+
+func BenchmarkPedersenHash(b *testing.B) {
+	x := randomScalar(b, FIELD_PRIME).String()
+	y := randomScalar(b, FIELD_PRIME).String()
+	PedersenHash(x, y)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PedersenHash(x, y)
+	}
+}
+
+func BenchmarkPedersenHashAffine(b *testing.B) {
+	x := randomScalar(b, FIELD_PRIME).String()
+	y := randomScalar(b, FIELD_PRIME).String()
+	for i := 0; i < b.N; i++ {
+		pedersenHashAffine(x, y)
+	}
+}
+
+func BenchmarkOrderSign(b *testing.B) {
+	param := OrderSignParam{
+		NetworkId:  NETWORK_ID_ROPSTEN,
+		Market:     "ETH-USD",
+		Side:       "BUY",
+		PositionId: 12345,
+		HumanSize:  "145.0005",
+		HumanPrice: "350.00067",
+		LimitFee:   "0.125",
+		ClientId:   "This is an ID that the client came up with to describe this order",
+		Expiration: "2020-09-17T04:15:55.028Z",
+	}
+	if _, err := OrderSign(MOCK_PRIVATE_KEY, param); err != nil {
+		b.Fatalf("failed to sign order: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		OrderSign(MOCK_PRIVATE_KEY, param)
+	}
+}
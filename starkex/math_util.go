@@ -12,15 +12,17 @@ var (
 
 // ecMult Multiplies by m a point on the elliptic curve with equation y^2 = x^3 + alpha*x + beta mod p.
 // Assumes the point is given in affine form (x, y) and that 0 < m < order(point).
+// The multiplication is carried out in Jacobian coordinates, see ecMultGenerator for the generator.
 func ecMult(m *big.Int, point [2]*big.Int, alpha int, p *big.Int) [2]*big.Int {
-	if m.Cmp(one) == 0 {
-		return point
+	a := big.NewInt(int64(alpha))
+	result := newInfinityPoint()
+	for i := m.BitLen() - 1; i >= 0; i-- {
+		result.double(a, p)
+		if m.Bit(i) == 1 {
+			result.addAffine(point, a, p)
+		}
 	}
-	// return point
-	if big.NewInt(0).Mod(m, two).Cmp(zero) == 0 {
-		return ecMult(big.NewInt(0).Quo(m, two), ecDouble(point, alpha, p), alpha, p)
-	}
-	return eccAdd(ecMult(big.NewInt(0).Sub(m, one), point, alpha, p), point, p)
+	return result.toAffine(p)
 }
 
 // ecDouble Doubles a point on an elliptic curve with the equation y^2 = x^3 + alpha*x + beta mod p.
@@ -70,7 +72,10 @@ func eccAdd(point1 [2]*big.Int, point2 [2]*big.Int, p *big.Int) [2]*big.Int {
 
 // divMod Finds a nonnegative integer 0 <= x < p such that (m * x) % p == n
 func divMod(n, m, p *big.Int) *big.Int {
-	a, _, _ := igcdex(m, p)
+	a := new(big.Int).ModInverse(m, p)
+	if a == nil {
+		a, _, _ = igcdex(m, p)
+	}
 	// (n * a) % p
 	tmp := big.NewInt(0).Mul(n, a)
 	return tmp.Mod(tmp, p)
@@ -2,9 +2,12 @@ package starkex
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
+	"strings"
 )
 
+// Signable is a message that can be signed by the stark private key.
 type Signable interface {
 	initMsg() error
 	getHash() (string, error)
@@ -53,15 +56,11 @@ func (s *Signer) Sign() (string, error) {
 	if s.signer == nil {
 		return "", errors.New("please init signer")
 	}
-	err := s.signer.initMsg()
+	msgHash, err := GetMessageHash(s.signer)
 	if err != nil {
 		return "", err
 	}
-	hash, err := s.signer.getHash()
-	if err != nil {
-		return "", err
-	}
-	s.hash = hash
+	s.hash = msgHash.String()
 	r, s1 := s.doSign()
 	if s.err != nil {
 		return "", s.err
@@ -70,11 +69,39 @@ func (s *Signer) Sign() (string, error) {
 }
 
 func (s *Signer) doSign() (*big.Int, *big.Int) {
-	priKey, _ := new(big.Int).SetString(s.starkPrivateKey, 16)
 	msgHash, _ := new(big.Int).SetString(s.hash, 10)
+	r, s1, err := SignHash(s.starkPrivateKey, msgHash)
+	s.err = err
+	return r, s1
+}
+
+// GetMessageHash computes the pedersen hash of the message, which is the value signed by the stark private key.
+func GetMessageHash(signable Signable) (*big.Int, error) {
+	if err := signable.initMsg(); err != nil {
+		return nil, err
+	}
+	hash, err := signable.getHash()
+	if err != nil {
+		return nil, err
+	}
+	msgHash, ok := new(big.Int).SetString(hash, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid message hash: %s", hash)
+	}
+	return msgHash, nil
+}
+
+// SignHash signs the message hash with the hex encoded stark private key and returns the (r, s) pair.
+// Use GetOrderHash, GetWithdrawHash, or GetTransferHash to obtain the message hash.
+func SignHash(starkPrivateKey string, msgHash *big.Int) (*big.Int, *big.Int, error) {
+	priKey, ok := new(big.Int).SetString(strings.TrimPrefix(starkPrivateKey, "0x"), 16)
+	if !ok {
+		return nil, nil, errors.New("invalid stark private key")
+	}
+	if msgHash == nil {
+		return nil, nil, errors.New("message hash is nil")
+	}
 	seed := 0
-	EcGen := pedersenCfg.ConstantPoints[1]
-	alpha := pedersenCfg.ALPHA
 	nBit := big.NewInt(0).Exp(big.NewInt(2), N_ELEMENT_BITS_ECDSA, nil)
 	for {
 		k := GenerateKRfc6979(msgHash, priKey, seed)
@@ -85,7 +112,7 @@ func (s *Signer) doSign() (*big.Int, *big.Int) {
 			seed += 1
 		}
 		// Cannot fail because 0 < k < EC_ORDER and EC_ORDER is prime.
-		x := ecMult(k, EcGen, alpha, FIELD_PRIME)[0]
+		x := ecMultGenerator(k)[0]
 		// !(1 <= x < 2 ** N_ELEMENT_BITS_ECDSA)
 		if !(x.Cmp(one) > 0 && x.Cmp(nBit) < 0) {
 			continue
@@ -103,6 +130,6 @@ func (s *Signer) doSign() (*big.Int, *big.Int) {
 			continue
 		}
 		s1 := divMod(one, w, EC_ORDER)
-		return x, s1
+		return x, s1, nil
 	}
 }
@@ -1,19 +1,18 @@
 package starkex
 
 import (
-	"errors"
 	"fmt"
 	"math"
 	"math/big"
-	"strings"
 	"time"
 
 	"github.com/fardream/decimal"
 )
 
 type OrderSigner struct {
-	param OrderSignParam
-	msg   struct {
+	param    OrderSignParam
+	registry *AssetRegistry
+	msg      struct {
 		OrderType               string   `json:"order_type"`
 		AssetIdSynthetic        *big.Int `json:"asset_id_synthetic"`
 		AssetIdCollateral       *big.Int `json:"asset_id_collateral"`
@@ -29,10 +28,13 @@ type OrderSigner struct {
 }
 
 func (s *OrderSigner) initMsg() error {
-	currency := strings.Split(s.param.Market, "-")[0]                        // EOS-USD -> EOS
-	assetIdSyn, ok := big.NewInt(0).SetString(SYNTHETIC_ID_MAP[currency], 0) // with prefix: 0x
-	if !ok {
-		return errors.New("invalid market: " + s.param.Market)
+	registry := s.registry
+	if registry == nil {
+		registry = DefaultAssetRegistry
+	}
+	asset, err := registry.GetAsset(s.param.Market)
+	if err != nil {
+		return err
 	}
 	assetId := COLLATERAL_ASSET_ID_BY_NETWORK_ID[s.param.NetworkId] // asset id
 	if assetId == nil {
@@ -42,7 +44,7 @@ func (s *OrderSigner) initMsg() error {
 	if err != nil {
 		return err
 	}
-	resolutionC := decimal.NewFromInt(ASSET_RESOLUTION[currency])
+	resolutionC := decimal.NewFromInt(asset.Resolution)
 	price, err := decimal.NewFromString(s.param.HumanPrice)
 	if err != nil {
 		return err
@@ -61,7 +63,7 @@ func (s *OrderSigner) initMsg() error {
 		return err
 	}
 	s.msg.OrderType = "LIMIT_ORDER_WITH_FEES"
-	s.msg.AssetIdSynthetic = assetIdSyn
+	s.msg.AssetIdSynthetic = asset.AssetId
 	s.msg.AssetIdCollateral = assetId
 	s.msg.AssetIdFee = assetId
 	s.msg.QuantumAmountSynthetic = size.Mul(resolutionC).BigInt()
@@ -106,3 +106,83 @@ func TestNonceByClientId(t *testing.T) {
 		t.Errorf("Expecting: %s, got: %s", correct_none.String(), nonce.String())
 	}
 }
+
+func TestSignHash(t *testing.T) {
+	param := OrderSignParam{
+		NetworkId:  NETWORK_ID_ROPSTEN,
+		Market:     "ETH-USD",
+		Side:       "BUY",
+		PositionId: 12345,
+		HumanSize:  "145.0005",
+		HumanPrice: "350.00067",
+		LimitFee:   "0.125",
+		ClientId:   "This is an ID that the client came up with to describe this order",
+		Expiration: "2020-09-17T04:15:55.028Z",
+	}
+	hash, err := GetOrderHash(param)
+	if err != nil {
+		t.Fatalf("failed to get order hash: %v", err)
+	}
+	r, s, err := SignHash(MOCK_PRIVATE_KEY, hash)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	correct_sign := "00cecbe513ecdbf782cd02b2a5efb03e58d5f63d15f2b840e9bc0029af04e8dd0090b822b16f50b2120e4ea9852b340f7936ff6069d02acca02f2ed03029ace5"
+	sign := SerializeSignature(r, s)
+	if sign != correct_sign {
+		t.Fatalf("Expecting: %s\n, got: %s", correct_sign, sign)
+	}
+	r1, s1, err := DeserializeSignature(sign)
+	if err != nil {
+		t.Fatalf("failed to deserialize signature: %v", err)
+	}
+	if r1.Cmp(r) != 0 || s1.Cmp(s) != 0 {
+		t.Errorf("deserialized signature (%s, %s) is different from (%s, %s)", r1, s1, r, s)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	param := OrderSignParam{
+		NetworkId:  NETWORK_ID_ROPSTEN,
+		Market:     "ETH-USD",
+		Side:       "BUY",
+		PositionId: 12345,
+		HumanSize:  "145.0005",
+		HumanPrice: "350.00067",
+		LimitFee:   "0.125",
+		ClientId:   "This is an ID that the client came up with to describe this order",
+		Expiration: "2020-09-17T04:15:55.028Z",
+	}
+	hash, err := GetOrderHash(param)
+	if err != nil {
+		t.Fatalf("failed to get order hash: %v", err)
+	}
+	sign := "00cecbe513ecdbf782cd02b2a5efb03e58d5f63d15f2b840e9bc0029af04e8dd0090b822b16f50b2120e4ea9852b340f7936ff6069d02acca02f2ed03029ace5"
+
+	ok, err := VerifySignature(hash, sign, MOCK_PUBLIC_KEY, "")
+	if err != nil || !ok {
+		t.Fatalf("failed to verify signature: %v", err)
+	}
+
+	priKey, _ := new(big.Int).SetString(MOCK_PRIVATE_KEY, 16)
+	x, y, err := PrivateKeyToEcPointOnStarkCurv(priKey)
+	if err != nil {
+		t.Fatalf("failed to get public key: %v", err)
+	}
+	if x.Text(16) != MOCK_PUBLIC_KEY {
+		t.Fatalf("public key %s is different from %s", x.Text(16), MOCK_PUBLIC_KEY)
+	}
+	ok, err = VerifySignature(hash, sign, x.Text(16), y.Text(16))
+	if err != nil || !ok {
+		t.Fatalf("failed to verify signature with y coordinate: %v", err)
+	}
+
+	ok, err = VerifySignature(new(big.Int).Add(hash, one), sign, MOCK_PUBLIC_KEY, "")
+	if err != nil || ok {
+		t.Fatalf("signature of a different hash should not verify: %v", err)
+	}
+	ok, err = VerifySignature(hash, sign, MOCK_PUBLIC_KEY, new(big.Int).Sub(FIELD_PRIME, y).Text(16))
+	if err != nil || ok {
+		t.Fatalf("signature should not verify with the negated public key: %v", err)
+	}
+}
@@ -25,12 +25,27 @@ func OrderSign(starkPrivateKey string, param OrderSignParam) (string, error) {
 	return NewSigner(starkPrivateKey).SignOrder(param)
 }
 
+// GetOrderHash returns the message hash of the order, which can be signed offline with SignHash.
+func GetOrderHash(param OrderSignParam) (*big.Int, error) {
+	return GetMessageHash(&OrderSigner{param: param})
+}
+
+// GetWithdrawHash returns the message hash of the withdrawal, which can be signed offline with SignHash.
+func GetWithdrawHash(param WithdrawSignParam) (*big.Int, error) {
+	return GetMessageHash(&WithdrawSigner{param: param})
+}
+
+// GetTransferHash returns the message hash of the transfer, which can be signed offline with SignHash.
+func GetTransferHash(param TransferSignParam) (*big.Int, error) {
+	return GetMessageHash(&TransferSigner{param: param})
+}
+
 func PrivateKeyToEcPointOnStarkCurv(priv_key *big.Int) (*big.Int, *big.Int, error) {
 	if priv_key.Sign() < 0 || priv_key.Cmp(EC_ORDER) >= 0 {
 		return nil, nil, fmt.Errorf("private key is invalid: %s", priv_key.String())
 	}
 
-	x := ecMult(priv_key, pedersenCfg.ConstantPoints[1], pedersenCfg.ALPHA, FIELD_PRIME)
+	x := ecMultGenerator(priv_key)
 
 	return x[0], x[1], nil
 }
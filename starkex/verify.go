@@ -0,0 +1,129 @@
+package starkex
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Verify checks the signature (r, s) of the message hash against the public key on the stark curve.
+// It follows verify in the python implementation.
+func Verify(msgHash, r, s *big.Int, publicKey [2]*big.Int) bool {
+	if msgHash == nil || r == nil || s == nil || publicKey[0] == nil || publicKey[1] == nil {
+		return false
+	}
+
+	nBit := new(big.Int).Exp(two, N_ELEMENT_BITS_ECDSA, nil)
+	// 1 <= r < 2 ** N_ELEMENT_BITS_ECDSA
+	if r.Cmp(one) < 0 || r.Cmp(nBit) >= 0 {
+		return false
+	}
+	// 1 <= s < EC_ORDER
+	if s.Cmp(one) < 0 || s.Cmp(EC_ORDER) >= 0 {
+		return false
+	}
+	// 0 <= msg_hash < 2 ** N_ELEMENT_BITS_ECDSA
+	if msgHash.Sign() < 0 || msgHash.Cmp(nBit) >= 0 {
+		return false
+	}
+	// w = inv_mod_curve_size(s), 1 <= w < 2 ** N_ELEMENT_BITS_ECDSA
+	w := divMod(one, s, EC_ORDER)
+	if w.Cmp(one) < 0 || w.Cmp(nBit) >= 0 {
+		return false
+	}
+	if !isOnCurve(publicKey) {
+		return false
+	}
+
+	alpha := big.NewInt(int64(pedersenCfg.ALPHA))
+
+	// zG + rQ
+	acc := newInfinityPoint()
+	if msgHash.Sign() > 0 {
+		getGeneratorTable().addMult(acc, msgHash, alpha, FIELD_PRIME)
+	}
+	rQ := ecMultJacobian(r, publicKey, alpha, FIELD_PRIME)
+	if rQ.isInfinity() {
+		return false
+	}
+	acc.addAffine(rQ.toAffine(FIELD_PRIME), alpha, FIELD_PRIME)
+	if acc.isInfinity() {
+		return false
+	}
+
+	// w * (zG + rQ)
+	wB := ecMultJacobian(w, acc.toAffine(FIELD_PRIME), alpha, FIELD_PRIME)
+	if wB.isInfinity() {
+		return false
+	}
+
+	return wB.toAffine(FIELD_PRIME)[0].Cmp(r) == 0
+}
+
+// VerifySignature checks the serialized signature of the message hash against the hex encoded public key.
+// When publicKeyYCoordinate is empty, both y coordinates of the public key are tried.
+func VerifySignature(msgHash *big.Int, signature string, publicKey string, publicKeyYCoordinate string) (bool, error) {
+	r, s, err := DeserializeSignature(signature)
+	if err != nil {
+		return false, err
+	}
+
+	x, ok := new(big.Int).SetString(strings.TrimPrefix(publicKey, "0x"), 16)
+	if !ok {
+		return false, fmt.Errorf("invalid public key: %s", publicKey)
+	}
+
+	if publicKeyYCoordinate != "" {
+		y, ok := new(big.Int).SetString(strings.TrimPrefix(publicKeyYCoordinate, "0x"), 16)
+		if !ok {
+			return false, fmt.Errorf("invalid public key y coordinate: %s", publicKeyYCoordinate)
+		}
+		return Verify(msgHash, r, s, [2]*big.Int{x, y}), nil
+	}
+
+	y, err := getYCoordinate(x)
+	if err != nil {
+		return false, err
+	}
+
+	return Verify(msgHash, r, s, [2]*big.Int{x, y}) || Verify(msgHash, r, s, [2]*big.Int{x, new(big.Int).Sub(FIELD_PRIME, y)}), nil
+}
+
+// getYCoordinate returns one of the y coordinates of the point with x on the curve y^2 = x^3 + alpha*x + beta.
+func getYCoordinate(x *big.Int) (*big.Int, error) {
+	ySquared := getCurveRhs(x)
+	y := new(big.Int).ModSqrt(ySquared, FIELD_PRIME)
+	if y == nil {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return y, nil
+}
+
+// getCurveRhs returns x^3 + alpha*x + beta mod p
+func getCurveRhs(x *big.Int) *big.Int {
+	rhs := new(big.Int).Mul(x, x)
+	rhs.Mul(rhs, x)
+	rhs.Add(rhs, new(big.Int).Mul(big.NewInt(int64(pedersenCfg.ALPHA)), x))
+	rhs.Add(rhs, pedersenCfg.BETA)
+	return rhs.Mod(rhs, FIELD_PRIME)
+}
+
+// isOnCurve checks y^2 = x^3 + alpha*x + beta mod p
+func isOnCurve(point [2]*big.Int) bool {
+	ySquared := new(big.Int).Mul(point[1], point[1])
+	ySquared.Mod(ySquared, FIELD_PRIME)
+	return ySquared.Cmp(getCurveRhs(point[0])) == 0
+}
+
+// ecMultJacobian is the same as ecMult, but returns the result in Jacobian coordinates, which can be infinity.
+func ecMultJacobian(m *big.Int, point [2]*big.Int, alpha *big.Int, p *big.Int) *jacobianPoint {
+	result := newInfinityPoint()
+	for i := m.BitLen() - 1; i >= 0; i-- {
+		result.double(alpha, p)
+		if m.Bit(i) == 1 {
+			result.addAffine(point, alpha, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,200 @@
+package dydx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SubscriptionHandler receives the messages of a subscription started by StartSubscription.
+// The methods are called from one goroutine in the order of the messages.
+type SubscriptionHandler[TContents any] interface {
+	// OnSubscribed is called with the subscribed message, which contains the initial data for orderbook and account.
+	OnSubscribed(resp *ChannelResponse[TContents])
+	// OnData is called with all the other messages, including channel_data, channel_batch_data,
+	// and the resync, gap, and stale messages generated by the library.
+	OnData(resp *ChannelResponse[TContents])
+	// OnError is called once with the error ending the subscription after it is acknowledged.
+	// It is not called when the subscription is closed or the context is cancelled.
+	OnError(err error)
+	// OnReconnect is called with the reconnected message after the connection is re-established, right before the new subscribed message.
+	OnReconnect(resp *ChannelResponse[TContents])
+}
+
+// SubscriptionHandlerFuncs implements SubscriptionHandler with functions. nil functions are skipped.
+type SubscriptionHandlerFuncs[TContents any] struct {
+	Subscribed func(resp *ChannelResponse[TContents])
+	Data       func(resp *ChannelResponse[TContents])
+	Error      func(err error)
+	Reconnect  func(resp *ChannelResponse[TContents])
+}
+
+var _ SubscriptionHandler[OrderbookChannelResponseContents] = (*SubscriptionHandlerFuncs[OrderbookChannelResponseContents])(nil)
+
+func (h *SubscriptionHandlerFuncs[TContents]) OnSubscribed(resp *ChannelResponse[TContents]) {
+	if h.Subscribed != nil {
+		h.Subscribed(resp)
+	}
+}
+
+func (h *SubscriptionHandlerFuncs[TContents]) OnData(resp *ChannelResponse[TContents]) {
+	if h.Data != nil {
+		h.Data(resp)
+	}
+}
+
+func (h *SubscriptionHandlerFuncs[TContents]) OnError(err error) {
+	if h.Error != nil {
+		h.Error(err)
+	}
+}
+
+func (h *SubscriptionHandlerFuncs[TContents]) OnReconnect(resp *ChannelResponse[TContents]) {
+	if h.Reconnect != nil {
+		h.Reconnect(resp)
+	}
+}
+
+// SubscriptionStats contains the counters of a subscription.
+type SubscriptionStats struct {
+	// Messages is the number of messages received, including the ones generated by the library.
+	Messages int64
+	// Reconnects is the number of reconnected messages.
+	Reconnects int64
+	// Gaps is the number of gap messages.
+	Gaps int64
+	// Stales is the number of stale messages.
+	Stales int64
+	// SubscribedAt is the time of the first subscribed message.
+	SubscribedAt time.Time
+	// LastMessageAt is the time of the last message.
+	LastMessageAt time.Time
+}
+
+// Subscription is the handle of a running subscription started by StartSubscription.
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex sync.Mutex
+	err   error
+	stats SubscriptionStats
+}
+
+// Close stops the subscription and waits for it to finish. The returned error is the same as Err.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return s.Err()
+}
+
+// Done returns a channel closed after the subscription finishes.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error ending the subscription. It is nil when the subscription is still running,
+// or it is closed or its context is cancelled.
+func (s *Subscription) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Stats returns a copy of the current stats.
+func (s *Subscription) Stats() SubscriptionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stats
+}
+
+func (s *Subscription) record(header *ChannelResponseHeader) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.stats.Messages++
+	s.stats.LastMessageAt = now
+	switch header.Type {
+	case ChannelResponseTypeSubscribe:
+		if s.stats.SubscribedAt.IsZero() {
+			s.stats.SubscribedAt = now
+		}
+	case ChannelResponseTypeReconnected:
+		s.stats.Reconnects++
+	case ChannelResponseTypeGap:
+		s.stats.Gaps++
+	case ChannelResponseTypeStale:
+		s.stats.Stales++
+	}
+}
+
+// StartSubscription runs the subscribe function in the background and sends the messages to the handler.
+// It returns after the subscribed message is handled, or with an error if the subscription ends before that.
+//
+// subscribe is usually one of the SubscribeXXX methods of Client or WsConnection, for example
+//
+//	dydx.StartSubscription(ctx, func(ctx context.Context, output chan<- *dydx.TradesChannelResponse) error {
+//		return client.SubscribeTrades(ctx, "BTC-USD", output)
+//	}, handler)
+func StartSubscription[TContents any](ctx context.Context, subscribe func(context.Context, chan<- *ChannelResponse[TContents]) error, handler SubscriptionHandler[TContents]) (*Subscription, error) {
+	inner_ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{cancel: cancel, done: make(chan struct{})}
+
+	outputs := make(chan *ChannelResponse[TContents])
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(outputs)
+		errChan <- subscribe(inner_ctx, outputs)
+	}()
+
+	acked := make(chan struct{})
+	go func() {
+		defer close(s.done)
+		defer cancel()
+
+		isAcked := false
+		for resp := range outputs {
+			s.record(&resp.ChannelResponseHeader)
+			switch resp.Type {
+			case ChannelResponseTypeSubscribe:
+				handler.OnSubscribed(resp)
+				if !isAcked {
+					isAcked = true
+					close(acked)
+				}
+			case ChannelResponseTypeReconnected:
+				handler.OnReconnect(resp)
+			default:
+				handler.OnData(resp)
+			}
+		}
+
+		err := <-errChan
+		s.mutex.Lock()
+		s.err = err
+		s.mutex.Unlock()
+		if err != nil && isAcked {
+			handler.OnError(err)
+		}
+	}()
+
+	select {
+	case <-acked:
+		return s, nil
+	case <-s.done:
+		select {
+		case <-acked:
+			return s, nil
+		default:
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("subscription finished before it is acknowledged")
+	}
+}
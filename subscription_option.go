@@ -0,0 +1,94 @@
+package dydx
+
+import (
+	"io"
+	"time"
+)
+
+// subscriptionConfig contains the options of a subscription.
+type subscriptionConfig struct {
+	staleTimeout time.Duration
+	// noResync disables the resync of the orderbook after a gap in the message ids.
+	noResync bool
+	// batched requests the updates to be sent in batches of type ChannelResponseTypeChannelBatchData.
+	batched bool
+	// includeOffsets overrides the includeOffsets of the subscribe request when not nil.
+	includeOffsets *bool
+	// recorder receives the raw frames of the subscription.
+	recorder io.Writer
+	// overflowPolicy is how the messages are handled when the subscriber is slow.
+	overflowPolicy SubscriptionOverflowPolicy
+}
+
+// SubscriptionOption sets an option of a subscription, see the SetSubscriptionXxx functions.
+type SubscriptionOption func(cfg *subscriptionConfig)
+
+func newSubscriptionConfig(options []SubscriptionOption) *subscriptionConfig {
+	cfg := &subscriptionConfig{}
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// SetSubscriptionStaleTimeout sets the timeout of the subscription without receiving any message.
+//
+// When the timeout expires, a response of type ChannelResponseTypeStale is sent to the output channel, and the subscription
+// is renewed (unsubscribed and subscribed again) without affecting the other subscriptions on the connection. The output
+// receives ChannelResponseTypeReconnected before the new subscribed message. If the timeout expires again without any message
+// after the renewal, the subscription returns ErrSubscriptionStale.
+//
+// The connection is only reconnected after the read timeout or the failure of the pings, see SetWsKeepAlive.
+//
+// Feeds that can be quiet for long periods (for example trades of an illiquid market) should use a long timeout.
+func SetSubscriptionStaleTimeout(timeout time.Duration) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.staleTimeout = timeout
+	}
+}
+
+// SetSubscriptionOrderbookResync turns on/off the resync of the orderbook after a gap of the message ids, which is on by default.
+// Only Client.SubscribeOrderbook can resync since it needs the rest api.
+func SetSubscriptionOrderbookResync(enabled bool) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.noResync = !enabled
+	}
+}
+
+// SetSubscriptionBatched turns on/off the batching of the updates for orderbook and trades subscriptions.
+//
+// When batched, the server sends messages of type ChannelResponseTypeChannelBatchData, whose updates are in BatchContents
+// of the response in the order they should be applied.
+func SetSubscriptionBatched(batched bool) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.batched = batched
+	}
+}
+
+// SetSubscriptionIncludeOffsets sets if the offsets are included in the updates of orderbook and trades subscriptions.
+// Orderbook subscriptions include the offsets by default, which are required to maintain the book correctly.
+func SetSubscriptionIncludeOffsets(includeOffsets bool) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.includeOffsets = &includeOffsets
+	}
+}
+
+// SetSubscriptionRecorder tees the frames received for the subscription to the writer in JSON lines format, see RecordedFrame.
+// The messages generated by the library for reconnects and message id gaps are recorded as synthetic frames.
+// The frames are recorded by the reader of the connection before they are queued for the subscription, so the frames dropped
+// by SubscriptionOverflowGap or during a renewal are recorded as well, and a slow writer holds up the connection.
+// Each frame is written with one call to Write, and the writer must be safe for concurrent use if it is shared by
+// several subscriptions. RotatingFileWriter can be used to record into files. Use ReplayRecording to read the frames back.
+func SetSubscriptionRecorder(w io.Writer) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.recorder = w
+	}
+}
+
+// SetSubscriptionOverflowPolicy sets how the messages are handled when the subscriber doesn't keep up with them.
+// Default is SubscriptionOverflowGap.
+func SetSubscriptionOverflowPolicy(policy SubscriptionOverflowPolicy) SubscriptionOption {
+	return func(cfg *subscriptionConfig) {
+		cfg.overflowPolicy = policy
+	}
+}
@@ -6,12 +6,21 @@ import (
 	"testing"
 
 	"github.com/fardream/go-dydx"
-	"github.com/fardream/go-dydx/heap"
 )
 
 //go:embed orderbook.json
 var orderbook_data string
 
+// isSorted checks the levels are strictly sorted by the price, ascending when direction is 1 and descending when direction is -1.
+func isSorted(levels []*dydx.OrderbookOrder, direction int) bool {
+	for i := 1; i < len(levels); i++ {
+		if levels[i].Price.Cmp(&levels[i-1].Price.Decimal) != direction {
+			return false
+		}
+	}
+	return true
+}
+
 func TestOrderBookProcessor(t *testing.T) {
 	ob := dydx.NewOrderbookProcessor("BTC-USD", false)
 	var data []*dydx.OrderbookChannelResponse
@@ -20,11 +29,25 @@ func TestOrderBookProcessor(t *testing.T) {
 	}
 	for _, a := range data {
 		ob.Process(a)
-		if !heap.IsHeap[*dydx.Bids, *dydx.OrderbookOrder](&ob.Bids) {
-			t.Fatalf("bids not heap: %s\n", ob.Bids.PrintBook())
+		bids := ob.Bids.Levels(-1)
+		if len(bids) != ob.Bids.Len() || !isSorted(bids, -1) {
+			t.Fatalf("bids not sorted: %s\n", ob.Bids.PrintBook())
 		}
-		if !heap.IsHeap[*dydx.Asks, *dydx.OrderbookOrder](&ob.Asks) {
-			t.Fatalf("asks not heap: %s\n", ob.Bids.PrintBook())
+		asks := ob.Asks.Levels(-1)
+		if len(asks) != ob.Asks.Len() || !isSorted(asks, 1) {
+			t.Fatalf("asks not sorted: %s\n", ob.Asks.PrintBook())
 		}
+		for _, v := range bids {
+			if level, ok := ob.Bids.Get(v.Price); !ok || level != v {
+				t.Fatalf("failed to look up bid %s", v.PriceString)
+			}
+		}
+	}
+
+	if top := ob.Asks.Levels(10); ob.Asks.Len() >= 10 && len(top) != 10 {
+		t.Fatalf("expecting 10 levels, got %d", len(top))
+	}
+	if bid, ask := ob.BookTop(); bid != nil && ask != nil && bid != ob.Bids.Levels(1)[0] {
+		t.Fatalf("book top is not the first level")
 	}
 }
@@ -8,20 +8,35 @@ type tradesChannelRequest struct {
 
 	ID             string `json:"id"`
 	IncludeOffsets *bool  `json:"includeOffsets,omitempty"`
+	Batched        *bool  `json:"batched,omitempty"`
 }
 
 type TradesChannelResponseContents = TradesResponse
 
-func newTradesChannelRequest(market string) *tradesChannelRequest {
-	return &tradesChannelRequest{
+func newTradesChannelRequest(market string, cfg *subscriptionConfig) *tradesChannelRequest {
+	r := &tradesChannelRequest{
 		Type:    subscribeChannelRequestType,
 		Channel: TradesChannel,
 		ID:      market,
 	}
+	r.IncludeOffsets = cfg.includeOffsets
+	if cfg.batched {
+		b := true
+		r.Batched = &b
+	}
+	return r
 }
 
 type TradesChannelResponse = ChannelResponse[TradesChannelResponseContents]
 
-func (c *Client) SubscribeTrades(ctx context.Context, market string, outputChan chan<- *TradesChannelResponse) error {
-	return subscribeForType(ctx, c.wsUrl, newTradesChannelRequest(market), newUnsubscribeRequest(TradesChannel, market), outputChan)
+func (c *Client) SubscribeTrades(ctx context.Context, market string, outputChan chan<- *TradesChannelResponse, options ...SubscriptionOption) error {
+	return c.getWsConnection().SubscribeTrades(ctx, market, outputChan, options...)
+}
+
+// SubscribeTradesWithHandler starts the trades subscription in the background and sends the updates to the handler.
+// It returns after the subscription is acknowledged. See StartSubscription.
+func (c *Client) SubscribeTradesWithHandler(ctx context.Context, market string, handler SubscriptionHandler[TradesChannelResponseContents], options ...SubscriptionOption) (*Subscription, error) {
+	return StartSubscription(ctx, func(ctx context.Context, outputChan chan<- *TradesChannelResponse) error {
+		return c.SubscribeTrades(ctx, market, outputChan, options...)
+	}, handler)
 }
@@ -0,0 +1,107 @@
+package dydx
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// UpdateSink receives the updates kept by a processor, for example the updates processed by OrderbookProcessor.
+type UpdateSink[T any] interface {
+	Add(update T)
+}
+
+var (
+	_ UpdateSink[*OrderbookChannelResponse] = DiscardSink[*OrderbookChannelResponse]{}
+	_ UpdateSink[*OrderbookChannelResponse] = (*RingBufferSink[*OrderbookChannelResponse])(nil)
+	_ UpdateSink[*OrderbookChannelResponse] = (*JsonLinesSink[*OrderbookChannelResponse])(nil)
+)
+
+// DiscardSink drops all the updates.
+type DiscardSink[T any] struct{}
+
+func (DiscardSink[T]) Add(T) {}
+
+// RingBufferSink keeps the last N updates. It is safe for concurrent use.
+type RingBufferSink[T any] struct {
+	mutex   sync.Mutex
+	updates []T
+	// next is the index of the next update in updates.
+	next int
+	full bool
+}
+
+// NewRingBufferSink creates a sink keeping the last size updates.
+func NewRingBufferSink[T any](size int) *RingBufferSink[T] {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingBufferSink[T]{updates: make([]T, size)}
+}
+
+// Add keeps the update, and drops the oldest update if the buffer is full.
+func (r *RingBufferSink[T]) Add(update T) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.updates[r.next] = update
+	r.next++
+	if r.next == len(r.updates) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Len returns the number of the updates kept.
+func (r *RingBufferSink[T]) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.full {
+		return len(r.updates)
+	}
+	return r.next
+}
+
+// Updates returns a copy of the updates kept, from the oldest to the newest.
+func (r *RingBufferSink[T]) Updates() []T {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.full {
+		return append([]T(nil), r.updates[:r.next]...)
+	}
+	result := make([]T, 0, len(r.updates))
+	result = append(result, r.updates[r.next:]...)
+	return append(result, r.updates[:r.next]...)
+}
+
+// JsonLinesSink writes each update as a line of json to the writer as it arrives.
+// After the first error from the writer, the updates are dropped and the error is returned by Err.
+type JsonLinesSink[T any] struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+	err     error
+}
+
+// NewJsonLinesSink creates a sink writing to w.
+func NewJsonLinesSink[T any](w io.Writer) *JsonLinesSink[T] {
+	return &JsonLinesSink[T]{encoder: json.NewEncoder(w)}
+}
+
+// Add writes the update.
+func (j *JsonLinesSink[T]) Add(update T) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.err != nil {
+		return
+	}
+	if err := j.encoder.Encode(update); err != nil {
+		log.Warnf("failed to write update: %v", err)
+		j.err = err
+	}
+}
+
+// Err returns the first error from writing the updates.
+func (j *JsonLinesSink[T]) Err() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.err
+}
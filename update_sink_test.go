@@ -0,0 +1,69 @@
+package dydx_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fardream/go-dydx"
+)
+
+func TestRingBufferSink(t *testing.T) {
+	sink := dydx.NewRingBufferSink[int](3)
+	sink.Add(1)
+	sink.Add(2)
+	if diff := cmp.Diff([]int{1, 2}, sink.Updates()); diff != "" || sink.Len() != 2 {
+		t.Fatalf("unexpected updates: %s", diff)
+	}
+	for i := 3; i <= 7; i++ {
+		sink.Add(i)
+	}
+	if diff := cmp.Diff([]int{5, 6, 7}, sink.Updates()); diff != "" || sink.Len() != 3 {
+		t.Fatalf("unexpected updates: %s", diff)
+	}
+}
+
+func TestOrderbookProcessorSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := dydx.NewJsonLinesSink[*dydx.OrderbookChannelResponse](&buf)
+	ob := dydx.NewOrderbookProcessor("BTC-USD", false, dydx.SetOrderbookProcessorSink(sink))
+
+	updates := []*dydx.OrderbookChannelResponse{
+		newTestOrderbookUpdate(1, []*dydx.OrderbookOrder{newTestLevel(t, "100", "1", 1)}, nil),
+		{
+			ChannelResponseHeader: dydx.ChannelResponseHeader{Type: dydx.ChannelResponseTypeChannelBatchData},
+			BatchContents:         []*dydx.OrderbookResponse{newTestOrderbookUpdate(2, nil, []*dydx.OrderbookOrder{newTestLevel(t, "101", "1", 2)}).Contents},
+		},
+	}
+	for _, v := range updates {
+		ob.Process(v)
+	}
+	if sink.Err() != nil || ob.Data() != nil {
+		t.Fatalf("unexpected sink state: %v", sink.Err())
+	}
+
+	// each update is written as one line as it arrives.
+	scanner := bufio.NewScanner(&buf)
+	var lines int
+	for ; scanner.Scan(); lines++ {
+		var v dydx.OrderbookChannelResponse
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			t.Fatalf("failed to parse line %d: %v", lines, err)
+		}
+		if v.Type != updates[lines].Type || !v.HasContents() {
+			t.Fatalf("unexpected line %d: %s", lines, scanner.Text())
+		}
+	}
+	if lines != len(updates) {
+		t.Fatalf("expecting %d lines, got %d", len(updates), lines)
+	}
+
+	ob = dydx.NewOrderbookProcessor("BTC-USD", false)
+	ob.Process(updates[0])
+	if data := ob.Data(); len(data) != 1 || data[0] != updates[0] {
+		t.Fatalf("default sink should keep the updates: %#v", data)
+	}
+}
@@ -113,6 +113,9 @@ type CreateUserParam struct {
 	EthereumAddress         string `json:"-"`
 	ReferredByAffiliateLink string `json:"referredByAffiliateLink,omitempty"`
 	Country                 string `json:"country,omitempty"`
+	// SignatureType is how the onboarding message is signed, and is not part of the request.
+	// Default is SignatureTypeNoPrepend.
+	SignatureType SignatureType `json:"-"`
 }
 
 type CreateUserResponse struct {
@@ -131,16 +134,16 @@ func (c *Client) checkCreateUserParam(param *CreateUserParam) (*CreateUserParam,
 		p.EthereumAddress = c.ethAddress
 	}
 	if len(p.StarkPublicKey) == 0 {
-		if c.starkKey == nil {
+		if c.starkSigner == nil {
 			return nil, fmt.Errorf("parameter doesn't have stark public key and client doesn't have it either")
 		}
-		p.StarkPublicKey = c.starkKey.PublicKey
+		p.StarkPublicKey, _ = c.starkSigner.StarkPublicKey()
 	}
 	if len(p.StarkPublicKeyYCoordinate) == 0 {
-		if c.starkKey == nil {
+		if c.starkSigner == nil {
 			return nil, fmt.Errorf("parameter doesn't have stark public key y coordinate and client doesn't have it either")
 		}
-		p.StarkPublicKeyYCoordinate = c.starkKey.PublicKeyYCoordinate
+		_, p.StarkPublicKeyYCoordinate = c.starkSigner.StarkPublicKey()
 	}
 
 	if len(p.EthereumAddress) == 0 {
@@ -172,11 +175,10 @@ func (c *Client) CreateUser(ctx context.Context, signer SignTypedData, param *Cr
 	}
 
 	onboardingTypedData := getOnboardingTypedData(c.networkId == NetworkIdMainnet, onboardingAction)
-	signature, err := signer.EthSignTypedData(onboardingTypedData)
+	signature, err := SignTypedDataWithType(signer, onboardingTypedData, p.SignatureType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign typed data %#v: %w", onboardingTypedData, err)
+		return nil, err
 	}
-	signature = append(signature, 0)
 
 	full_path := urlJoin(c.rpcUrl, "v3/onboarding")
 
@@ -1,14 +1,8 @@
 package dydx
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
-	"sync"
-	"time"
-
-	"github.com/gorilla/websocket"
 )
 
 // ChannelResponseHeader contains all the common information in the channel response.
@@ -35,6 +29,54 @@ type ChannelResponseHeader struct {
 type ChannelResponse[TContents any] struct {
 	ChannelResponseHeader
 	Contents *TContents `json:"contents,omitempty"`
+	// BatchContents contains the updates of a batched subscription in order, and is only set when the type is
+	// ChannelResponseTypeChannelBatchData. Contents is nil in that case.
+	BatchContents []*TContents `json:"-"`
+}
+
+// UnmarshalJSON parses the contents into BatchContents for batched data, and Contents otherwise.
+func (r *ChannelResponse[TContents]) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ChannelResponseHeader
+		Contents json.RawMessage `json:"contents,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	r.ChannelResponseHeader = raw.ChannelResponseHeader
+	r.Contents = nil
+	r.BatchContents = nil
+
+	if len(raw.Contents) == 0 || string(raw.Contents) == "null" {
+		return nil
+	}
+	if raw.Type == ChannelResponseTypeChannelBatchData {
+		return json.Unmarshal(raw.Contents, &r.BatchContents)
+	}
+	r.Contents = new(TContents)
+	return json.Unmarshal(raw.Contents, r.Contents)
+}
+
+// MarshalJSON writes BatchContents as the contents for batched data, so the output can be parsed back by UnmarshalJSON.
+func (r ChannelResponse[TContents]) MarshalJSON() ([]byte, error) {
+	var contents any
+	if r.Type == ChannelResponseTypeChannelBatchData {
+		if r.BatchContents != nil {
+			contents = r.BatchContents
+		}
+	} else if r.Contents != nil {
+		contents = r.Contents
+	}
+	return json.Marshal(struct {
+		ChannelResponseHeader
+		Contents any `json:"contents,omitempty"`
+	}{ChannelResponseHeader: r.ChannelResponseHeader, Contents: contents})
+}
+
+// HasContents checks if the response contains any contents.
+func (r *ChannelResponse[TContents]) HasContents() bool {
+	return r.Contents != nil || len(r.BatchContents) > 0
 }
 
 const (
@@ -55,6 +97,19 @@ const (
 	ChannelResponseTypeError       = "error"
 	ChannelResponseTypeConnected   = "connected"
 	ChannelResponseTypeChannelData = "channel_data"
+	// ChannelResponseTypeChannelBatchData is for batched subscriptions, see SetSubscriptionBatched.
+	ChannelResponseTypeChannelBatchData = "channel_batch_data"
+	// ChannelResponseTypeReconnected is not sent by the server. It is sent to the output channel after the subscription is
+	// reconnected (see ReconnectPolicy) or renewed for another subscription to the same channel and id (see WsConnection),
+	// right before the subscribed message.
+	ChannelResponseTypeReconnected = "reconnected"
+	// ChannelResponseTypeGap is not sent by the server. It is sent to the output channel before the message that
+	// reveals a gap in the message ids of the channel and id on the connection, or after messages are dropped for a slow
+	// subscriber (see SubscriptionOverflowGap). The subscription may have missed updates.
+	ChannelResponseTypeGap = "gap"
+	// ChannelResponseTypeResync is not sent by the server. It is sent by Client.SubscribeOrderbook after a gap,
+	// and its contents is the orderbook snapshot from the rest api, with the offset of the last update before the gap.
+	ChannelResponseTypeResync = "resync"
 )
 
 type unsubscribeRequest struct {
@@ -67,140 +122,12 @@ func newUnsubscribeRequest(channel, id string) *unsubscribeRequest {
 	return &unsubscribeRequest{Type: unsubscribeChannelRequestType, Channel: channel, Id: id}
 }
 
-// subscribeForType subscribes with the request and write the output to the channel.
-// gorrila/websocket doesn't support context, so a separate goroutine is launched to read the data.
-func subscribeForType[TData any](ctx context.Context, url string, subscribe any, unsubscribe *unsubscribeRequest, output chan<- *ChannelResponse[TData]) error {
-	// wait for loop read to finish.
-	var wg sync.WaitGroup
-	defer wg.Wait()
-
-	inner_ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	// dial and create the connection.
-	dialer := &websocket.Dialer{
-		Proxy:            http.ProxyFromEnvironment,
-		HandshakeTimeout: 60 * time.Second,
-	}
-
-	conn, rsp, err := dialer.DialContext(inner_ctx, url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to connect to websocket %s: %w\nresponse is %#v", url, err, rsp)
-	}
-	defer conn.Close()
-
-	msg_chan := make(chan []byte)
-	err_chan := make(chan error)
-
-	// start looping read
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		// close message channel
-		defer close(msg_chan)
-		// close error channel.
-		defer close(err_chan)
-
-		select {
-		case err_chan <- loopRead(inner_ctx, conn, msg_chan):
-		case <-inner_ctx.Done():
-		}
-	}()
-
-	if err = conn.WriteJSON(subscribe); err != nil {
-		return fmt.Errorf("failed to write subscribe request %#v: %w", subscribe, err)
-	}
-
-write_loop:
-	for {
-		select {
-		case <-inner_ctx.Done():
-			break write_loop
-
-		case msg, ok := <-msg_chan:
-			// message channel is closed.
-			// break out the loop
-			if !ok {
-				break write_loop
-			}
-
-			// parse the response
-			resp := new(ChannelResponse[TData])
-
-			err := json.Unmarshal(msg, &resp)
-			if err != nil {
-				log.Warnf("failed to parse data: %v", err)
-				continue write_loop
-			}
-
-			if resp.Type == ChannelResponseTypeSubscribe {
-				unsubscribe.Id = resp.Id
-			} else if resp.Type == ChannelResponseTypeError {
-				// cancel everything
-				cancel()
-				unsubscribeAndClose(conn, nil)
-				return fmt.Errorf("subscription error: %s", resp.Message)
-			}
-
-			// send the response
-			select {
-			case <-inner_ctx.Done():
-				break write_loop
-			case output <- resp:
-			}
-
-		case err := <-err_chan:
-			log.Debugf("received error: %v", err)
-			// the read loop error-ed.
-			if err != nil {
-				log.Warnf("err received from read loop, quit: %#v", err)
-				return err
-			}
-		}
-	}
-
-	if err := unsubscribeAndClose(conn, unsubscribe); err != nil {
-		return err
-	}
-
-	// drain the error channel
-	return <-err_chan
-}
-
-func unsubscribeAndClose(conn *websocket.Conn, unsubscribe *unsubscribeRequest) error {
-	// request cancelled.
-	// Close the connection.
-	if unsubscribe != nil {
-		if err := conn.WriteJSON(unsubscribe); err != nil {
-			return err
-		}
-	}
-	if err := conn.WriteControl(websocket.CloseMessage, nil, time.Now().Add(time.Second*2)); err != nil {
-		return err
-	}
-
-	return nil
+// ChannelError is the error response from the server for the subscription.
+// Subscriptions are not retried after receiving an error from the server.
+type ChannelError struct {
+	ChannelResponseHeader
 }
 
-// loopRead reads the data from the connection
-func loopRead(ctx context.Context, conn *websocket.Conn, output chan<- []byte) error {
-	for {
-		_, msg, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-				return nil
-			}
-			log.Warnf("error reading websocket: %#v", err)
-			log.Warnf("quit read loop")
-			return err
-		}
-
-		log.Debugf("message received from websocket: %s", string(msg))
-
-		select {
-		case output <- msg:
-		case <-ctx.Done():
-			return nil
-		}
-	}
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("subscription error: %s", e.Message)
 }
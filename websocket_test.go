@@ -0,0 +1,848 @@
+package dydx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fardream/go-dydx"
+)
+
+// scriptedWsServer replies to the subscribe request of each connection with the script at the index of the connection.
+// The connection is closed after the script is sent, unless it is the last one.
+func newScriptedWsServer(t *testing.T, scripts [][]string) *httptest.Server {
+	var mu sync.Mutex
+	connIndex := 0
+	upgrader := websocket.Upgrader{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		mu.Lock()
+		index := connIndex
+		connIndex++
+		mu.Unlock()
+
+		if index >= len(scripts) {
+			return
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"connected","connection_id":"c"}`))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for _, msg := range scripts[index] {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+		if index < len(scripts)-1 {
+			return
+		}
+		// keep the last connection open until the client leaves.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func getTestWsUrl(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	server := newScriptedWsServer(t, [][]string{
+		{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"10","bids":[{"price":"100","size":"1"}],"asks":[{"price":"101","size":"1"}]}}`,
+			`{"type":"channel_data","channel":"v3_orderbook","id":"BTC-USD","message_id":2,"contents":{"offset":"11","bids":[["99","2"]],"asks":[]}}`,
+		},
+		{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"20","bids":[{"price":"98","size":"3"}],"asks":[{"price":"102","size":"1"}]}}`,
+		},
+	})
+	defer server.Close()
+
+	policy := &dydx.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2, MaxAttempts: 3}
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)), dydx.SetClientReconnectPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(chan *dydx.OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(outputs)
+		errChan <- client.SubscribeOrderbook(ctx, "BTC-USD", outputs)
+	}()
+
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true)
+	var types []string
+	for v := range outputs {
+		types = append(types, v.Type)
+		ob.Process(v)
+		if len(types) == 4 {
+			cancel()
+		}
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+
+	expected := []string{
+		dydx.ChannelResponseTypeSubscribe,
+		dydx.ChannelResponseTypeChannelData,
+		dydx.ChannelResponseTypeReconnected,
+		dydx.ChannelResponseTypeSubscribe,
+	}
+	if len(types) < len(expected) {
+		t.Fatalf("expecting at least %v, got %v", expected, types)
+	}
+	for i, v := range expected {
+		if types[i] != v {
+			t.Fatalf("expecting %v, got %v", expected, types)
+		}
+	}
+
+	bid, ask := ob.BookTop()
+	if ob.Bids.Len() != 1 || ob.Asks.Len() != 1 || bid.PriceString != "98" || ask.PriceString != "102" {
+		t.Fatalf("book is not reset after reconnect: bids %s asks %s", ob.Bids.PrintBook(), ob.Asks.PrintBook())
+	}
+}
+
+func TestSubscribeReconnectGiveUp(t *testing.T) {
+	// server closes every connection before the subscription is acknowledged.
+	server := newScriptedWsServer(t, nil)
+	defer server.Close()
+
+	policy := &dydx.ReconnectPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, Multiplier: 2, MaxAttempts: 2}
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)), dydx.SetClientReconnectPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(chan *dydx.TradesChannelResponse)
+	go func() {
+		for range outputs {
+		}
+	}()
+	defer close(outputs)
+
+	if err := client.SubscribeTrades(ctx, "BTC-USD", outputs); err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("expecting error after 2 attempts, got %v", err)
+	}
+}
+
+// newEchoWsServer acknowledges every subscribe request and sends one update for it.
+// The account channel is acknowledged with id "account-<account number>".
+func newEchoWsServer(t *testing.T, connCount *int32) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		atomic.AddInt32(connCount, 1)
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"connected","connection_id":"c"}`))
+		// the message ids are numbered for each channel and id.
+		messageIds := make(map[string]int)
+		for {
+			var req struct {
+				Type          string       `json:"type"`
+				Channel       string       `json:"channel"`
+				Id            string       `json:"id"`
+				AccountNumber dydx.JsonInt `json:"accountNumber"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			id := req.Id
+			contents := "{}"
+			if req.Channel == dydx.AccountChannel {
+				id = fmt.Sprintf("account-%d", req.AccountNumber)
+				contents = fmt.Sprintf(`{"account":{"accountNumber":"%d"}}`, req.AccountNumber)
+			}
+			var replies []string
+			switch req.Type {
+			case "subscribe":
+				replies = []string{
+					fmt.Sprintf(`{"type":"subscribed","channel":"%s","id":"%s","contents":%s}`, req.Channel, id, contents),
+					fmt.Sprintf(`{"type":"channel_data","channel":"%s","id":"%s","contents":{}}`, req.Channel, id),
+				}
+			case "unsubscribe":
+				replies = []string{fmt.Sprintf(`{"type":"unsubscribed","channel":"%s","id":"%s"}`, req.Channel, id)}
+			}
+			for _, reply := range replies {
+				messageIds[req.Channel+id]++
+				var m map[string]any
+				json.Unmarshal([]byte(reply), &m)
+				m["message_id"] = messageIds[req.Channel+id]
+				if err := conn.WriteJSON(m); err != nil {
+					return
+				}
+			}
+		}
+	}))
+}
+
+func TestWsConnectionMultiplex(t *testing.T) {
+	var connCount int32
+	server := newEchoWsServer(t, &connCount)
+	defer server.Close()
+
+	client, _ := dydx.NewClient(nil, dydx.NewApiKey("key", "passphrase", "c2VjcmV0"), "", false, dydx.SetClientWsUrl(getTestWsUrl(server)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sub_ctx, sub_cancel := context.WithCancel(ctx)
+	defer sub_cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	// each subscription receives the subscribed message and one update.
+	ready := make(chan string, 6)
+
+	for _, market := range []string{"BTC-USD", "ETH-USD"} {
+		market := market
+		outputs := make(chan *dydx.OrderbookChannelResponse)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- client.SubscribeOrderbook(sub_ctx, market, outputs)
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2; i++ {
+				select {
+				case v := <-outputs:
+					ready <- v.Id
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	accountOutputs := make(chan *dydx.AccountChannelResponse)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs <- client.SubscribeAccount(sub_ctx, 0, accountOutputs)
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2; i++ {
+			select {
+			case v := <-accountOutputs:
+				ready <- v.Id
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		select {
+		case id := <-ready:
+			counts[id]++
+		case <-ctx.Done():
+			t.Fatalf("timed out, received %v", counts)
+		}
+	}
+	sub_cancel()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("subscription failed: %v", err)
+		}
+	}
+
+	expected := map[string]int{"BTC-USD": 2, "ETH-USD": 2, "account-0": 2}
+	for k, v := range expected {
+		if counts[k] != v {
+			t.Errorf("expecting %v, got %v", expected, counts)
+		}
+	}
+	if n := atomic.LoadInt32(&connCount); n != 1 {
+		t.Errorf("expecting 1 connection, got %d", n)
+	}
+}
+
+func TestWsConnectionSlowSubscriber(t *testing.T) {
+	const updates = 400
+	upgrader := websocket.Upgrader{}
+	more := make(chan struct{})
+	// the server sends the trades updates before acknowledging the markets subscription,
+	// and one more trades update after more is closed.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 2; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+		trade := `{"type":"channel_data","channel":"v3_trades","id":"BTC-USD","contents":{"trades":[]}}`
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","contents":{"trades":[]}}`))
+		for i := 0; i < updates; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(trade))
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_markets","contents":{}}`))
+		<-more
+		conn.WriteMessage(websocket.TextMessage, []byte(trade))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// nobody reads the trades until the markets subscription is acknowledged.
+	trades := make(chan *dydx.TradesChannelResponse)
+	go conn.SubscribeTrades(ctx, "BTC-USD", trades)
+	time.Sleep(10 * time.Millisecond)
+	markets := make(chan *dydx.MarketsChannelResponse)
+	go conn.SubscribeMarkets(ctx, markets)
+	select {
+	case <-markets:
+	case <-ctx.Done():
+		t.Fatalf("markets subscription is blocked by the slow trades subscription")
+	}
+
+	close(more)
+	received := 0
+	var gap *dydx.TradesChannelResponse
+	for received < updates+1 {
+		var v *dydx.TradesChannelResponse
+		select {
+		case v = <-trades:
+		case <-ctx.Done():
+			t.Fatalf("timed out, received %d updates", received)
+		}
+		if v.Type == dydx.ChannelResponseTypeChannelData || v.Type == dydx.ChannelResponseTypeSubscribe {
+			received++
+		}
+		if v.Type == dydx.ChannelResponseTypeGap {
+			gap = v
+			break
+		}
+	}
+	if gap == nil {
+		t.Fatalf("expecting a gap after the dropped updates, received %d", received)
+	}
+	if v := <-trades; v.Type != dydx.ChannelResponseTypeChannelData {
+		t.Fatalf("expecting the update after the gap, got %s", v.Type)
+	}
+}
+
+func TestWsConnectionSharedSubscription(t *testing.T) {
+	var connCount int32
+	server := newEchoWsServer(t, &connCount)
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subscribe := func(ctx context.Context) (chan *dydx.TradesChannelResponse, chan error) {
+		outputs := make(chan *dydx.TradesChannelResponse, 16)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- conn.SubscribeTrades(ctx, "BTC-USD", outputs)
+		}()
+		return outputs, errChan
+	}
+	receive := func(outputs chan *dydx.TradesChannelResponse, expected ...string) {
+		t.Helper()
+		var types []string
+		for len(types) < len(expected) {
+			select {
+			case v := <-outputs:
+				types = append(types, v.Type)
+			case <-ctx.Done():
+				t.Fatalf("timed out, received %v", types)
+			}
+		}
+		if fmt.Sprint(types) != fmt.Sprint(expected) {
+			t.Fatalf("expecting %v, got %v", expected, types)
+		}
+	}
+
+	first, firstErr := subscribe(ctx)
+	receive(first, dydx.ChannelResponseTypeSubscribe, dydx.ChannelResponseTypeChannelData)
+
+	// the second subscriber gets its own subscribed message, and the first one is told to reset.
+	second_ctx, second_cancel := context.WithCancel(ctx)
+	second, secondErr := subscribe(second_ctx)
+	receive(second, dydx.ChannelResponseTypeSubscribe, dydx.ChannelResponseTypeChannelData)
+	receive(first, dydx.ChannelResponseTypeReconnected, dydx.ChannelResponseTypeSubscribe, dydx.ChannelResponseTypeChannelData)
+
+	second_cancel()
+	if err := <-secondErr; err != nil {
+		t.Fatalf("second subscription failed: %v", err)
+	}
+	select {
+	case err := <-firstErr:
+		t.Fatalf("first subscription ended with the second one: %v", err)
+	default:
+	}
+	cancel()
+	if err := <-firstErr; err != nil {
+		t.Fatalf("first subscription failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&connCount); n != 1 {
+		t.Errorf("expecting 1 connection, got %d", n)
+	}
+}
+
+func TestWsConnectionAccountAck(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	// the server acknowledges the second account before the first one.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 2; i++ {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_accounts","id":"account-1","contents":{"account":{"accountNumber":"1"}}}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_accounts","id":"account-0","contents":{"account":{"accountNumber":"0"}}}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"channel_data","channel":"v3_accounts","id":"account-0","contents":{"orders":[]}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	apiKey := dydx.NewApiKey("key", "passphrase", "c2VjcmV0")
+	outputs := make(map[int]chan *dydx.AccountChannelResponse)
+	for _, accountNumber := range []int{0, 1} {
+		outputs[accountNumber] = make(chan *dydx.AccountChannelResponse, 16)
+		go conn.SubscribeAccount(ctx, apiKey, accountNumber, outputs[accountNumber])
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for accountNumber, expected := range map[int][]string{
+		0: {"account-0", "account-0"},
+		1: {"account-1"},
+	} {
+		for _, id := range expected {
+			select {
+			case v := <-outputs[accountNumber]:
+				if v.Id != id {
+					t.Fatalf("account %d received message of %s", accountNumber, v.Id)
+				}
+			case <-ctx.Done():
+				t.Fatalf("timed out waiting for account %d", accountNumber)
+			}
+		}
+	}
+}
+
+func TestWsConnectionReadTimeout(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	block := make(chan struct{})
+	defer close(block)
+	// the server acknowledges the subscription and stops reading, so pings are not answered.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_markets","contents":{}}`))
+		<-block
+	}))
+	defer server.Close()
+
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil, dydx.SetWsKeepAlive(20*time.Millisecond, 100*time.Millisecond))
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(chan *dydx.MarketsChannelResponse, 16)
+	if err := conn.SubscribeMarkets(ctx, outputs); !errors.Is(err, dydx.ErrWsReadTimeout) {
+		t.Fatalf("expecting read timeout, got %v", err)
+	}
+}
+
+func TestSubscriptionStaleTimeout(t *testing.T) {
+	var connCount int32
+	server := newEchoWsServer(t, &connCount)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the stale subscription is renewed on the same connection.
+	conn := dydx.NewWsConnection(getTestWsUrl(server), nil)
+	defer conn.Close()
+	sub_ctx, sub_cancel := context.WithCancel(ctx)
+	defer sub_cancel()
+	outputs := make(chan *dydx.TradesChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- conn.SubscribeTrades(sub_ctx, "BTC-USD", outputs, dydx.SetSubscriptionStaleTimeout(100*time.Millisecond))
+	}()
+	var types []string
+	for v := range outputs {
+		types = append(types, v.Type)
+		if len(types) == 5 {
+			break
+		}
+	}
+	sub_cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+	expected := fmt.Sprint([]string{
+		dydx.ChannelResponseTypeSubscribe,
+		dydx.ChannelResponseTypeChannelData,
+		dydx.ChannelResponseTypeStale,
+		dydx.ChannelResponseTypeReconnected,
+		dydx.ChannelResponseTypeSubscribe,
+	})
+	if fmt.Sprint(types) != expected {
+		t.Fatalf("expecting %s, got %v", expected, types)
+	}
+	if n := atomic.LoadInt32(&connCount); n != 1 {
+		t.Fatalf("expecting 1 connection, got %d", n)
+	}
+
+	// the server doesn't respond to the renewal, and the subscription returns after the second stale event.
+	upgrader := websocket.Upgrader{}
+	silent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","contents":{"trades":[]}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer silent.Close()
+
+	silentConn := dydx.NewWsConnection(getTestWsUrl(silent), nil)
+	defer silentConn.Close()
+	silentOutputs := make(chan *dydx.TradesChannelResponse, 16)
+	if err := silentConn.SubscribeTrades(ctx, "BTC-USD", silentOutputs, dydx.SetSubscriptionStaleTimeout(100*time.Millisecond)); !errors.Is(err, dydx.ErrSubscriptionStale) {
+		t.Fatalf("expecting stale error, got %v", err)
+	}
+	close(silentOutputs)
+	types = nil
+	for v := range silentOutputs {
+		types = append(types, v.Type)
+	}
+	expected = fmt.Sprint([]string{dydx.ChannelResponseTypeSubscribe, dydx.ChannelResponseTypeStale, dydx.ChannelResponseTypeStale})
+	if fmt.Sprint(types) != expected {
+		t.Fatalf("expecting %s, got %v", expected, types)
+	}
+}
+
+func TestSubscribeOrderbookResync(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/orderbook/BTC-USD", func(w http.ResponseWriter, r *http.Request) {
+		// make sure the updates after the gap are buffered.
+		time.Sleep(50 * time.Millisecond)
+		// the rest api snapshot has no offset, it includes the missing update but not the one at offset 13.
+		w.Write([]byte(`{"bids":[{"price":"100","size":"1"},{"price":"99","size":"1"},{"price":"98","size":"3"}],"asks":[]}`))
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+		for _, msg := range []string{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"10","bids":[{"price":"100","size":"1"}],"asks":[]}}`,
+			`{"type":"channel_data","channel":"v3_orderbook","id":"BTC-USD","message_id":2,"contents":{"offset":"11","bids":[["99","1"]],"asks":[]}}`,
+			// message id 3 at offset 12 is missing.
+			`{"type":"channel_data","channel":"v3_orderbook","id":"BTC-USD","message_id":4,"contents":{"offset":"13","bids":[["98","1"]],"asks":[]}}`,
+			`{"type":"channel_data","channel":"v3_orderbook","id":"BTC-USD","message_id":5,"contents":{"offset":"15","bids":[["97","1"]],"asks":[]}}`,
+		} {
+			conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientRpcUrl(server.URL), dydx.SetClientWsUrl(getTestWsUrl(server)+"/ws"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(chan *dydx.OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- client.SubscribeOrderbook(ctx, "BTC-USD", outputs)
+	}()
+
+	ob := dydx.NewOrderbookProcessor("BTC-USD", true)
+	var types []string
+	var resync *dydx.OrderbookChannelResponse
+	for len(types) < 6 {
+		v := <-outputs
+		types = append(types, v.Type)
+		if v.Type == dydx.ChannelResponseTypeResync {
+			resync = v
+		}
+		ob.Process(v)
+	}
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+
+	expected := fmt.Sprint([]string{
+		dydx.ChannelResponseTypeSubscribe,
+		dydx.ChannelResponseTypeChannelData,
+		dydx.ChannelResponseTypeGap,
+		dydx.ChannelResponseTypeResync,
+		dydx.ChannelResponseTypeChannelData,
+		dydx.ChannelResponseTypeChannelData,
+	})
+	if fmt.Sprint(types) != expected {
+		t.Fatalf("expecting %s, got %v", expected, types)
+	}
+	// the snapshot includes the updates up to the last one before the gap.
+	if offset := resync.Contents.Offset; offset == nil || *offset != 11 {
+		t.Fatalf("expecting the snapshot at offset 11, got %v", offset)
+	}
+	// 98 @ 3 from the snapshot is overwritten by the buffered update, and 97 is added.
+	if got := ob.Bids.PrintBook(); ob.Bids.Len() != 4 || !strings.Contains(got, "98 @ $1") || !strings.Contains(got, "97 @ $1") {
+		t.Fatalf("expecting 100, 99, 98 @ 1, 97 @ 1, got %s", got)
+	}
+}
+
+func TestSubscribeOrderbookBatched(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	requests := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"connected","connection_id":"c"}`))
+		var request map[string]any
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		requests <- request
+		for _, msg := range []string{
+			`{"type":"subscribed","channel":"v3_orderbook","id":"BTC-USD","message_id":1,"contents":{"offset":"10","bids":[{"price":"100","size":"1"}],"asks":[{"price":"101","size":"1"}]}}`,
+			`{"type":"channel_batch_data","channel":"v3_orderbook","id":"BTC-USD","message_id":2,"contents":[{"offset":"11","bids":[["99","2"]],"asks":[]},{"offset":"12","bids":[["100","0"]],"asks":[["101","3"]]}]}`,
+		} {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	outputs := make(chan *dydx.OrderbookChannelResponse)
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(outputs)
+		errChan <- client.SubscribeOrderbook(ctx, "BTC-USD", outputs, dydx.SetSubscriptionBatched(true))
+	}()
+
+	ob := dydx.NewOrderbookProcessor("BTC-USD", false)
+	for v := range outputs {
+		ob.Process(v)
+		if v.Type == dydx.ChannelResponseTypeChannelBatchData {
+			if len(v.BatchContents) != 2 || v.Contents != nil {
+				t.Errorf("unexpected batch contents: %#v", v)
+			}
+			cancel()
+		}
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("subscription failed: %v", err)
+	}
+
+	request := <-requests
+	if request["batched"] != true || request["includeOffsets"] != true {
+		t.Fatalf("batched and includeOffsets are not set in the request: %v", request)
+	}
+
+	bid, ask := ob.BookTop()
+	if ob.Bids.Len() != 1 || bid.PriceString != "99" || ask.PriceString != "101" || ask.Size.String() != "3" {
+		t.Fatalf("batch is not applied in order: bids %s asks %s", ob.Bids.PrintBook(), ob.Asks.PrintBook())
+	}
+
+	// the recorded data can be parsed back.
+	data, err := json.Marshal(ob.Data())
+	if err != nil {
+		t.Fatalf("failed to marshal data: %v", err)
+	}
+	var parsed []*dydx.OrderbookChannelResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to unmarshal data: %v", err)
+	}
+	if len(parsed) != 2 || parsed[0].Contents == nil || len(parsed[1].BatchContents) != 2 || *parsed[1].BatchContents[1].Offset != 12 {
+		t.Fatalf("failed to round trip data: %s", data)
+	}
+}
+
+func TestSubscribeWithHandler(t *testing.T) {
+	server := newScriptedWsServer(t, [][]string{
+		{
+			`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","message_id":1,"contents":{"trades":[]}}`,
+			`{"type":"channel_data","channel":"v3_trades","id":"BTC-USD","message_id":2,"contents":{"trades":[{"side":"BUY","size":"1","price":"100","createdAt":"2022-10-01T00:00:00.000Z"}]}}`,
+		},
+		{
+			`{"type":"subscribed","channel":"v3_trades","id":"BTC-USD","message_id":1,"contents":{"trades":[]}}`,
+		},
+	})
+	defer server.Close()
+
+	policy := &dydx.ReconnectPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 100 * time.Millisecond, Multiplier: 2, MaxAttempts: 3}
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)), dydx.SetClientReconnectPolicy(policy))
+
+	var mu sync.Mutex
+	var calls []string
+	resubscribed := make(chan struct{})
+	handler := &dydx.SubscriptionHandlerFuncs[dydx.TradesChannelResponseContents]{
+		Subscribed: func(*dydx.TradesChannelResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "subscribed")
+			if len(calls) > 1 {
+				close(resubscribed)
+			}
+		},
+		Data: func(*dydx.TradesChannelResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "data")
+		},
+		Reconnect: func(*dydx.TradesChannelResponse) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, "reconnect")
+		},
+		Error: func(err error) {
+			t.Errorf("unexpected error: %v", err)
+		},
+	}
+
+	sub, err := client.SubscribeTradesWithHandler(context.Background(), "BTC-USD", handler)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if sub.Stats().SubscribedAt.IsZero() {
+		t.Fatalf("subscription returned before the subscribed message")
+	}
+
+	select {
+	case <-resubscribed:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("failed to resubscribe")
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatalf("subscription is not done after close")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(calls, ",") != "subscribed,data,reconnect,subscribed" {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+	if stats := sub.Stats(); stats.Messages != 4 || stats.Reconnects != 1 {
+		t.Fatalf("unexpected stats: %#v", stats)
+	}
+}
+
+func TestSubscribeWithHandlerError(t *testing.T) {
+	server := newScriptedWsServer(t, [][]string{
+		{`{"type":"error","message":"Invalid subscription id for channel","channel":"v3_trades","id":"FOO-USD","message_id":1}`},
+	})
+	defer server.Close()
+
+	client, _ := dydx.NewClient(nil, nil, "", false, dydx.SetClientWsUrl(getTestWsUrl(server)))
+
+	_, err := client.SubscribeTradesWithHandler(context.Background(), "FOO-USD", &dydx.SubscriptionHandlerFuncs[dydx.TradesChannelResponseContents]{})
+	var channelErr *dydx.ChannelError
+	if !errors.As(err, &channelErr) {
+		t.Fatalf("expecting channel error, got %v", err)
+	}
+}
@@ -0,0 +1,886 @@
+package dydx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrWsConnectionClosed is returned by the subscriptions when the WsConnection is closed.
+var ErrWsConnectionClosed = errors.New("websocket connection is closed")
+
+// wsSubscriptionBufferSize is the number of data messages buffered for each subscription with SubscriptionOverflowGap.
+const wsSubscriptionBufferSize = 256
+
+// SubscriptionOverflowPolicy is how the messages are handled when the subscriber doesn't keep up with them.
+// The connection never waits for a subscriber, so a slow subscriber doesn't hold up the other subscriptions of the connection.
+type SubscriptionOverflowPolicy int
+
+const (
+	// SubscriptionOverflowGap drops the data messages after the buffer of the subscription is full. After the subscriber
+	// catches up, a message of type ChannelResponseTypeGap is sent before the next message, which resyncs the orderbook
+	// subscriptions of Client.SubscribeOrderbook. This is the default.
+	SubscriptionOverflowGap SubscriptionOverflowPolicy = iota
+	// SubscriptionOverflowQueue queues the messages without a limit.
+	SubscriptionOverflowQueue
+)
+
+func (p SubscriptionOverflowPolicy) String() string {
+	switch p {
+	case SubscriptionOverflowGap:
+		return "gap"
+	case SubscriptionOverflowQueue:
+		return "queue"
+	default:
+		return fmt.Sprintf("SubscriptionOverflowPolicy(%d)", int(p))
+	}
+}
+
+// WsConnection owns one websocket connection to dydx and multiplexes subscriptions to many channels and markets on it.
+//
+// The connection is dialed when the first subscription is added, and closed after the last subscription is removed.
+// Subscriptions are keyed by channel and id (market for orderbook and trades), and the messages are routed to the
+// subscription with the same channel and id. The subscriptions to the same channel and id share one subscription on the server,
+// and each of them receives all the messages. Since the subscribed message is the only snapshot of the channel, the shared subscription
+// is renewed when a subscriber joins after it is acknowledged, and the other subscribers receive ChannelResponseTypeReconnected
+// before the new subscribed message. The options of the first subscription (for example SetSubscriptionBatched) are used for the request.
+//
+// If the reconnect policy is not nil, the connection is redialed after it is lost, and all the subscriptions are
+// sent again. See ReconnectPolicy.
+type WsConnection struct {
+	url    string
+	policy *ReconnectPolicy
+
+	pingInterval time.Duration
+	readTimeout  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// writeMutex serializes the writes to the connection, and must be locked before mutex if both are needed.
+	writeMutex sync.Mutex
+
+	mutex   sync.Mutex
+	running bool
+	// idleClosed is set when the connection is closed after the last subscription is removed.
+	idleClosed   bool
+	conn         *websocket.Conn
+	connectionID string
+	nextSeq      int64
+	subs         map[wsSubscriptionKey]*wsSubscription
+	// pending are the subscriptions waiting for the subscribed message, in the order of the requests.
+	pending []*wsSubscription
+	// closeReason is set when the connection is closed by forceReconnect.
+	closeReason error
+}
+
+type wsSubscriptionKey struct {
+	channel string
+	id      string
+}
+
+// wsEvent is a message for a subscription. data is nil for synthetic messages.
+type wsEvent struct {
+	header     ChannelResponseHeader
+	data       []byte
+	receivedAt time.Time
+}
+
+// wsEventQueue contains the events not taken by the subscriber yet. Adding to the queue never blocks.
+type wsEventQueue struct {
+	policy SubscriptionOverflowPolicy
+
+	mutex  sync.Mutex
+	events []*wsEvent
+	// dropped is the number of the data messages dropped since the last gap.
+	dropped int
+	// ready is signaled after events are added.
+	ready chan struct{}
+}
+
+func newWsEventQueue(policy SubscriptionOverflowPolicy) *wsEventQueue {
+	return &wsEventQueue{policy: policy, ready: make(chan struct{}, 1)}
+}
+
+// add adds the event to the queue, or drops it if the queue is full.
+// Only the data messages are dropped, the subscribed, error and synthetic messages are always added.
+func (q *wsEventQueue) add(event *wsEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	isData := event.header.Type == ChannelResponseTypeChannelData || event.header.Type == ChannelResponseTypeChannelBatchData
+	if isData && q.policy == SubscriptionOverflowGap && len(q.events) >= wsSubscriptionBufferSize {
+		q.dropped++
+		return
+	}
+	if q.dropped > 0 {
+		header := event.header
+		header.Type = ChannelResponseTypeGap
+		header.Message = fmt.Sprintf("%d messages are dropped since the subscriber is slow", q.dropped)
+		q.events = append(q.events, &wsEvent{header: header, receivedAt: event.receivedAt})
+		q.dropped = 0
+	}
+	q.events = append(q.events, event)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns the first event in the queue, false if the queue is empty.
+func (q *wsEventQueue) next() (*wsEvent, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.events) == 0 {
+		return nil, false
+	}
+	event := q.events[0]
+	q.events[0] = nil
+	q.events = q.events[1:]
+	return event, true
+}
+
+// wsSubscription is a subscription on the server shared by the subscribers to the same channel and id.
+type wsSubscription struct {
+	seq int64
+	// key is the channel and id of the messages, and request is the channel and id of the request.
+	// They are different for the account channel, which responds with the account id.
+	key        wsSubscriptionKey
+	request    wsSubscriptionKey
+	newRequest func() any
+	// matchSubscribed tells if a subscribed message with an id different from the request is for the subscription. nil if the
+	// subscribed message always has the id of the request.
+	matchSubscribed func(msg []byte) bool
+
+	// acked is set after the subscribed message is received on the current connection.
+	acked bool
+	// lastMessageID is the message id of the last message of the subscription on the current connection.
+	lastMessageID int
+
+	// subscribers receive the messages of the subscription. The subscription is removed after the last subscriber leaves.
+	subscribers []*wsSubscriber
+}
+
+// finish ends all the subscribers with the error.
+func (s *wsSubscription) finish(err error) {
+	for _, v := range s.subscribers {
+		v.finish(err)
+	}
+}
+
+// wsSubscriber is one of the subscribers of a subscription.
+type wsSubscriber struct {
+	sub *wsSubscription
+	// channel and id are of the request, for logging.
+	channel string
+	id      string
+	// started is set after the subscriber receives a subscribed message.
+	started bool
+	// recorder receives the frames before they are queued, see SetSubscriptionRecorder.
+	recorder io.Writer
+
+	queue    *wsEventQueue
+	done     chan struct{}
+	doneOnce sync.Once
+	err      error
+}
+
+func (s *wsSubscriber) finish(err error) {
+	s.doneOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+// NewWsConnection creates a connection to the websocket url, which is dialed when the first subscription is added.
+// policy can be nil to disable reconnect.
+// The connection is kept alive with DefaultWsPingInterval and DefaultWsReadTimeout unless changed by SetWsKeepAlive.
+func NewWsConnection(url string, policy *ReconnectPolicy, options ...wsConnectionOption) *WsConnection {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &WsConnection{
+		url:          url,
+		policy:       policy,
+		pingInterval: DefaultWsPingInterval,
+		readTimeout:  DefaultWsReadTimeout,
+		ctx:          ctx,
+		cancel:       cancel,
+		subs:         make(map[wsSubscriptionKey]*wsSubscription),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// Close closes the connection and ends all the subscriptions with ErrWsConnectionClosed.
+func (w *WsConnection) Close() {
+	w.cancel()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for key, sub := range w.subs {
+		sub.finish(ErrWsConnectionClosed)
+		delete(w.subs, key)
+	}
+	w.pending = nil
+	if w.conn != nil {
+		w.conn.Close()
+	}
+}
+
+// forceReconnect closes the current connection with the reason, which will be reconnected by the reconnect policy.
+// Returns false if the connection doesn't have a reconnect policy.
+func (w *WsConnection) forceReconnect(reason error) bool {
+	if w.policy == nil {
+		return false
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn != nil {
+		w.closeReason = reason
+		w.conn.Close()
+	}
+	return true
+}
+
+// ConnectionID returns the connection id from the connected message of the current connection.
+func (w *WsConnection) ConnectionID() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.connectionID
+}
+
+// addSubscriber adds a subscriber to the subscription of the channel and id, and creates the subscription if there is none.
+// The connection is started if it is not running, and the subscribe request is sent if the connection is established.
+func (w *WsConnection) addSubscriber(channel, id string, newRequest func() any, matchSubscribed func([]byte) bool, cfg *subscriptionConfig) (*wsSubscriber, error) {
+	if w.ctx.Err() != nil {
+		return nil, ErrWsConnectionClosed
+	}
+
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	w.mutex.Lock()
+	request := wsSubscriptionKey{channel: channel, id: id}
+	var requests []any
+	sub := w.findSubscription(request)
+	switch {
+	case sub == nil:
+		w.nextSeq++
+		sub = &wsSubscription{
+			seq:             w.nextSeq,
+			key:             request,
+			request:         request,
+			newRequest:      newRequest,
+			matchSubscribed: matchSubscribed,
+		}
+		w.subs[request] = sub
+		if !w.running {
+			w.running = true
+			go w.run()
+		}
+		if w.conn != nil {
+			w.pending = append(w.pending, sub)
+			requests = append(requests, newRequest())
+		}
+	case sub.acked && w.conn != nil:
+		// renew the subscription for the snapshot in the subscribed message.
+		requests = w.renew(sub)
+	}
+
+	subscriber := &wsSubscriber{
+		sub:      sub,
+		channel:  channel,
+		id:       id,
+		recorder: cfg.recorder,
+		queue:    newWsEventQueue(cfg.overflowPolicy),
+		done:     make(chan struct{}),
+	}
+	sub.subscribers = append(sub.subscribers, subscriber)
+	conn := w.conn
+	w.mutex.Unlock()
+
+	for _, request := range requests {
+		if err := conn.WriteJSON(request); err != nil {
+			// the reader will fail and the request will be sent again after reconnect.
+			log.Warnf("failed to write request %#v: %v", request, err)
+			break
+		}
+	}
+
+	return subscriber, nil
+}
+
+// renewSubscription sends the unsubscribe and subscribe requests of the subscription if it is acknowledged,
+// and the subscribers receive ChannelResponseTypeReconnected before the new subscribed message.
+// Returns false if the connection is not established.
+func (w *WsConnection) renewSubscription(sub *wsSubscription) bool {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	w.mutex.Lock()
+	conn := w.conn
+	if conn == nil || w.subs[sub.key] != sub {
+		w.mutex.Unlock()
+		return false
+	}
+	var requests []any
+	// otherwise the subscribe request is already sent.
+	if sub.acked {
+		requests = w.renew(sub)
+	}
+	w.mutex.Unlock()
+
+	for _, request := range requests {
+		if err := conn.WriteJSON(request); err != nil {
+			log.Warnf("failed to write request %#v: %v", request, err)
+			break
+		}
+	}
+	return true
+}
+
+// renew marks the subscription as pending and returns the requests to renew it. mutex must be held.
+func (w *WsConnection) renew(sub *wsSubscription) []any {
+	sub.acked = false
+	w.pending = append(w.pending, sub)
+	return []any{newUnsubscribeRequest(sub.key.channel, sub.key.id), sub.newRequest()}
+}
+
+// findSubscription returns the subscription of the request, nil if there is none. mutex must be held.
+func (w *WsConnection) findSubscription(request wsSubscriptionKey) *wsSubscription {
+	if sub, ok := w.subs[request]; ok && sub.request == request {
+		return sub
+	}
+	for _, sub := range w.subs {
+		if sub.request == request {
+			return sub
+		}
+	}
+	return nil
+}
+
+// removeSubscriber removes the subscriber. After the last subscriber is removed, the subscription is removed and
+// the unsubscribe request is sent if the subscription is acknowledged. The connection is closed if there are no more subscriptions.
+func (w *WsConnection) removeSubscriber(subscriber *wsSubscriber) {
+	subscriber.finish(nil)
+
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	w.mutex.Lock()
+	sub := subscriber.sub
+	for i, v := range sub.subscribers {
+		if v == subscriber {
+			sub.subscribers = append(sub.subscribers[:i], sub.subscribers[i+1:]...)
+			break
+		}
+	}
+	if len(sub.subscribers) > 0 || w.subs[sub.key] != sub {
+		w.mutex.Unlock()
+		return
+	}
+	delete(w.subs, sub.key)
+	w.removePending(sub)
+	conn := w.conn
+	acked := sub.acked
+	idle := len(w.subs) == 0
+	w.mutex.Unlock()
+
+	if conn == nil {
+		return
+	}
+	if acked {
+		if err := conn.WriteJSON(newUnsubscribeRequest(sub.key.channel, sub.key.id)); err != nil {
+			log.Warnf("failed to write unsubscribe request for %s %s: %v", sub.key.channel, sub.key.id, err)
+		}
+	}
+	if idle {
+		w.mutex.Lock()
+		w.conn = nil
+		w.idleClosed = true
+		w.mutex.Unlock()
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second*2))
+		conn.Close()
+	}
+}
+
+// removePending removes the subscription from the pending list. mutex must be held.
+func (w *WsConnection) removePending(sub *wsSubscription) {
+	for i, v := range w.pending {
+		if v == sub {
+			w.pending = append(w.pending[:i], w.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// run dials the connection and reads the messages, and reconnects according to the policy.
+// It returns when there are no subscriptions, the connection is closed, or the reconnect policy is exhausted.
+func (w *WsConnection) run() {
+	attempt := 0
+	for {
+		subscribed, err := w.serve()
+
+		w.mutex.Lock()
+		if w.closeReason != nil {
+			err = w.closeReason
+			w.closeReason = nil
+		}
+		w.conn = nil
+		w.pending = nil
+		for _, sub := range w.subs {
+			sub.acked = false
+		}
+
+		if len(w.subs) == 0 || w.ctx.Err() != nil {
+			w.running = false
+			w.idleClosed = false
+			w.mutex.Unlock()
+			return
+		}
+
+		// subscriptions are added after the connection is closed for being idle, dial again right away.
+		if w.idleClosed {
+			w.idleClosed = false
+			attempt = 0
+			w.mutex.Unlock()
+			continue
+		}
+
+		if subscribed {
+			attempt = 0
+		}
+		attempt++
+
+		if w.policy == nil || w.policy.isExhausted(attempt) {
+			if w.policy != nil {
+				err = fmt.Errorf("failed to reconnect to %s after %d attempts: %w", w.url, w.policy.MaxAttempts, err)
+			}
+			for key, sub := range w.subs {
+				sub.finish(err)
+				delete(w.subs, key)
+			}
+			w.running = false
+			w.mutex.Unlock()
+			return
+		}
+		w.mutex.Unlock()
+
+		backoff := w.policy.getBackoff(attempt)
+		log.Warnf("websocket connection to %s is disconnected (%v), reconnecting in %s (attempt %d)", w.url, err, backoff, attempt)
+		select {
+		case <-w.ctx.Done():
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// serve dials the connection, sends the subscribe requests and reads until the connection is lost.
+// The returned bool indicates if any subscription is acknowledged on the connection.
+func (w *WsConnection) serve() (bool, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 60 * time.Second,
+	}
+
+	conn, rsp, err := dialer.DialContext(w.ctx, w.url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to websocket %s: %w\nresponse is %#v", w.url, err, rsp)
+	}
+	defer conn.Close()
+
+	if w.readTimeout > 0 {
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(w.readTimeout))
+		})
+	}
+
+	if w.pingInterval > 0 {
+		ping_ctx, cancel := context.WithCancel(w.ctx)
+		defer cancel()
+		go w.loopPing(ping_ctx, conn)
+	}
+
+	if err := w.resubscribe(conn); err != nil {
+		return false, err
+	}
+
+	subscribed := false
+	for {
+		if w.readTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(w.readTimeout))
+		}
+		_, msg, err := conn.ReadMessage()
+		receivedAt := time.Now()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) || errors.Is(err, websocket.ErrCloseSent) {
+				return subscribed, nil
+			}
+			if isTimeoutError(err) {
+				return subscribed, fmt.Errorf("%w: nothing received in %s", ErrWsReadTimeout, w.readTimeout)
+			}
+			return subscribed, err
+		}
+
+		log.Debugf("message received from websocket: %s", string(msg))
+
+		if w.route(conn, msg, receivedAt) {
+			subscribed = true
+		}
+	}
+}
+
+// loopPing sends pings to the connection until the context is cancelled.
+func (w *WsConnection) loopPing(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(w.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// WriteControl can be called concurrently with other writes.
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(w.pingInterval)); err != nil {
+				log.Debugf("failed to write ping: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// resubscribe sets the connection as current and sends the subscribe requests of all the subscriptions.
+func (w *WsConnection) resubscribe(conn *websocket.Conn) error {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	w.mutex.Lock()
+	if w.ctx.Err() != nil {
+		w.mutex.Unlock()
+		return ErrWsConnectionClosed
+	}
+	w.conn = conn
+	w.connectionID = ""
+	subs := make([]*wsSubscription, 0, len(w.subs))
+	for _, sub := range w.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].seq < subs[j].seq })
+	w.pending = append(w.pending[:0], subs...)
+	w.mutex.Unlock()
+
+	for _, sub := range subs {
+		request := sub.newRequest()
+		if err := conn.WriteJSON(request); err != nil {
+			return fmt.Errorf("failed to write subscribe request %#v: %w", request, err)
+		}
+	}
+
+	return nil
+}
+
+// route sends the message to the subscribers. Returns true if the message is a subscribed message for a subscription.
+func (w *WsConnection) route(conn *websocket.Conn, msg []byte, receivedAt time.Time) bool {
+	var header ChannelResponseHeader
+	if err := json.Unmarshal(msg, &header); err != nil {
+		log.Warnf("failed to parse data: %v", err)
+		return false
+	}
+
+	var sub *wsSubscription
+	// reconnected are the subscribers receiving the subscribed message again.
+	var reconnected []*wsSubscriber
+	// recordOnly are the subscribers of the message dropped during the renewal, which is only recorded.
+	var recordOnly []*wsSubscriber
+
+	// gapMessage is set when the message ids of the subscription are not sequential.
+	var gapMessage string
+
+	w.mutex.Lock()
+	switch header.Type {
+	case ChannelResponseTypeConnected:
+		w.connectionID = header.ConnectionID
+	case ChannelResponseTypeUnsubscribe:
+		// the unsubscribe requests are sent after the subscription is removed, or before it is renewed.
+	case ChannelResponseTypeSubscribe:
+		sub = w.ackSubscription(header.Channel, header.Id, msg)
+		if sub != nil {
+			sub.lastMessageID = header.MessageID
+			for _, v := range sub.subscribers {
+				if v.started {
+					reconnected = append(reconnected, v)
+				}
+				v.started = true
+			}
+		}
+	case ChannelResponseTypeError:
+		sub = w.subs[wsSubscriptionKey{channel: header.Channel, id: header.Id}]
+		// error for the subscribe request doesn't contain channel and id.
+		if sub == nil && len(w.pending) > 0 {
+			sub = w.pending[0]
+			w.pending = w.pending[1:]
+		}
+	default:
+		sub = w.subs[wsSubscriptionKey{channel: header.Channel, id: header.Id}]
+		// the updates of a renewed subscription are dropped until the subscribed message.
+		if sub != nil && !sub.acked {
+			recordOnly = append(recordOnly, sub.subscribers...)
+			sub = nil
+		}
+		// the message ids increase by 1 for each message of the channel and id on the connection.
+		if sub != nil && header.MessageID > 0 {
+			if sub.lastMessageID > 0 && header.MessageID != sub.lastMessageID+1 {
+				gapMessage = fmt.Sprintf("expecting message id %d, got %d", sub.lastMessageID+1, header.MessageID)
+				log.Warnf("message id gap of %s %s on connection %s: %s", header.Channel, header.Id, w.connectionID, gapMessage)
+			}
+			sub.lastMessageID = header.MessageID
+		}
+	}
+	var subscribers []*wsSubscriber
+	if sub != nil {
+		subscribers = append(subscribers, sub.subscribers...)
+	}
+	w.mutex.Unlock()
+
+	for _, v := range recordOnly {
+		v.record(&wsEvent{header: header, data: msg, receivedAt: receivedAt})
+	}
+
+	if sub == nil {
+		switch header.Type {
+		case ChannelResponseTypeConnected, ChannelResponseTypeUnsubscribe:
+		case ChannelResponseTypeSubscribe:
+			// the subscription is removed before the subscribed message arrives.
+			w.writeJSON(conn, newUnsubscribeRequest(header.Channel, header.Id))
+		default:
+			log.Debugf("no acknowledged subscription for message %s %s %s", header.Type, header.Channel, header.Id)
+		}
+		return false
+	}
+
+	for _, v := range reconnected {
+		v.deliver(&wsEvent{
+			header: ChannelResponseHeader{
+				Type:         ChannelResponseTypeReconnected,
+				Channel:      header.Channel,
+				ConnectionID: header.ConnectionID,
+				Id:           header.Id,
+			},
+			receivedAt: receivedAt,
+		})
+	}
+	for _, v := range subscribers {
+		if gapMessage != "" {
+			v.deliver(&wsEvent{
+				header: ChannelResponseHeader{
+					Type:         ChannelResponseTypeGap,
+					Channel:      header.Channel,
+					ConnectionID: header.ConnectionID,
+					MessageID:    header.MessageID,
+					Message:      gapMessage,
+					Id:           header.Id,
+				},
+				receivedAt: receivedAt,
+			})
+		}
+		v.deliver(&wsEvent{header: header, data: msg, receivedAt: receivedAt})
+	}
+
+	return header.Type == ChannelResponseTypeSubscribe
+}
+
+// ackSubscription marks the subscription as acknowledged. mutex must be held.
+// The id in the subscribed message may be different from the request (the account channel responds with the account id).
+// Such a message is matched to the pending subscription by matchSubscribed, and the subscription is re-keyed to the id in the message.
+func (w *WsConnection) ackSubscription(channel, id string, msg []byte) *wsSubscription {
+	key := wsSubscriptionKey{channel: channel, id: id}
+	sub, ok := w.subs[key]
+	if !ok {
+		for _, v := range w.pending {
+			if v.key.channel == channel && v.matchSubscribed != nil && v.matchSubscribed(msg) {
+				sub = v
+				break
+			}
+		}
+		if sub == nil {
+			return nil
+		}
+		delete(w.subs, sub.key)
+		sub.key = key
+		w.subs[key] = sub
+	}
+	w.removePending(sub)
+	sub.acked = true
+	return sub
+}
+
+// deliver records the event and adds it to the queue of the subscriber without blocking.
+// The event is recorded even if it is dropped by the queue later.
+func (s *wsSubscriber) deliver(event *wsEvent) {
+	s.record(event)
+	s.queue.add(event)
+}
+
+// record writes the event to the recorder of the subscriber if there is one.
+func (s *wsSubscriber) record(event *wsEvent) {
+	if s.recorder == nil {
+		return
+	}
+	if err := recordWsEvent(s.recorder, event); err != nil {
+		log.Warnf("failed to record data for %s %s: %v", s.channel, s.id, err)
+	}
+}
+
+func (w *WsConnection) writeJSON(conn *websocket.Conn, v any) {
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+	if err := conn.WriteJSON(v); err != nil {
+		log.Warnf("failed to write %#v: %v", v, err)
+	}
+}
+
+// getWsConnection returns the connection shared by all the subscriptions of the client.
+func (c *Client) getWsConnection() *WsConnection {
+	c.wsConnectionMutex.Lock()
+	defer c.wsConnectionMutex.Unlock()
+	if c.wsConnection == nil {
+		c.wsConnection = NewWsConnection(c.wsUrl, c.reconnectPolicy, c.wsConnectionOptions...)
+	}
+	return c.wsConnection
+}
+
+// subscribeForType subscribes to the channel and id on the connection, and writes the output to the channel.
+// It returns when the context is cancelled, the server returns an error for the subscription, or the connection fails.
+func subscribeForType[TData any](ctx context.Context, w *WsConnection, channel, id string, newSubscribe func() any, matchSubscribed func([]byte) bool, cfg *subscriptionConfig, output chan<- *ChannelResponse[TData]) error {
+	sub, err := w.addSubscriber(channel, id, newSubscribe, matchSubscribed, cfg)
+	if err != nil {
+		return err
+	}
+	defer w.removeSubscriber(sub)
+
+	// stale is nil (blocks forever) if there is no stale timeout.
+	var stale <-chan time.Time
+	// renewed is set when the subscription is renewed after the stale timeout, and cleared by the next message.
+	renewed := false
+	var staleTimer *time.Timer
+	if cfg.staleTimeout > 0 {
+		staleTimer = time.NewTimer(cfg.staleTimeout)
+		defer staleTimer.Stop()
+		stale = staleTimer.C
+	}
+
+	send := func(resp *ChannelResponse[TData]) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case output <- resp:
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-sub.done:
+			return sub.err
+
+		case <-stale:
+			log.Warnf("no message received for %s %s in %s", channel, id, cfg.staleTimeout)
+			resp := &ChannelResponse[TData]{
+				ChannelResponseHeader: ChannelResponseHeader{
+					Type:    ChannelResponseTypeStale,
+					Channel: channel,
+					Id:      id,
+					Message: fmt.Sprintf("no message received in %s", cfg.staleTimeout),
+				},
+			}
+			if !send(resp) {
+				return nil
+			}
+			if renewed {
+				return fmt.Errorf("%w: %s %s", ErrSubscriptionStale, channel, id)
+			}
+			// the other subscriptions of the connection are not affected.
+			renewed = w.renewSubscription(sub.sub)
+			staleTimer.Reset(cfg.staleTimeout)
+
+		case <-sub.queue.ready:
+			renewed = false
+			if staleTimer != nil {
+				if !staleTimer.Stop() {
+					<-staleTimer.C
+				}
+				staleTimer.Reset(cfg.staleTimeout)
+			}
+
+			for event, ok := sub.queue.next(); ok; event, ok = sub.queue.next() {
+				resp, err := parseWsEvent[TData](event)
+				if err != nil {
+					log.Warnf("failed to parse data: %v", err)
+					continue
+				}
+
+				if resp.Type == ChannelResponseTypeError {
+					return &ChannelError{ChannelResponseHeader: resp.ChannelResponseHeader}
+				}
+
+				if !send(resp) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// parseWsEvent parses the event into a response. Synthetic events only have the header.
+func parseWsEvent[TData any](event *wsEvent) (*ChannelResponse[TData], error) {
+	resp := new(ChannelResponse[TData])
+	if event.data == nil {
+		resp.ChannelResponseHeader = event.header
+		return resp, nil
+	}
+	if err := json.Unmarshal(event.data, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SubscribeOrderbook subscribes to the orderbook of the market on the connection. See Client.SubscribeOrderbook.
+func (w *WsConnection) SubscribeOrderbook(ctx context.Context, market string, outputChan chan<- *OrderbookChannelResponse, options ...SubscriptionOption) error {
+	cfg := newSubscriptionConfig(options)
+	return subscribeForType(ctx, w, OrderbookChannel, market, func() any { return newOrderbookChannelRequest(market, cfg) }, nil, cfg, outputChan)
+}
+
+// SubscribeTrades subscribes to the trades of the market on the connection. See Client.SubscribeTrades.
+func (w *WsConnection) SubscribeTrades(ctx context.Context, market string, outputChan chan<- *TradesChannelResponse, options ...SubscriptionOption) error {
+	cfg := newSubscriptionConfig(options)
+	return subscribeForType(ctx, w, TradesChannel, market, func() any { return newTradesChannelRequest(market, cfg) }, nil, cfg, outputChan)
+}
+
+// SubscribeMarkets subscribes to the markets on the connection. See Client.SubscribeMarkets.
+func (w *WsConnection) SubscribeMarkets(ctx context.Context, outputChan chan<- *MarketsChannelResponse, options ...SubscriptionOption) error {
+	cfg := newSubscriptionConfig(options)
+	return subscribeForType(ctx, w, MarketsChannel, "", func() any { return newMarketsChannelRequest() }, nil, cfg, outputChan)
+}
+
+// SubscribeAccount subscribes to the account on the connection. See Client.SubscribeAccount.
+func (w *WsConnection) SubscribeAccount(ctx context.Context, apiKey *ApiKey, accountNumber int, outputChan chan<- *AccountChannelResponse, options ...SubscriptionOption) error {
+	if apiKey == nil {
+		return fmt.Errorf("api key is nil")
+	}
+	cfg := newSubscriptionConfig(options)
+	// the subscription is re-keyed to the account id after it is acknowledged.
+	return subscribeForType(ctx, w, AccountChannel, strconv.Itoa(accountNumber), func() any { return newAccountChannelRequest(apiKey, accountNumber) }, matchAccountSubscribed(accountNumber), cfg, outputChan)
+}